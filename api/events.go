@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+// event is a server-sent event, where the data is the entry
+type event struct {
+	name string
+	view entryView
+}
+
+// events streams the status and the state changes and the periodic progress of the active entries as server-sent events
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	// the status events are buffered, so the slow client doesn't block the manager. The event is dropped when it's full
+	queue := make(chan event, 64)
+	unsubscribe := s.manager.Subscribe(func(e rapid.Event) {
+		task, err := s.manager.Get(e.ID)
+		if err != nil {
+			return
+		}
+
+		name := "status"
+		if e.State != "" {
+			name = "state"
+		}
+
+		select {
+		case queue <- event{name: name, view: newView(task)}:
+		default:
+			s.logger.Warn("Event stream is too slow, dropping event", "entry", e.ID, "status", e.Status)
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(s.opt.progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case e := <-queue:
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			for _, task := range s.manager.List(rapid.StatusActive) {
+				if err := writeEvent(w, event{name: "progress", view: newView(task)}); err != nil {
+					return
+				}
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e event) error {
+	data, err := json.Marshal(e.view)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, data)
+	return err
+}
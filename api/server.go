@@ -0,0 +1,428 @@
+// Package api serves the http api to manage the downloads, e.g for a dashboard. The api is described in openapi.json
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+type (
+	// entryView is the representation of an entry in the api
+	entryView struct {
+		ID         string       `json:"id"`
+		Name       string       `json:"name"`
+		Location   string       `json:"location"`
+		Size       int64        `json:"size"`
+		Type       string       `json:"type"`
+		URL        string       `json:"url"`
+		ChunkLen   int          `json:"chunkLen"`
+		Resumable  bool         `json:"resumable"`
+		Status     rapid.Status `json:"status"`
+		State      rapid.State  `json:"state,omitempty"`
+		Downloaded int64        `json:"downloaded"`
+		Speed      int64        `json:"speed"`
+		Error      string       `json:"error,omitempty"`
+	}
+
+	newEntry struct {
+		URL      string            `json:"url"`
+		Headers  map[string]string `json:"headers"`
+		Cookies  map[string]string `json:"cookies"`
+		Location string            `json:"location"`
+	}
+
+	serverOption struct {
+		token            string
+		origins          []string
+		listen           string
+		entryOptions     []rapid.EntryOptions
+		progressInterval time.Duration
+		live             *rapid.LiveSetting
+	}
+
+	ServerOptions func(o *serverOption)
+
+	// Server handles the http api of the entries in the manager
+	Server struct {
+		manager *rapid.Manager
+		setting rapid.Setting
+		logger  rapid.Logger
+		opt     *serverOption
+		mux     *http.ServeMux
+		done    chan struct{}
+	}
+)
+
+//go:embed openapi.json
+var openapi []byte
+
+// fetchTimeout is how long the url of the new entry is fetched before the request fails
+const fetchTimeout = 30 * time.Second
+
+// SetToken requires every request to carry "Authorization: Bearer <token>"
+func SetToken(token string) ServerOptions {
+	return func(o *serverOption) {
+		o.token = token
+	}
+}
+
+// SetAllowedOrigins allows the dashboard which is served from the origins to call the api from the browser. The
+// wildcard "*" allows every origin, but only along with the token, see rapid.AllowOrigin
+func SetAllowedOrigins(origins ...string) ServerOptions {
+	return func(o *serverOption) {
+		o.origins = origins
+	}
+}
+
+// SetListenAddress sets the address the api listens on, so the request addressed to its name is allowed without the
+// token, see rapid.AllowHost
+func SetListenAddress(addr string) ServerOptions {
+	return func(o *serverOption) {
+		o.listen = addr
+	}
+}
+
+// SetEntryOptions sets the options which are used to fetch the new entry, e.g cookies
+func SetEntryOptions(options ...rapid.EntryOptions) ServerOptions {
+	return func(o *serverOption) {
+		o.entryOptions = options
+	}
+}
+
+// SetProgressInterval sets how often the progress of the active entries is sent to the event stream
+func SetProgressInterval(interval time.Duration) ServerOptions {
+	return func(o *serverOption) {
+		o.progressInterval = interval
+	}
+}
+
+// SetLiveSetting serves the setting, so it can be read and changed at runtime
+func SetLiveSetting(setting *rapid.LiveSetting) ServerOptions {
+	return func(o *serverOption) {
+		o.live = setting
+	}
+}
+
+// NewServer creates the api that maps the requests onto the manager
+func NewServer(manager *rapid.Manager, setting rapid.Setting, options ...ServerOptions) *Server {
+	opt := &serverOption{
+		progressInterval: time.Second,
+	}
+
+	for _, option := range options {
+		option(opt)
+	}
+
+	s := &Server{
+		manager: manager,
+		setting: setting,
+		logger:  rapid.NewLogger(setting).With("service", "api"),
+		opt:     opt,
+		mux:     http.NewServeMux(),
+		done:    make(chan struct{}),
+	}
+
+	s.mux.HandleFunc("GET /openapi.json", s.openapi)
+	s.mux.HandleFunc("POST /entries", s.authorized(s.create))
+	s.mux.HandleFunc("GET /entries", s.authorized(s.list))
+	s.mux.HandleFunc("GET /entries/{id}", s.authorized(s.get))
+	s.mux.HandleFunc("DELETE /entries/{id}", s.authorized(s.remove))
+	s.mux.HandleFunc("POST /entries/{id}/pause", s.authorized(s.action(manager.Pause)))
+	s.mux.HandleFunc("POST /entries/{id}/resume", s.authorized(s.action(manager.Unpause)))
+	s.mux.HandleFunc("POST /entries/{id}/restart", s.authorized(s.action(manager.Restart)))
+	s.mux.HandleFunc("GET /events", s.authorized(s.events))
+
+	if opt.live != nil {
+		s.mux.HandleFunc("GET /settings", s.authorized(s.settings))
+		s.mux.HandleFunc("PATCH /settings", s.authorized(s.changeSettings))
+	}
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the browser sends the request of another origin even without cors, so it is refused before it does anything
+	if !rapid.AllowOrigin(r, s.opt.origins, s.opt.token != "") {
+		writeError(w, http.StatusForbidden, fmt.Errorf("origin is not allowed"))
+		return
+	}
+
+	// without the token, the page which resolves its own name into this server could call it as the same origin
+	if s.opt.token == "" && !rapid.AllowHost(r, s.opt.listen) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("host is not allowed"))
+		return
+	}
+
+	setCORS(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// the form of another page can post the plain text without the preflight of cors, but not json
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.ContentLength != 0 {
+		if mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediatype != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json"))
+			return
+		}
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// setCORS allows the dashboard which is served from the allowed origin to read the response
+func setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+}
+
+// Close ends the event streams
+func (s *Server) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.opt.token == "" {
+			handler(w, r)
+			return
+		}
+
+		// EventSource of the browser can't set the header, so the token can be passed in the query as well
+		token := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.opt.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *Server) openapi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi)
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var body newEntry
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if body.URL == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("url is required"))
+		return
+	}
+
+	// the location is checked before the url is fetched, so the unsafe request is refused right away
+	location := ""
+	if body.Location != "" {
+		var err error
+		if location, err = rapid.SafeLocation(s.setting.DownloadLocation(), body.Location); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	options := append([]rapid.EntryOptions{rapid.SetEntrySetting(s.setting)}, s.opt.entryOptions...)
+	if len(body.Headers) > 0 {
+		headers := http.Header{}
+		for key, value := range body.Headers {
+			headers.Set(key, value)
+		}
+
+		options = append(options, rapid.AddHeaders(headers))
+	}
+
+	if len(body.Cookies) > 0 {
+		cookies := make([]*http.Cookie, 0, len(body.Cookies))
+		for name, value := range body.Cookies {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+		}
+
+		options = append(options, rapid.AddCookies(cookies))
+	}
+
+	// the url which never responds can't hold the request forever, and the fetch stops along with the client
+	ctx, cancel := context.WithTimeout(r.Context(), fetchTimeout)
+	defer cancel()
+
+	entry, err := rapid.Fetch(body.URL, append(options, rapid.SetEntryContext(ctx))...)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, err)
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	if location != "" {
+		relocator, ok := entry.(rapid.EntryRelocator)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("entry can't be relocated"))
+			return
+		}
+
+		relocator.Relocate(location)
+	}
+
+	if err := s.manager.Add(entry); err != nil {
+		writeError(w, statusCode(err), err)
+		return
+	}
+
+	s.writeEntry(w, http.StatusCreated, entry.ID())
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]rapid.Status, 0)
+	for _, status := range r.URL.Query()["status"] {
+		statuses = append(statuses, rapid.Status(status))
+	}
+
+	tasks := s.manager.List(statuses...)
+	views := make([]entryView, 0, len(tasks))
+	for _, task := range tasks {
+		views = append(views, newView(task))
+	}
+
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	s.writeEntry(w, http.StatusOK, r.PathValue("id"))
+}
+
+func (s *Server) remove(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// the entry which is already stopped can't be removed, but it can still be purged
+	if err := s.manager.Remove(id); err != nil && !errors.Is(err, rapid.ErrInvalidStatus) {
+		writeError(w, statusCode(err), err)
+		return
+	}
+
+	if err := s.manager.Purge(id); err != nil {
+		writeError(w, statusCode(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// action performs the change to the entry and responds with the entry afterward
+func (s *Server) action(change func(id string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if err := change(id); err != nil {
+			writeError(w, statusCode(err), err)
+			return
+		}
+
+		s.writeEntry(w, http.StatusOK, id)
+	}
+}
+
+func (s *Server) settings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.opt.live)
+}
+
+// changeSettings changes the keys of the body and keeps the rest, the setting is left unchanged if any of them is invalid
+func (s *Server) changeSettings(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.opt.live.UnmarshalJSON(body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.logger.Info("Setting is changed")
+	writeJSON(w, http.StatusOK, s.opt.live)
+}
+
+func (s *Server) writeEntry(w http.ResponseWriter, code int, id string) {
+	task, err := s.manager.Get(id)
+	if err != nil {
+		writeError(w, statusCode(err), err)
+		return
+	}
+
+	writeJSON(w, code, newView(task))
+}
+
+func newView(task rapid.Task) entryView {
+	entry := task.Entry
+	view := entryView{
+		ID:         entry.ID(),
+		Name:       entry.Name(),
+		Location:   entry.Location(),
+		Size:       entry.Size(),
+		Type:       entry.Type(),
+		URL:        entry.URL(),
+		ChunkLen:   entry.ChunkLen(),
+		Resumable:  entry.Resumable(),
+		Status:     task.Status,
+		State:      task.State,
+		Downloaded: task.Downloaded,
+		Speed:      task.Speed,
+	}
+
+	if task.Err != nil {
+		view.Error = task.Err.Error()
+	}
+
+	return view
+}
+
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, rapid.ErrEntryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, rapid.ErrInvalidStatus), errors.Is(err, rapid.ErrEntryExists):
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
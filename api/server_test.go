@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+type testSetting struct {
+	rapid.Setting
+	dir string
+}
+
+func (s *testSetting) DownloadLocation() string                { return s.dir }
+func (s *testSetting) CategoryLocation(filetype string) string { return s.dir }
+func (s *testSetting) DataLocation() string                    { return s.dir }
+func (s *testSetting) MinChunkSize() int64                     { return 1024 }
+
+const testToken = "s3cret"
+
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	content := bytes.Repeat([]byte("rapid"), 1024)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(files.Close)
+
+	setting := &testSetting{Setting: rapid.DefaultSetting(), dir: t.TempDir()}
+	downloader := rapid.NewDownloader(rapid.DownloaderDefault, rapid.SetDownloaderSetting(setting))
+	manager := rapid.NewManager(downloader, rapid.NewQueue(rapid.QueueDefault, setting), setting)
+	t.Cleanup(manager.Close)
+
+	server := NewServer(manager, setting, SetToken(testToken), SetProgressInterval(10*time.Millisecond))
+	api := httptest.NewServer(server)
+	t.Cleanup(api.Close)
+	t.Cleanup(func() { server.Close() })
+
+	return api, files.URL + "/file.bin"
+}
+
+func request(t *testing.T, method string, url string, body interface{}, v interface{}) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, _ := http.NewRequest(method, url, reader)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error requesting api:", err.Error())
+	}
+	defer res.Body.Close()
+
+	if v != nil {
+		json.NewDecoder(res.Body).Decode(v)
+	}
+
+	return res.StatusCode
+}
+
+func waitComplete(t *testing.T, url string, id string) entryView {
+	t.Helper()
+
+	var view entryView
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		request(t, http.MethodGet, url+"/entries/"+id, nil, &view)
+		if view.Status == rapid.StatusComplete {
+			return view
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected entry %s to be complete, got %s", id, view.Status)
+	return view
+}
+
+func TestEntries(t *testing.T) {
+	api, file := newTestServer(t)
+
+	var created entryView
+	if code := request(t, http.MethodPost, api.URL+"/entries", map[string]interface{}{"url": file}, &created); code != http.StatusCreated {
+		t.Fatalf("Expected %d, got %d", http.StatusCreated, code)
+	}
+
+	view := waitComplete(t, api.URL, created.ID)
+	if view.Downloaded != view.Size {
+		t.Errorf("Expected %d bytes downloaded, got %d", view.Size, view.Downloaded)
+	}
+
+	var views []entryView
+	request(t, http.MethodGet, api.URL+"/entries?status=complete", nil, &views)
+	if len(views) != 1 || views[0].ID != created.ID {
+		t.Errorf("Expected the completed entry to be listed, got %v", views)
+	}
+
+	if code := request(t, http.MethodPost, api.URL+"/entries/"+created.ID+"/pause", nil, nil); code != http.StatusConflict {
+		t.Errorf("Expected completed entry to not be paused, got %d", code)
+	}
+
+	if code := request(t, http.MethodPost, api.URL+"/entries/"+created.ID+"/restart", nil, nil); code != http.StatusOK {
+		t.Errorf("Expected entry to be restarted, got %d", code)
+	}
+
+	waitComplete(t, api.URL, created.ID)
+
+	if code := request(t, http.MethodDelete, api.URL+"/entries/"+created.ID, nil, nil); code != http.StatusNoContent {
+		t.Errorf("Expected entry to be deleted, got %d", code)
+	}
+
+	if code := request(t, http.MethodGet, api.URL+"/entries/"+created.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected deleted entry to be not found, got %d", code)
+	}
+
+	if code := request(t, http.MethodPost, api.URL+"/entries", map[string]interface{}{}, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected missing url to be bad request, got %d", code)
+	}
+}
+
+func TestEntryLocation(t *testing.T) {
+	api, file := newTestServer(t)
+
+	for _, location := range []string{"/tmp/file.bin", "../file.bin", "video/../../file.bin"} {
+		body := map[string]interface{}{"url": file, "location": location}
+		if code := request(t, http.MethodPost, api.URL+"/entries", body, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected location %s to be bad request, got %d", location, code)
+		}
+	}
+
+	var created entryView
+	body := map[string]interface{}{"url": file, "location": "video/file.bin"}
+	if code := request(t, http.MethodPost, api.URL+"/entries", body, &created); code != http.StatusCreated {
+		t.Fatalf("Expected %d, got %d", http.StatusCreated, code)
+	}
+
+	view := waitComplete(t, api.URL, created.ID)
+	if !strings.HasSuffix(view.Location, filepath.Join("video", "file.bin")) {
+		t.Errorf("Expected the entry to be placed in the download location, got %s", view.Location)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	api, _ := newTestServer(t)
+
+	res, err := http.Get(api.URL + "/entries")
+	if err != nil {
+		t.Fatal("Error requesting api:", err.Error())
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+
+	res, err = http.Get(api.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal("Error requesting api:", err.Error())
+	}
+	defer res.Body.Close()
+
+	var spec map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&spec); err != nil || spec["openapi"] == nil {
+		t.Errorf("Expected the openapi description, got %v", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	api, file := newTestServer(t)
+
+	res, err := http.Get(api.URL + "/events?token=" + testToken)
+	if err != nil {
+		t.Fatal("Error requesting events:", err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %s", res.Header.Get("Content-Type"))
+	}
+
+	request(t, http.MethodPost, api.URL+"/entries", map[string]interface{}{"url": file}, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "data: ") && strings.Contains(line, `"status":"complete"`) {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the complete event")
+	}
+}
+
+func TestSettings(t *testing.T) {
+	dir := t.TempDir()
+	setting, err := rapid.NewSettingBuilder().DownloadLocation(dir).DataLocation(dir).Build()
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	live := rapid.NewLiveSetting(setting)
+	downloader := rapid.NewDownloader(rapid.DownloaderDefault, rapid.SetDownloaderSetting(live))
+	manager := rapid.NewManager(downloader, rapid.NewQueue(rapid.QueueDefault, live), live)
+	t.Cleanup(manager.Close)
+
+	server := NewServer(manager, live, SetToken(testToken), SetLiveSetting(live))
+	api := httptest.NewServer(server)
+	t.Cleanup(api.Close)
+
+	var values map[string]interface{}
+	if code := request(t, http.MethodPatch, api.URL+"/settings", map[string]interface{}{"rateLimit": 1024, "maxRetry": 7}, &values); code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, code)
+	}
+
+	if values["rateLimit"] != float64(1024) || live.MaxRetry() != 7 {
+		t.Errorf("Expected the setting to be changed, got %v", values)
+	}
+
+	if code := request(t, http.MethodPatch, api.URL+"/settings", map[string]interface{}{"downloadLocation": t.TempDir()}, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected the download location to be rejected, got %d", code)
+	}
+
+	category := map[string]interface{}{"categoryLocation": map[string]string{"Video": "/etc"}}
+	if code := request(t, http.MethodPatch, api.URL+"/settings", category, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected the category location to be rejected, got %d", code)
+	}
+
+	if location := live.CategoryLocation("Video"); location != dir {
+		t.Errorf("Expected the category location to be kept, got %s", location)
+	}
+
+	values = nil
+	request(t, http.MethodGet, api.URL+"/settings", nil, &values)
+	if values["downloadLocation"] != dir || values["maxRetry"] != float64(7) {
+		t.Errorf("Expected the current setting, got %v", values)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	post := func(url string, origin string, contentType string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, url+"/entries", strings.NewReader(`{"url":"http://localhost:1/file.bin"}`))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Content-Type", contentType)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Error requesting api:", err.Error())
+		}
+		res.Body.Close()
+
+		return res
+	}
+
+	api, _ := newTestServer(t)
+	if res := post(api.URL, "http://evil.example", "application/json"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the other origin to be forbidden, got %d", res.StatusCode)
+	}
+
+	if res := post(api.URL, api.URL, "application/json"); res.StatusCode != http.StatusBadGateway || res.Header.Get("Access-Control-Allow-Origin") != api.URL {
+		t.Errorf("Expected the same origin to be allowed, got %d %v", res.StatusCode, res.Header)
+	}
+
+	// the form of another page can post the plain text without the preflight
+	if res := post(api.URL, api.URL, "text/plain"); res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected the plain text to be refused, got %d", res.StatusCode)
+	}
+
+	setting := &testSetting{Setting: rapid.DefaultSetting(), dir: t.TempDir()}
+	downloader := rapid.NewDownloader(rapid.DownloaderDefault, rapid.SetDownloaderSetting(setting))
+	manager := rapid.NewManager(downloader, rapid.NewQueue(rapid.QueueDefault, setting), setting)
+	t.Cleanup(manager.Close)
+
+	newServer := func(options ...ServerOptions) string {
+		server := httptest.NewServer(NewServer(manager, setting, options...))
+		t.Cleanup(server.Close)
+
+		return server.URL
+	}
+
+	listed := newServer(SetToken(testToken), SetAllowedOrigins("http://ui.example"))
+	if res := post(listed, "http://ui.example", "application/json"); res.StatusCode != http.StatusBadGateway || res.Header.Get("Access-Control-Allow-Origin") != "http://ui.example" {
+		t.Errorf("Expected the listed origin to be allowed, got %d %v", res.StatusCode, res.Header)
+	}
+
+	if wildcard := newServer(SetAllowedOrigins("*")); post(wildcard, "http://evil.example", "application/json").StatusCode != http.StatusForbidden {
+		t.Error("Expected every origin to be refused without the token")
+	}
+
+	if wildcard := newServer(SetToken(testToken), SetAllowedOrigins("*")); post(wildcard, "http://ui.example", "application/json").StatusCode != http.StatusBadGateway {
+		t.Error("Expected every origin to be allowed along with the token")
+	}
+
+	// the page which resolves its own name into the api can't call it without the token
+	req, _ := http.NewRequest(http.MethodGet, newServer()+"/entries", nil)
+	req.Host = "evil.example"
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error requesting api:", err.Error())
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the other host to be forbidden without the token, got %d", res.StatusCode)
+	}
+}
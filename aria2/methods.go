@@ -0,0 +1,464 @@
+package aria2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+// compatVersion is the version of aria2 which api is served by this package
+const compatVersion = "1.37.0"
+
+var methods map[string]method
+
+// events maps the status of the entry into the aria2 notification
+var events = map[rapid.Status]string{
+	rapid.StatusActive:   "aria2.onDownloadStart",
+	rapid.StatusPaused:   "aria2.onDownloadPause",
+	rapid.StatusRemoved:  "aria2.onDownloadStop",
+	rapid.StatusComplete: "aria2.onDownloadComplete",
+	rapid.StatusError:    "aria2.onDownloadError",
+}
+
+func init() {
+	methods = map[string]method{
+		"aria2.addUri":             addURI,
+		"aria2.tellStatus":         tellStatus,
+		"aria2.tellActive":         tellActive,
+		"aria2.tellWaiting":        tellWaiting,
+		"aria2.tellStopped":        tellStopped,
+		"aria2.pause":              pause,
+		"aria2.forcePause":         pause,
+		"aria2.unpause":            unpause,
+		"aria2.remove":             remove,
+		"aria2.forceRemove":        remove,
+		"aria2.getGlobalStat":      getGlobalStat,
+		"aria2.changeGlobalOption": changeGlobalOption,
+		"aria2.getVersion":         getVersion,
+		"system.listMethods":       listMethods,
+		"system.listNotifications": listNotifications,
+		"system.multicall":         multicall,
+	}
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func invalidParams(format string, args ...interface{}) error {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// param decodes the param at the index into v. Missing optional param leaves v untouched
+func param(params []json.RawMessage, index int, v interface{}, required bool) error {
+	if index >= len(params) {
+		if required {
+			return invalidParams("missing param at index %d", index)
+		}
+
+		return nil
+	}
+
+	if err := json.Unmarshal(params[index], v); err != nil {
+		return invalidParams("invalid param at index %d: %v", index, err)
+	}
+
+	return nil
+}
+
+func addURI(s *Server, params []json.RawMessage) (interface{}, error) {
+	var uris []string
+	if err := param(params, 0, &uris, true); err != nil {
+		return nil, err
+	}
+
+	if len(uris) == 0 {
+		return nil, invalidParams("uris must not be empty")
+	}
+
+	options := map[string]interface{}{}
+	if err := param(params, 1, &options, false); err != nil {
+		return nil, err
+	}
+
+	entryOptions := append([]rapid.EntryOptions{rapid.SetEntrySetting(s.setting)}, s.opt.entryOptions...)
+	if headers := headerOption(options["header"]); len(headers) > 0 {
+		entryOptions = append(entryOptions, rapid.AddHeaders(headers))
+	}
+
+	// only the first uri is used, as rapid downloads every chunk from the same url
+	entry, err := rapid.Fetch(uris[0], entryOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, _ := options["dir"].(string)
+	out, _ := options["out"].(string)
+	if dir != "" || out != "" {
+		if err := relocate(entry, s.setting.DownloadLocation(), dir, out); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.manager.Add(entry); err != nil {
+		return nil, err
+	}
+
+	return entry.ID(), nil
+}
+
+// headerOption reads the header option which is either a single "Name: value" or a list of them
+func headerOption(value interface{}) http.Header {
+	lines := make([]string, 0)
+	switch v := value.(type) {
+	case string:
+		lines = append(lines, v)
+	case []interface{}:
+		for _, line := range v {
+			if s, ok := line.(string); ok {
+				lines = append(lines, s)
+			}
+		}
+	}
+
+	headers := http.Header{}
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if ok {
+			headers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+
+	return headers
+}
+
+// relocate places the entry into the dir, which must be inside the download location, with the out as its name
+func relocate(entry rapid.Entry, root string, dir string, out string) error {
+	relocator, ok := entry.(rapid.EntryRelocator)
+	if !ok {
+		return fmt.Errorf("entry can't be relocated")
+	}
+
+	name := entry.Name()
+	if out != "" {
+		name = filepath.Base(out)
+	}
+
+	// the entry stays in the location chosen by the setting unless the dir is given
+	base := filepath.Dir(entry.Location())
+	if dir != "" {
+		base = root
+
+		// aria2 clients send the absolute dir, which is allowed as long as it is inside the download location
+		if filepath.IsAbs(dir) {
+			rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(dir))
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("%w: %q", rapid.ErrUnsafeLocation, dir)
+			}
+
+			dir = rel
+		}
+
+		name = filepath.Join(dir, name)
+	}
+
+	location, err := rapid.SafeLocation(base, name)
+	if err != nil {
+		return err
+	}
+
+	relocator.Relocate(location)
+	return nil
+}
+
+func tellStatus(s *Server, params []json.RawMessage) (interface{}, error) {
+	var gid string
+	if err := param(params, 0, &gid, true); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if err := param(params, 1, &keys, false); err != nil {
+		return nil, err
+	}
+
+	task, err := s.manager.Get(gid)
+	if err != nil {
+		return nil, fmt.Errorf("GID %s is not found", gid)
+	}
+
+	return status(task, keys), nil
+}
+
+func tellActive(s *Server, params []json.RawMessage) (interface{}, error) {
+	var keys []string
+	if err := param(params, 0, &keys, false); err != nil {
+		return nil, err
+	}
+
+	return statuses(s.manager.List(rapid.StatusActive), keys), nil
+}
+
+func tellWaiting(s *Server, params []json.RawMessage) (interface{}, error) {
+	return tellRange(s, params, rapid.StatusWaiting, rapid.StatusPaused)
+}
+
+func tellStopped(s *Server, params []json.RawMessage) (interface{}, error) {
+	return tellRange(s, params, rapid.StatusComplete, rapid.StatusError, rapid.StatusRemoved)
+}
+
+// tellRange returns num entries from the offset. Negative offset counts from the last entry in the reverse order
+func tellRange(s *Server, params []json.RawMessage, filter ...rapid.Status) (interface{}, error) {
+	var offset, num int
+	if err := param(params, 0, &offset, true); err != nil {
+		return nil, err
+	}
+
+	if err := param(params, 1, &num, true); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if err := param(params, 2, &keys, false); err != nil {
+		return nil, err
+	}
+
+	tasks := s.manager.List(filter...)
+	if offset < 0 {
+		for i, j := 0, len(tasks)-1; i < j; i, j = i+1, j-1 {
+			tasks[i], tasks[j] = tasks[j], tasks[i]
+		}
+
+		offset = -offset - 1
+	}
+
+	if offset >= len(tasks) || num <= 0 {
+		return []map[string]interface{}{}, nil
+	}
+
+	end := offset + num
+	if end > len(tasks) {
+		end = len(tasks)
+	}
+
+	return statuses(tasks[offset:end], keys), nil
+}
+
+func statuses(tasks []rapid.Task, keys []string) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		result = append(result, status(task, keys))
+	}
+
+	return result
+}
+
+// status is the aria2 representation of the entry where every number is a string. Only the keys are returned if given
+func status(task rapid.Task, keys []string) map[string]interface{} {
+	entry := task.Entry
+	connections := 0
+	if task.Status == rapid.StatusActive {
+		connections = entry.ChunkLen()
+	}
+
+	size := entry.Size()
+	if size < 0 {
+		size = 0
+	}
+
+	result := map[string]interface{}{
+		"gid":             entry.ID(),
+		"status":          string(task.Status),
+		"totalLength":     strconv.FormatInt(size, 10),
+		"completedLength": strconv.FormatInt(task.Downloaded, 10),
+		"uploadLength":    "0",
+		"downloadSpeed":   strconv.FormatInt(task.Speed, 10),
+		"uploadSpeed":     "0",
+		"connections":     strconv.Itoa(connections),
+		"numPieces":       strconv.Itoa(entry.ChunkLen()),
+		"dir":             filepath.Dir(entry.Location()),
+		"files": []map[string]interface{}{{
+			"index":           "1",
+			"path":            entry.Location(),
+			"length":          strconv.FormatInt(size, 10),
+			"completedLength": strconv.FormatInt(task.Downloaded, 10),
+			"selected":        "true",
+			"uris":            []map[string]string{{"uri": entry.URL(), "status": "used"}},
+		}},
+	}
+
+	if task.Status == rapid.StatusError {
+		result["errorCode"] = "1"
+		result["errorMessage"] = task.Err.Error()
+	} else if task.Status == rapid.StatusComplete {
+		result["errorCode"] = "0"
+	}
+
+	if len(keys) == 0 {
+		return result
+	}
+
+	filtered := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if value, ok := result[key]; ok {
+			filtered[key] = value
+		}
+	}
+
+	return filtered
+}
+
+func pause(s *Server, params []json.RawMessage) (interface{}, error) {
+	return changeGID(s, params, s.manager.Pause)
+}
+
+func unpause(s *Server, params []json.RawMessage) (interface{}, error) {
+	return changeGID(s, params, s.manager.Unpause)
+}
+
+func remove(s *Server, params []json.RawMessage) (interface{}, error) {
+	return changeGID(s, params, s.manager.Remove)
+}
+
+func changeGID(s *Server, params []json.RawMessage, change func(id string) error) (interface{}, error) {
+	var gid string
+	if err := param(params, 0, &gid, true); err != nil {
+		return nil, err
+	}
+
+	if err := change(gid); err != nil {
+		return nil, fmt.Errorf("GID %s: %v", gid, err)
+	}
+
+	return gid, nil
+}
+
+func getGlobalStat(s *Server, params []json.RawMessage) (interface{}, error) {
+	stat := s.manager.Stat()
+
+	return map[string]string{
+		"downloadSpeed":   strconv.FormatInt(stat.Speed, 10),
+		"uploadSpeed":     "0",
+		"numActive":       strconv.Itoa(stat.Active),
+		"numWaiting":      strconv.Itoa(stat.Waiting),
+		"numStopped":      strconv.Itoa(stat.Stopped),
+		"numStoppedTotal": strconv.Itoa(stat.Stopped),
+	}, nil
+}
+
+// changeGlobalOption supports max-concurrent-downloads and max-overall-download-limit, the other options are ignored
+func changeGlobalOption(s *Server, params []json.RawMessage) (interface{}, error) {
+	options := map[string]string{}
+	if err := param(params, 0, &options, true); err != nil {
+		return nil, err
+	}
+
+	if value, ok := options["max-concurrent-downloads"]; ok {
+		max, err := strconv.Atoi(value)
+		if err != nil || max < 1 {
+			return nil, invalidParams("invalid max-concurrent-downloads %q", value)
+		}
+
+		s.manager.SetMaxActive(max)
+	}
+
+	if value, ok := options["max-overall-download-limit"]; ok {
+		limit, err := parseSpeed(value)
+		if err != nil {
+			return nil, invalidParams("invalid max-overall-download-limit %q", value)
+		}
+
+		if err := s.manager.SetRateLimit(limit); err != nil {
+			return nil, err
+		}
+	}
+
+	return "OK", nil
+}
+
+// parseSpeed parses the speed of aria2 option, which is bytes with optional K or M unit
+func parseSpeed(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"), strings.HasSuffix(value, "k"):
+		multiplier = 1024
+	case strings.HasSuffix(value, "M"), strings.HasSuffix(value, "m"):
+		multiplier = 1024 * 1024
+	}
+
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	speed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || speed < 0 {
+		return 0, fmt.Errorf("invalid speed %q", value)
+	}
+
+	return speed * multiplier, nil
+}
+
+func getVersion(s *Server, params []json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"version":         compatVersion,
+		"enabledFeatures": []string{"HTTPS"},
+	}, nil
+}
+
+func listMethods(s *Server, params []json.RawMessage) (interface{}, error) {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func listNotifications(s *Server, params []json.RawMessage) (interface{}, error) {
+	names := make([]string, 0, len(events))
+	for _, name := range events {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// multicall calls every method in the param, where the result of the succeeded method is wrapped in an array
+func multicall(s *Server, params []json.RawMessage) (interface{}, error) {
+	var calls []struct {
+		MethodName string            `json:"methodName"`
+		Params     []json.RawMessage `json:"params"`
+	}
+
+	if err := param(params, 0, &calls, true); err != nil {
+		return nil, err
+	}
+
+	results := make([]interface{}, 0, len(calls))
+	for _, call := range calls {
+		if call.MethodName == "system.multicall" {
+			results = append(results, &rpcError{Code: codeFailure, Message: "Recursive system.multicall forbidden."})
+			continue
+		}
+
+		result, rerr := s.invoke(call.MethodName, call.Params)
+		if rerr != nil {
+			results = append(results, rerr)
+			continue
+		}
+
+		results = append(results, []interface{}{result})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,365 @@
+// Package aria2 serves the subset of the aria2 json-rpc interface, so the tools that speak to aria2 (AriaNg, browser
+// extensions, scripts, etc) can control the downloads of rapid
+package aria2
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+type (
+	request struct {
+		JSONRPC string            `json:"jsonrpc"`
+		ID      json.RawMessage   `json:"id,omitempty"`
+		Method  string            `json:"method"`
+		Params  []json.RawMessage `json:"params,omitempty"`
+	}
+
+	response struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result,omitempty"`
+		Error   *rpcError       `json:"error,omitempty"`
+	}
+
+	notification struct {
+		JSONRPC string        `json:"jsonrpc"`
+		Method  string        `json:"method"`
+		Params  []interface{} `json:"params"`
+	}
+
+	rpcError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	method func(s *Server, params []json.RawMessage) (interface{}, error)
+
+	serverOption struct {
+		secret       string
+		origins      []string
+		listen       string
+		entryOptions []rapid.EntryOptions
+	}
+
+	ServerOptions func(o *serverOption)
+
+	// Server handles the json-rpc requests over http and websocket. The websocket clients receive the notifications as well
+	Server struct {
+		manager     *rapid.Manager
+		setting     rapid.Setting
+		logger      rapid.Logger
+		opt         *serverOption
+		mu          sync.Mutex
+		conns       map[*wsConn]struct{}
+		unsubscribe func()
+	}
+)
+
+const (
+	codeParse          = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeFailure        = 1 // aria2 reports every failure of the method with this code
+)
+
+var errUnauthorized = &rpcError{Code: codeFailure, Message: "Unauthorized"}
+
+// SetSecret requires every request to carry "token:<secret>" as its first param, like --rpc-secret of aria2
+func SetSecret(secret string) ServerOptions {
+	return func(o *serverOption) {
+		o.secret = secret
+	}
+}
+
+// SetAllowedOrigins allows the web ui which is served from the origins, e.g AriaNg, to call the server from the browser.
+// The wildcard "*" allows every origin, but only along with the secret, otherwise any page the user opens could control
+// the downloads
+func SetAllowedOrigins(origins ...string) ServerOptions {
+	return func(o *serverOption) {
+		o.origins = origins
+	}
+}
+
+// SetListenAddress sets the address the server listens on, so the request addressed to its name is allowed without the
+// secret, see rapid.AllowHost
+func SetListenAddress(addr string) ServerOptions {
+	return func(o *serverOption) {
+		o.listen = addr
+	}
+}
+
+// SetEntryOptions sets the options which are used to fetch the entry of aria2.addUri, e.g cookies
+func SetEntryOptions(options ...rapid.EntryOptions) ServerOptions {
+	return func(o *serverOption) {
+		o.entryOptions = options
+	}
+}
+
+// NewServer creates the server that maps the aria2 methods onto the manager
+func NewServer(manager *rapid.Manager, setting rapid.Setting, options ...ServerOptions) *Server {
+	opt := &serverOption{}
+	for _, option := range options {
+		option(opt)
+	}
+
+	s := &Server{
+		manager: manager,
+		setting: setting,
+		logger:  rapid.NewLogger(setting).With("service", "aria2"),
+		opt:     opt,
+		conns:   make(map[*wsConn]struct{}),
+	}
+
+	for _, origin := range opt.origins {
+		if origin == "*" && opt.secret == "" {
+			s.logger.Warn("Every origin is allowed only along with the secret, so only the listed origins are allowed")
+		}
+	}
+
+	s.unsubscribe = manager.Subscribe(s.notify)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the browser sends the request of another origin even without cors, so it is refused before it does anything
+	if !s.allowOrigin(r) {
+		http.Error(w, "origin is not allowed", http.StatusForbidden)
+		return
+	}
+
+	// without the secret, the page which resolves its own name into this server could call it as the same origin
+	if s.opt.secret == "" && !rapid.AllowHost(r, s.opt.listen) {
+		http.Error(w, "host is not allowed", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodGet && isWebsocket(r) {
+		s.serveWebsocket(w, r)
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		setCORS(w, r)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, wsMaxMessage))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	setCORS(w, r)
+	w.Header().Set("Content-Type", "application/json-rpc")
+	w.Write(s.handle(body))
+}
+
+// allowOrigin checks whether the request comes from the allowed origin, see rapid.AllowOrigin
+func (s *Server) allowOrigin(r *http.Request) bool {
+	return rapid.AllowOrigin(r, s.opt.origins, s.opt.secret != "")
+}
+
+// setCORS allows the web ui which is served from the allowed origin, e.g AriaNg, to read the response
+func setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrade(w, r)
+	if err != nil {
+		s.logger.Warn("Error upgrading to websocket", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+
+		conn.close()
+	}()
+
+	for {
+		message, err := conn.read()
+		if err != nil {
+			return
+		}
+
+		if err := conn.write(s.handle(message)); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers the single or the batch request
+func (s *Server) handle(body []byte) []byte {
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		var requests []request
+		if err := json.Unmarshal(body, &requests); err != nil {
+			return encode(failure(nil, &rpcError{Code: codeParse, Message: err.Error()}))
+		}
+
+		responses := make([]response, 0, len(requests))
+		for _, req := range requests {
+			responses = append(responses, s.call(req))
+		}
+
+		return encode(responses)
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return encode(failure(nil, &rpcError{Code: codeParse, Message: err.Error()}))
+	}
+
+	return encode(s.call(req))
+}
+
+func (s *Server) call(req request) response {
+	if req.Method == "" {
+		return failure(req.ID, &rpcError{Code: codeInvalidRequest, Message: "method is required"})
+	}
+
+	result, rerr := s.invoke(req.Method, req.Params)
+	if rerr != nil {
+		return failure(req.ID, rerr)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return failure(req.ID, &rpcError{Code: codeFailure, Message: err.Error()})
+	}
+
+	return response{JSONRPC: "2.0", ID: req.ID, Result: data}
+}
+
+// invoke authorizes and calls the method. The system methods don't need the secret token
+func (s *Server) invoke(name string, params []json.RawMessage) (interface{}, *rpcError) {
+	fn, ok := methods[name]
+	if !ok {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("No such method: %s", name)}
+	}
+
+	params, authorized := s.authorize(params)
+	if !authorized && !strings.HasPrefix(name, "system.") {
+		return nil, errUnauthorized
+	}
+
+	result, err := fn(s, params)
+	if err != nil {
+		if rerr, ok := err.(*rpcError); ok {
+			return nil, rerr
+		}
+
+		return nil, &rpcError{Code: codeFailure, Message: err.Error()}
+	}
+
+	return result, nil
+}
+
+// authorize checks and strips the secret token from the params
+func (s *Server) authorize(params []json.RawMessage) ([]json.RawMessage, bool) {
+	token := ""
+	if len(params) > 0 {
+		var first string
+		if json.Unmarshal(params[0], &first) == nil && strings.HasPrefix(first, "token:") {
+			token = strings.TrimPrefix(first, "token:")
+			params = params[1:]
+		}
+	}
+
+	return params, s.opt.secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.opt.secret)) == 1
+}
+
+func failure(id json.RawMessage, err *rpcError) response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return response{JSONRPC: "2.0", ID: id, Error: err}
+}
+
+func encode(value interface{}) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(failure(nil, &rpcError{Code: codeFailure, Message: err.Error()}))
+	}
+
+	return data
+}
+
+// notify sends the event of the manager to the websocket clients as the aria2 notification
+func (s *Server) notify(event rapid.Event) {
+	// aria2 only knows the status, so the state change has no notification
+	if event.State != "" {
+		return
+	}
+
+	method, ok := events[event.Status]
+	if !ok {
+		return
+	}
+
+	message := encode(notification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  []interface{}{map[string]string{"gid": event.ID}},
+	})
+
+	s.mu.Lock()
+	conns := make([]*wsConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		if err := conn.write(message); err != nil {
+			s.logger.Debug("Error sending notification", "method", method, "error", err)
+		}
+	}
+}
+
+// Close stops sending the notifications and closes the websocket connections
+func (s *Server) Close() error {
+	s.unsubscribe()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.close()
+	}
+
+	return nil
+}
@@ -0,0 +1,377 @@
+package aria2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+type testSetting struct {
+	rapid.Setting
+	dir string
+}
+
+func (s *testSetting) DownloadLocation() string                { return s.dir }
+func (s *testSetting) CategoryLocation(filetype string) string { return s.dir }
+func (s *testSetting) DataLocation() string                    { return s.dir }
+func (s *testSetting) MinChunkSize() int64                     { return 1024 }
+
+func newTestServer(t *testing.T, options ...ServerOptions) (*httptest.Server, string) {
+	content := bytes.Repeat([]byte("rapid"), 1024)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(files.Close)
+
+	setting := &testSetting{Setting: rapid.DefaultSetting(), dir: t.TempDir()}
+	downloader := rapid.NewDownloader(rapid.DownloaderDefault, rapid.SetDownloaderSetting(setting))
+	manager := rapid.NewManager(downloader, rapid.NewQueue(rapid.QueueDefault, setting), setting)
+	t.Cleanup(manager.Close)
+
+	server := NewServer(manager, setting, options...)
+	t.Cleanup(func() { server.Close() })
+
+	rpc := httptest.NewServer(server)
+	t.Cleanup(rpc.Close)
+
+	return rpc, files.URL + "/file.bin"
+}
+
+type testResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+func call(t *testing.T, url string, method string, params ...interface{}) testResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": "1", "method": method, "params": params})
+	res, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("Error calling rpc:", err.Error())
+	}
+	defer res.Body.Close()
+
+	var response testResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatal("Error decoding response:", err.Error())
+	}
+
+	return response
+}
+
+func TestAddUriAndTellStatus(t *testing.T) {
+	rpc, file := newTestServer(t)
+
+	res := call(t, rpc.URL, "aria2.addUri", []string{file}, map[string]string{"out": "renamed.bin"})
+	if res.Error != nil {
+		t.Fatal("Error adding uri:", res.Error.Message)
+	}
+
+	var gid string
+	json.Unmarshal(res.Result, &gid)
+
+	deadline := time.Now().Add(10 * time.Second)
+	status := map[string]interface{}{}
+	for time.Now().Before(deadline) {
+		res = call(t, rpc.URL, "aria2.tellStatus", gid, []string{"status", "completedLength", "totalLength", "files"})
+		json.Unmarshal(res.Result, &status)
+
+		if status["status"] == "complete" {
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if status["status"] != "complete" || status["completedLength"] != status["totalLength"] {
+		t.Fatalf("Expected complete status, got %v", status)
+	}
+
+	if _, ok := status["gid"]; ok {
+		t.Error("Expected only the requested keys")
+	}
+
+	path := status["files"].([]interface{})[0].(map[string]interface{})["path"].(string)
+	if !strings.HasSuffix(path, "renamed.bin") {
+		t.Errorf("Expected the file to be renamed by out option, got %s", path)
+	}
+
+	var stopped []map[string]interface{}
+	json.Unmarshal(call(t, rpc.URL, "aria2.tellStopped", 0, 10).Result, &stopped)
+	if len(stopped) != 1 {
+		t.Errorf("Expected 1 stopped entry, got %d", len(stopped))
+	}
+
+	var stat map[string]string
+	json.Unmarshal(call(t, rpc.URL, "aria2.getGlobalStat").Result, &stat)
+	if stat["numStopped"] != "1" || stat["numActive"] != "0" {
+		t.Errorf("Expected 1 stopped entry, got %v", stat)
+	}
+}
+
+func TestSecretAndErrors(t *testing.T) {
+	rpc, _ := newTestServer(t, SetSecret("s3cret"))
+
+	if res := call(t, rpc.URL, "aria2.getGlobalStat"); res.Error == nil || res.Error.Message != "Unauthorized" {
+		t.Errorf("Expected unauthorized error, got %+v", res)
+	}
+
+	if res := call(t, rpc.URL, "aria2.getGlobalStat", "token:s3cret"); res.Error != nil {
+		t.Errorf("Expected authorized request, got %v", res.Error.Message)
+	}
+
+	if res := call(t, rpc.URL, "aria2.unknown", "token:s3cret"); res.Error == nil || res.Error.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found, got %+v", res)
+	}
+
+	if res := call(t, rpc.URL, "aria2.tellStatus", "token:s3cret", "missing"); res.Error == nil {
+		t.Error("Expected missing gid to be error")
+	}
+
+	if res := call(t, rpc.URL, "aria2.changeGlobalOption", "token:s3cret", map[string]string{"max-overall-download-limit": "1M"}); res.Error != nil {
+		t.Errorf("Expected option to be changed, got %v", res.Error.Message)
+	}
+
+	calls := []map[string]interface{}{
+		{"methodName": "aria2.getVersion", "params": []string{"token:s3cret"}},
+		{"methodName": "aria2.getVersion"},
+	}
+
+	var results []json.RawMessage
+	json.Unmarshal(call(t, rpc.URL, "system.multicall", calls).Result, &results)
+	if len(results) != 2 || results[0][0] != '[' || !strings.Contains(string(results[1]), "Unauthorized") {
+		t.Errorf("Expected the first call to succeed and the second to fail, got %s", results)
+	}
+}
+
+// wsDial opens the websocket connection with the minimal handshake
+func wsDial(t *testing.T, url string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal("Error dialing:", err.Error())
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "GET /jsonrpc HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil || res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected switching protocols, got %v %v", res, err)
+	}
+
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected accept key %s", accept)
+	}
+
+	return conn, reader
+}
+
+func wsWrite(conn net.Conn, message []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x81, 0x80 | 126}
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(message)))
+	frame = append(frame, mask...)
+	for i, b := range message {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	conn.Write(frame)
+}
+
+func wsRead(t *testing.T, conn net.Conn, reader *bufio.Reader) []byte {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatal("Error reading frame:", err.Error())
+	}
+
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(reader, ext)
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+
+	payload := make([]byte, length)
+	io.ReadFull(reader, payload)
+
+	return payload
+}
+
+func TestWebsocketNotification(t *testing.T) {
+	rpc, file := newTestServer(t)
+	conn, reader := wsDial(t, rpc.URL)
+
+	request, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "aria2.addUri", "params": []interface{}{[]string{file}}})
+	wsWrite(conn, request)
+
+	methods := make(map[string]bool)
+	for !methods["aria2.onDownloadComplete"] {
+		var message struct {
+			Method string `json:"method"`
+			Result string `json:"result"`
+		}
+
+		if err := json.Unmarshal(wsRead(t, conn, reader), &message); err != nil {
+			t.Fatal("Error decoding message:", err.Error())
+		}
+
+		methods[message.Method] = true
+	}
+
+	if !methods["aria2.onDownloadStart"] {
+		t.Error("Expected start notification before complete")
+	}
+}
+
+func TestAddUriDir(t *testing.T) {
+	rpc, file := newTestServer(t)
+
+	for _, dir := range []string{t.TempDir(), "/etc", "../outside", "sub/../../outside"} {
+		if res := call(t, rpc.URL, "aria2.addUri", []string{file}, map[string]string{"dir": dir}); res.Error == nil {
+			t.Errorf("Expected dir %s outside the download location to be refused", dir)
+		}
+	}
+
+	if res := call(t, rpc.URL, "aria2.addUri", []string{file}, map[string]string{"out": ".."}); res.Error == nil {
+		t.Error("Expected out going up from the dir to be refused")
+	}
+
+	res := call(t, rpc.URL, "aria2.addUri", []string{file}, map[string]string{"dir": "sub", "out": "../renamed.bin"})
+	if res.Error != nil {
+		t.Fatal("Error adding uri:", res.Error.Message)
+	}
+
+	var gid string
+	json.Unmarshal(res.Result, &gid)
+
+	var status map[string]interface{}
+	json.Unmarshal(call(t, rpc.URL, "aria2.tellStatus", gid, []string{"files"}).Result, &status)
+	path := status["files"].([]interface{})[0].(map[string]interface{})["path"].(string)
+	if !strings.HasSuffix(path, filepath.Join("sub", "renamed.bin")) {
+		t.Errorf("Expected the file to be placed inside the download location, got %s", path)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	post := func(url string, origin string) *http.Response {
+		body := strings.NewReader(`{"jsonrpc":"2.0","id":"1","method":"aria2.getVersion"}`)
+		req, _ := http.NewRequest(http.MethodPost, url, body)
+		req.Header.Set("Origin", origin)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Error calling rpc:", err.Error())
+		}
+		res.Body.Close()
+
+		return res
+	}
+
+	rpc, _ := newTestServer(t)
+	if res := post(rpc.URL, "http://evil.example"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the other origin to be forbidden, got %d", res.StatusCode)
+	}
+
+	if res := post(rpc.URL, rpc.URL); res.StatusCode != http.StatusOK || res.Header.Get("Access-Control-Allow-Origin") != rpc.URL {
+		t.Errorf("Expected the same origin to be allowed, got %d %v", res.StatusCode, res.Header)
+	}
+
+	// the websocket upgrade from the other origin is refused before the handshake
+	conn, err := net.Dial("tcp", strings.TrimPrefix(rpc.URL, "http://"))
+	if err != nil {
+		t.Fatal("Error dialing:", err.Error())
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET /jsonrpc HTTP/1.1\r\nHost: localhost\r\nOrigin: http://evil.example\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	if res, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil || res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the websocket from the other origin to be forbidden, got %v %v", res, err)
+	}
+
+	listed, _ := newTestServer(t, SetAllowedOrigins("http://ui.example"))
+	if res := post(listed.URL, "http://ui.example"); res.StatusCode != http.StatusOK || res.Header.Get("Access-Control-Allow-Origin") != "http://ui.example" {
+		t.Errorf("Expected the listed origin to be allowed, got %d %v", res.StatusCode, res.Header)
+	}
+
+	wildcard, _ := newTestServer(t, SetAllowedOrigins("*"))
+	if res := post(wildcard.URL, "http://evil.example"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected every origin to be refused without the secret, got %d", res.StatusCode)
+	}
+
+	secret, _ := newTestServer(t, SetAllowedOrigins("*"), SetSecret("s3cret"))
+	if res := post(secret.URL, "http://ui.example"); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected every origin to be allowed along with the secret, got %d", res.StatusCode)
+	}
+}
+
+func TestHost(t *testing.T) {
+	post := func(url string, host string) int {
+		body := strings.NewReader(`{"jsonrpc":"2.0","id":"1","method":"aria2.getVersion"}`)
+		req, _ := http.NewRequest(http.MethodPost, url, body)
+		req.Host = host
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Error calling rpc:", err.Error())
+		}
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	// the page which resolves its own name into the server can't call it without the secret
+	rpc, _ := newTestServer(t, SetListenAddress("rapid.lan:6800"))
+	if code := post(rpc.URL, "evil.example"); code != http.StatusForbidden {
+		t.Errorf("Expected the other host to be forbidden, got %d", code)
+	}
+
+	for _, host := range []string{"localhost:6800", "127.0.0.1:6800", "[::1]:6800", "rapid.lan:6800"} {
+		if code := post(rpc.URL, host); code != http.StatusOK {
+			t.Errorf("Expected host %s to be allowed, got %d", host, code)
+		}
+	}
+
+	secret, _ := newTestServer(t, SetSecret("s3cret"))
+	if code := post(secret.URL, "evil.example"); code != http.StatusOK {
+		t.Errorf("Expected every host to be allowed along with the secret, got %d", code)
+	}
+}
+
+func TestWebsocketProtocol(t *testing.T) {
+	rpc, _ := newTestServer(t)
+
+	frames := map[string][]byte{
+		"unmasked":     {0x81, 0x02, 'h', 'i'},
+		"continuation": {0x80, 0x80, 1, 2, 3, 4},
+		"reserved":     {0xC1, 0x80, 1, 2, 3, 4},
+		"opcode":       {0x83, 0x80, 1, 2, 3, 4},
+	}
+
+	for name, frame := range frames {
+		t.Run(name, func(t *testing.T) {
+			conn, reader := wsDial(t, rpc.URL)
+			conn.Write(frame)
+
+			// the connection is closed with the protocol error
+			if payload := wsRead(t, conn, reader); !bytes.Equal(payload, []byte{0x03, 0xEA}) {
+				t.Errorf("Expected the close frame of the protocol error, got %v", payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package aria2
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	wsGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxMessage = 1 << 20
+
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+var (
+	errWebsocketMessage  = fmt.Errorf("websocket message is too large")
+	errWebsocketProtocol = fmt.Errorf("websocket protocol error")
+)
+
+// closeProtocolError is the payload of the close frame with the status code 1002, protocol error
+var closeProtocolError = []byte{0x03, 0xEA}
+
+// wsConn is the minimal websocket connection (RFC 6455) which is enough to exchange the json-rpc messages
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex // guards the writes, as the notification can be sent while a response is being written
+}
+
+func isWebsocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// upgrade takes over the http connection and completes the websocket handshake
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, fmt.Errorf("bad websocket handshake")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket is not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("connection can't be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// read returns the next text or binary message, answering the ping and close frames along the way. The connection
+// which breaks the protocol is closed with the protocol error
+func (c *wsConn) read() ([]byte, error) {
+	message, err := c.readMessage()
+	if errors.Is(err, errWebsocketProtocol) {
+		c.writeFrame(opClose, closeProtocolError)
+	}
+
+	return message, err
+}
+
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		// the control frame can come between the fragments of the message, but can't be fragmented itself
+		if opcode >= opClose && (!fin || len(payload) > 125) {
+			return nil, fmt.Errorf("%w: fragmented or too large control frame", errWebsocketProtocol)
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText, opBinary:
+			if fragmented {
+				return nil, fmt.Errorf("%w: new message before the previous one is finished", errWebsocketProtocol)
+			}
+		case opContinuation:
+			if !fragmented {
+				return nil, fmt.Errorf("%w: continuation without a message", errWebsocketProtocol)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode %d", errWebsocketProtocol, opcode)
+		}
+
+		message = append(message, payload...)
+		if len(message) > wsMaxMessage {
+			return nil, errWebsocketMessage
+		}
+
+		if fin {
+			return message, nil
+		}
+
+		fragmented = true
+	}
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	// the reserved bits are only used by the extensions, and none of them is negotiated
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits are set", errWebsocketProtocol)
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if length > wsMaxMessage {
+		return false, 0, nil, errWebsocketMessage
+	}
+
+	// the client must mask every frame, so the page can't make the frame look like another protocol to the proxy
+	if !masked {
+		return false, 0, nil, fmt.Errorf("%w: unmasked client frame", errWebsocketProtocol)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (c *wsConn) write(message []byte) error {
+	return c.writeFrame(opText, message)
+}
+
+// writeFrame writes a single unmasked frame, as the server must not mask its frames
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := []byte{0x80 | opcode, 0}
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *wsConn) close() error {
+	return c.conn.Close()
+}
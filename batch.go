@@ -0,0 +1,253 @@
+package rapid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// BatchItem is a url of the batch file with its own options
+	BatchItem struct {
+		Line     int // line number of the url in the batch file
+		URL      string
+		Dir      string      // directory where the file will be placed, instead of the category location
+		Out      string      // name of the file, instead of the name from the server
+		Headers  http.Header // headers which are sent along with the url
+		Checksum string      // expected checksum of the file in the form of algorithm=hex
+		sum      *checksum
+	}
+
+	// BatchError is the line of the batch file which is malformed or can't be fetched
+	BatchError struct {
+		Line int
+		Err  error
+	}
+)
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ParseBatch reads the batch file where every url can be followed by the indented options of it, like the input file of aria2:
+//
+//	https://example.com/file.zip
+//	  out=renamed.zip
+//	  dir=/tmp/downloads
+//	  header=Referer: https://example.com
+//	  checksum=sha-256=e3b0c442...
+//
+// Empty lines and the lines starting with # are ignored, and the duplicated urls are dropped. The valid items are returned
+// along with the errors of the malformed lines, which are joined BatchError
+func ParseBatch(r io.Reader) ([]BatchItem, error) {
+	items := make([]BatchItem, 0)
+	errs := make([]error, 0)
+	seen := make(map[string]bool)
+
+	var current *BatchItem
+	malformed := false
+	flush := func() {
+		if current == nil {
+			return
+		}
+
+		// the same url into the same location is downloaded once, but the same url can be saved under different names
+		key := current.URL + "\x00" + current.Dir + "\x00" + current.Out
+		if !seen[key] {
+			seen[key] = true
+			items = append(items, *current)
+		}
+
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// the option of the url is indented
+		if text[0] == ' ' || text[0] == '\t' {
+			if current == nil {
+				// the options of the malformed url are skipped, as the url is already reported
+				if !malformed {
+					errs = append(errs, &BatchError{Line: line, Err: fmt.Errorf("option without url")})
+				}
+
+				continue
+			}
+
+			if err := current.set(trimmed); err != nil {
+				errs = append(errs, &BatchError{Line: line, Err: err})
+			}
+
+			continue
+		}
+
+		flush()
+
+		// the urls separated by tab are the mirrors in aria2, only the first one is used as every chunk is downloaded from it
+		link, _, _ := strings.Cut(trimmed, "\t")
+		err := validateURL(link)
+		malformed = err != nil
+		if malformed {
+			errs = append(errs, &BatchError{Line: line, Err: err})
+			continue
+		}
+
+		current = &BatchItem{Line: line, URL: link, Headers: http.Header{}}
+	}
+
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return items, errors.Join(errs...)
+}
+
+func validateURL(link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return fmt.Errorf("invalid url %q", link)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid url %q, only http and https are supported", link)
+	}
+
+	return nil
+}
+
+// set parses the option line in the form of key=value
+func (item *BatchItem) set(option string) error {
+	key, value, ok := strings.Cut(option, "=")
+	if !ok {
+		return fmt.Errorf("option %q must be in the form of key=value", option)
+	}
+
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "out":
+		if value == "" || value != filepath.Base(value) {
+			return fmt.Errorf("out %q must be a file name", value)
+		}
+
+		item.Out = value
+	case "dir":
+		item.Dir = value
+	case "header":
+		name, content, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("header %q must be in the form of name: value", value)
+		}
+
+		item.Headers.Add(strings.TrimSpace(name), strings.TrimSpace(content))
+	case "checksum":
+		sum, err := parseChecksum(value)
+		if err != nil {
+			return err
+		}
+
+		item.Checksum = value
+		item.sum = &sum
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+
+	return nil
+}
+
+// Options returns the entry options of the item, which are applied after the given options
+func (item BatchItem) Options(options ...EntryOptions) []EntryOptions {
+	options = append([]EntryOptions{}, options...)
+
+	if len(item.Headers) > 0 {
+		options = append(options, func(o *entryOption) {
+			headers := o.headers.Clone()
+			if headers == nil {
+				headers = http.Header{}
+			}
+
+			for name, values := range item.Headers {
+				headers[name] = values
+			}
+
+			o.headers = headers
+		})
+	}
+
+	if item.sum != nil {
+		options = append(options, SetChecksum(item.sum.algorithm, item.sum.sum))
+	}
+
+	return options
+}
+
+// FetchBatch fetches every item of the batch file. The entries that can be fetched are returned along with the errors of
+// the malformed lines and the urls that can't be fetched
+func FetchBatch(r io.Reader, options ...EntryOptions) ([]Entry, error) {
+	items, err := ParseBatch(r)
+
+	errs := []error{err}
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		entry, err := item.Fetch(options...)
+		if err != nil {
+			errs = append(errs, &BatchError{Line: item.Line, Err: err})
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, errors.Join(errs...)
+}
+
+// Fetch fetches the url of the item and places the entry according to the dir and out options
+func (item BatchItem) Fetch(options ...EntryOptions) (Entry, error) {
+	entry, err := Fetch(item.URL, item.Options(options...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Dir == "" && item.Out == "" {
+		return entry, nil
+	}
+
+	relocator, ok := entry.(EntryRelocator)
+	if !ok {
+		return nil, fmt.Errorf("entry can't be relocated")
+	}
+
+	dir := item.Dir
+	if dir == "" {
+		dir = filepath.Dir(entry.Location())
+	}
+
+	name := item.Out
+	if name == "" {
+		name = entry.Name()
+	}
+
+	relocator.Relocate(safeJoin(dir, name))
+	return entry, nil
+}
@@ -0,0 +1,100 @@
+package rapid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBatch(t *testing.T) {
+	input := strings.Join([]string{
+		"# comment",
+		"https://example.com/a.zip",
+		"  out=renamed.zip",
+		"\theader=Referer: https://example.com",
+		"",
+		"https://example.com/b.zip\thttps://mirror.example.com/b.zip",
+		"  dir=/tmp/downloads",
+		"  checksum=md5=d41d8cd98f00b204e9800998ecf8427e",
+		"https://example.com/a.zip",
+		"  out=renamed.zip",
+		"ftp://example.com/c.zip",
+		"  out=ignored.zip",
+		"https://example.com/d.zip",
+		"  unknown=value",
+		"  checksum=sha-256=abc",
+	}, "\n")
+
+	items, err := ParseBatch(strings.NewReader(input))
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items after dedupe, got %d", len(items))
+	}
+
+	if items[0].Out != "renamed.zip" || items[0].Headers.Get("Referer") != "https://example.com" || items[0].Line != 2 {
+		t.Errorf("Unexpected first item %+v", items[0])
+	}
+
+	if items[1].URL != "https://example.com/b.zip" || items[1].Dir != "/tmp/downloads" || items[1].sum == nil {
+		t.Errorf("Unexpected second item %+v", items[1])
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected batch error, got %v", err)
+	}
+
+	for _, line := range []string{"line 11:", "line 14:", "line 15:"} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("Expected error of %s got %v", line, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), "line 12:") {
+		t.Errorf("Expected the option of malformed url to be skipped, got %v", err)
+	}
+}
+
+func TestParseBatchOptionWithoutURL(t *testing.T) {
+	_, err := ParseBatch(strings.NewReader("  out=file.zip\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 1: option without url") {
+		t.Errorf("Expected option without url error, got %v", err)
+	}
+}
+
+func TestFetchBatchChecksum(t *testing.T) {
+	setting := testSetting(t)
+	content := bytes.Repeat([]byte("rapid"), 1024)
+	server := testServer(t, content)
+
+	dir := t.TempDir()
+	good := sha256.Sum256(content)
+	input := fmt.Sprintf("%s/good.bin\n  out=good.bin\n  dir=%s\n  checksum=sha-256=%x\n%s/bad.bin\n  out=bad.bin\n  checksum=md5=d41d8cd98f00b204e9800998ecf8427e\n",
+		server.URL, dir, good, server.URL)
+
+	entries, err := FetchBatch(strings.NewReader(input), SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching batch:", err.Error())
+	}
+
+	if entries[0].Location() != filepath.Join(dir, "good.bin") {
+		t.Errorf("Expected the entry to be relocated, got %s", entries[0].Location())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Download(entries[0]); err != nil {
+		t.Error("Expected matching checksum to succeed, got", err)
+	}
+
+	if err := downloader.Download(entries[1]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected %v, got %v", ErrChecksumMismatch, err)
+	}
+
+	if _, err := os.Stat(entries[0].Location()); err != nil {
+		t.Error("Expected the file to be downloaded:", err)
+	}
+}
@@ -0,0 +1,63 @@
+package rapid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+var ErrChecksumMismatch = fmt.Errorf("checksum of the downloaded file does not match")
+
+// SetChecksum sets the expected checksum of the file, e.g SetChecksum("sha-256", sum). The downloaded file is verified against it
+func SetChecksum(algorithm string, sum []byte) EntryOptions {
+	return func(o *entryOption) {
+		o.sum = &checksum{algorithm: strings.ToLower(algorithm), sum: sum}
+	}
+}
+
+// parseChecksum parses the checksum in the form of "algorithm=hex", e.g sha-256=e3b0c442...
+func parseChecksum(value string) (checksum, error) {
+	algorithm, digest, ok := strings.Cut(value, "=")
+	if !ok {
+		return checksum{}, fmt.Errorf("checksum %q must be in the form of algorithm=hex", value)
+	}
+
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+	if algorithm == "sha256" {
+		algorithm = "sha-256"
+	}
+
+	size := map[string]int{"md5": 16, "sha-256": 32}[algorithm]
+	if size == 0 {
+		return checksum{}, fmt.Errorf("checksum %s is not supported", algorithm)
+	}
+
+	sum, err := hex.DecodeString(strings.TrimSpace(digest))
+	if err != nil || len(sum) != size {
+		return checksum{}, fmt.Errorf("checksum %q is not a valid %s", digest, algorithm)
+	}
+
+	return checksum{algorithm: algorithm, sum: sum}, nil
+}
+
+// verifyChecksum checks the file in the location against the checksum which is given by the user. The checksum that is announced
+// by the server is not verified, as it is not always reliable, e.g the ETag that looks like md5
+func verifyChecksum(entry Entry, location string) error {
+	e, ok := entry.(interface{ verifyChecksum() bool })
+	if !ok || !e.verifyChecksum() {
+		return nil
+	}
+
+	sum := entryChecksum(entry)
+	local, err := fileChecksum(location, sum.algorithm)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(local, sum.sum) {
+		return fmt.Errorf("%w: expected %s %x, got %x", ErrChecksumMismatch, sum.algorithm, sum.sum, local)
+	}
+
+	return nil
+}
@@ -2,19 +2,23 @@ package rapid
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
+	"strconv"
 	"time"
 )
 
 type progressBar struct {
 	Entry
+	ctx        context.Context
 	onprogress OnProgress
+	limiter    *rateLimiter
 	reader     io.ReadCloser
+	host       string
 	index      int
 	downloaded int64
 	progress   float64
@@ -23,12 +27,20 @@ type progressBar struct {
 
 func (r *progressBar) Read(payload []byte) (n int, err error) {
 	n, err = r.reader.Read(payload)
-	if err != nil {
+	if n == 0 {
 		return n, err
 	}
 
 	r.downloaded += int64(n)
-	r.progress = float64(100 * r.downloaded / r.chunkSize)
+	metrics.downloadedBytes.add(int64(n))
+	metrics.hostBytes.add(r.host, int64(n))
+	if r.chunkSize > 0 {
+		r.progress = float64(100*r.downloaded) / float64(r.chunkSize)
+	}
+
+	if e := r.limiter.wait(r.ctx, n); e != nil {
+		return n, e
+	}
 
 	if r.onprogress != nil {
 		r.onprogress(
@@ -49,27 +61,59 @@ func (r *progressBar) Close() error {
 type chunk struct {
 	entry      Entry
 	setting    Setting
-	wg         *sync.WaitGroup
 	path       string
+	host       string
 	index      int
+	begin      int64 // the first byte of the chunk, while start is where the download continues from
 	start      int64
 	end        int64
 	size       int64
 	logger     Logger
 	onprogress OnProgress
+	limiter    *rateLimiter
+	ranges     *chunkRanges // shared by the chunks of the entry, nil if the range can't be merged
+	err        error        // the error that is left once the retries give up
 }
 
+// calculatePosition returns the first and the last byte of the chunk, both inclusive like the range of the request
 func calculatePosition(entry Entry, chunkSize int64, index int) (int64, int64) {
-	start := int64(index * int(chunkSize))
+	start := int64(index) * chunkSize
 	end := start + (chunkSize - 1)
 
 	if index == int(entry.ChunkLen())-1 {
-		end = entry.Size()
+		end = entry.Size() - 1
 	}
 
 	return start, end
 }
 
+// chunkLength returns how many bytes the chunk has. The last chunk may be longer as it takes the remainder of the entry
+func chunkLength(entry Entry, start int64, end int64) int64 {
+	if end >= entry.Size() {
+		return entry.Size() - start
+	}
+
+	return end - start + 1
+}
+
+// chunkBounds returns the first byte and the length of the chunk
+func chunkBounds(entry Entry, index int) (int64, int64) {
+	chunkSize := entry.Size() / int64(entry.ChunkLen())
+	start, end := calculatePosition(entry, chunkSize, index)
+
+	return start, chunkLength(entry, start, end)
+}
+
+// chunkDir returns the directory where the chunks of the entry are stored until they are combined
+func chunkDir(setting Setting, id string) string {
+	return filepath.Join(setting.TempLocation(), id)
+}
+
+// chunkPath returns the location of the temporary file of a chunk
+func chunkPath(setting Setting, id string, index int) string {
+	return filepath.Join(chunkDir(setting, id), strconv.Itoa(index))
+}
+
 // TODO: test this
 func resumePosition(location string) int64 {
 	file, err := os.Stat(location)
@@ -85,85 +129,195 @@ func resumePosition(location string) int64 {
 	return resumePos
 }
 
-func newChunk(entry Entry, index int, setting Setting, wg *sync.WaitGroup) *chunk {
+func newChunk(entry Entry, index int, setting Setting) *chunk {
 	chunkSize := entry.Size() / int64(entry.ChunkLen())
 	start, end := calculatePosition(entry, chunkSize, index)
 
-	logger := NewLogger(setting)
+	logger := NewLogger(setting).With("entry", entry.ID(), "chunk", index)
 
 	return &chunk{
-		path:       filepath.Join(setting.DownloadLocation(), fmt.Sprintf("%s-%d", entry.ID(), index)),
+		path:       chunkPath(setting, entry.ID(), index),
+		host:       hostOf(entry.URL()),
 		entry:      entry,
 		setting:    setting,
-		wg:         wg,
 		index:      index,
+		begin:      start,
 		start:      start,
 		end:        end,
-		size:       chunkSize,
+		size:       chunkLength(entry, start, end),
 		logger:     logger,
 		onprogress: nil,
 	}
 }
 
 func (c *chunk) download(ctx context.Context) error {
-	c.logger.Print("Downloading chunk", c.index, "from", c.start, "to", c.end, fmt.Sprintf("(~%d MB)", (c.end-c.start)/(1024*1024)))
+	c.logger.Debug("Downloading chunk", "start", c.start, "end", c.end, "size", c.end-c.start+1)
 
-	defer c.wg.Done()
 	start := time.Now()
 
-	if c.start >= c.end {
+	// the end is inclusive, so the chunk with a single byte left still has it to download
+	if c.start > c.end {
 		return nil
 	}
 
-	srcFile, err := c.getDownloadFile(ctx)
+	release, err := acquireHost(ctx, c.host, c.setting)
 	if err != nil {
-		c.logger.Print("Error fetching chunk file:", err.Error())
 		return err
 	}
+	defer release()
+
+	srcFile, err := c.getDownloadFile(ctx)
+	if err != nil {
+		c.logger.Error("Error fetching chunk file", "url", c.entry.URL(), "error", err)
+		return c.throttled(err)
+	}
 	defer srcFile.Close()
 
 	dstFile, err := c.getSaveFile()
 	if err != nil {
-		c.logger.Print("Error creating temp file for chunk:", err.Error())
+		c.logger.Error("Error creating temp file for chunk", "location", c.path, "error", err)
 		return err
 	}
 	defer dstFile.Close()
 
 	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		c.logger.Print("Error downloading chunk:", err.Error())
-		return err
+		c.logger.Error("Error downloading chunk", "url", c.entry.URL(), "error", err)
+		return c.throttled(connectionThrottle(err))
 	}
 
+	connections.succeed(c.host, c.setting)
 	elapsed := time.Since(start)
-	c.logger.Print("Chunk", c.index, "downloaded in", elapsed.Seconds(), "s")
+	c.logger.Debug("Chunk downloaded", "elapsed", elapsed.Seconds())
 
 	return nil
 }
 
 func (c *chunk) Execute(ctx context.Context) error {
-	return c.download(ctx)
+	c.ranges.start()
+	if err := c.download(ctx); err != nil {
+		return err
+	}
+
+	return c.continueMerged(ctx)
 }
 
 func (c *chunk) OnError(ctx context.Context, err error) {
-	if c.entry.Context().Err() != nil {
+	err = c.retry(ctx, err)
+	if errors.Is(err, errMerged) {
+		return
+	}
+
+	if err != nil {
+		c.ranges.stop()
+		c.err = err
 		return
 	}
 
-	var e error
-	for i := 0; i < c.setting.MaxRetry(); i++ {
-		c.wg.Add(1)
-		c.logger.Print("Error downloading file:", err.Error(), ". Retrying...")
+	c.err = c.continueMerged(ctx)
+}
+
+// Err returns the error of the chunk once it is failed, so the worker reports it instead of the first one
+func (c *chunk) Err() error {
+	return c.err
+}
+
+// continueMerged downloads the ranges of the throttled chunks which are merged into this one, with the connection of
+// this chunk once its own range is done
+func (c *chunk) continueMerged(ctx context.Context) error {
+	for next := c.ranges.next(); next != nil; next = c.ranges.next() {
+		c.logger.Debug("Continuing merged range", "merged", next.index)
+		if next.entry.Resumable() {
+			next.resume()
+		}
+
+		err := next.download(ctx)
+		if err != nil {
+			err = next.retry(ctx, err)
+		}
+
+		// the merged range is throttled again, so it is merged into another chunk which has its connection
+		if errors.Is(err, errMerged) {
+			return nil
+		}
+
+		if err != nil {
+			c.ranges.stop()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retry downloads the chunk again after it is failed. The throttled chunk merges its range into another chunk instead
+// of waiting for the host, unless it is the only one left with a connection
+func (c *chunk) retry(ctx context.Context, err error) error {
+	if c.entry.Context().Err() != nil {
+		return err
+	}
+
+	// the throttled chunk waits for its turn with the fewer connections, so it doesn't count as a retry
+	e := err
+	retries, throttled := 0, 0
+	for {
+		throttle := errors.Is(e, ErrThrottled)
+		if throttle {
+			if c.ranges.handover(c) {
+				metrics.mergedRanges.add(c.host, 1)
+				c.logger.Info("Chunk is throttled by the host, merging its range into another chunk", "error", e)
+				return errMerged
+			}
+
+			throttled++
+			if throttled > maxThrottled {
+				break
+			}
+		} else {
+			if retries >= c.setting.MaxRetry() {
+				break
+			}
+
+			retries++
+			metrics.retries.add(1)
+			c.logger.Warn("Error downloading chunk, retrying", "attempt", retries, "error", e)
+		}
+
+		if throttle {
+			delay := throttleDelay(e, throttled)
+			c.logger.Warn("Chunk is throttled by the host, waiting", "attempt", throttled, "delay", delay, "error", e)
+			if err := sleep(ctx, delay); err != nil {
+				e = err
+				break
+			}
+		}
 
 		if c.entry.Resumable() {
-			c.start += resumePosition(c.path)
+			c.resume()
 		}
 
 		if e = c.download(ctx); e == nil {
-			return
+			return nil
 		}
 	}
 
-	c.logger.Print("Failed downloading file:", err.Error())
+	c.logger.Error("Failed downloading chunk", "url", c.entry.URL(), "error", e)
+	return e
+}
+
+// throttled lowers the connections to the host when the host refuses them, while the connection of the chunk is still
+// counted, and returns the error as it is
+func (c *chunk) throttled(err error) error {
+	if errors.Is(err, ErrThrottled) {
+		limit := connections.throttle(c.host)
+		c.logger.Warn("Host is throttling, lowering the connections", "host", c.host, "limit", limit)
+	}
+
+	return err
+}
+
+// resume continues the chunk from what is already saved in its file
+func (c *chunk) resume() {
+	c.start = c.begin + resumePosition(c.path)
 }
 
 func (c *chunk) onProgress(onprogress OnProgress) {
@@ -173,31 +327,35 @@ func (c *chunk) onProgress(onprogress OnProgress) {
 func (c *chunk) getDownloadFile(ctx context.Context) (io.ReadCloser, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", c.entry.URL(), nil)
 	if err != nil {
-		c.logger.Print("Error creating chunk request:", err.Error())
+		c.logger.Error("Error creating chunk request", "url", c.entry.URL(), "error", err)
 		return nil, err
 	}
 
 	bytesRange := fmt.Sprintf("bytes=%d-%d", c.start, c.end)
 	req.Header.Add("Range", bytesRange)
 
-	if entryCookie, ok := c.entry.(EntryCookies); ok && len(entryCookie.Cookies()) > 0 {
-		for _, cookie := range entryCookie.Cookies() {
-			req.AddCookie(cookie)
-		}
-	}
+	prepareRequest(req, c.entry)
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		c.logger.Print("Error fething chunk body:", err.Error())
+		c.logger.Error("Error fetching chunk body", "url", c.entry.URL(), "error", err)
+		return nil, connectionThrottle(err)
+	}
+
+	if err := responseThrottle(res); err != nil {
+		res.Body.Close()
 		return nil, err
 	}
 
 	progressBar := &progressBar{
+		ctx:        ctx,
 		onprogress: c.onprogress,
+		limiter:    c.limiter,
 		reader:     res.Body,
+		host:       c.host,
 		Entry:      c.entry,
 		index:      c.index,
-		downloaded: 0,
+		downloaded: c.start - c.begin,
 		progress:   0,
 		chunkSize:  c.size,
 	}
@@ -206,10 +364,9 @@ func (c *chunk) getDownloadFile(ctx context.Context) (io.ReadCloser, error) {
 }
 
 func (c *chunk) getSaveFile() (io.WriteCloser, error) {
-	tmpFilename := filepath.Join(c.setting.DownloadLocation(), fmt.Sprintf("%s-%d", c.entry.ID(), c.index))
-	file, err := os.OpenFile(tmpFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		c.logger.Print("Error creating or appending file:", err.Error())
+		c.logger.Error("Error creating or appending file", "location", c.path, "error", err)
 		return nil, err
 	}
 
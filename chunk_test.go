@@ -22,7 +22,7 @@ func TestChunkRangeOneChunkLen(t *testing.T) {
 		t.Errorf("Start range expected to be 0, but got %d", start)
 	}
 
-	if end != entry.Size() {
-		t.Errorf("Start range expected to be 0, but got %d", start)
+	if end != entry.Size()-1 {
+		t.Errorf("End range expected to be %d, but got %d", entry.Size()-1, end)
 	}
 }
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+// transferFunc is the action of the downloader that is performed to the entry, e.g Download, Resume, or Restart
+type transferFunc func(dl rapid.Downloader, entry rapid.Entry) error
+
+// parseFlags parses the flags and prints the usage on invalid flags
+func parseFlags(fs *flag.FlagSet, args []string, minArgs int) (bool, int) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return false, exitOK
+		}
+
+		return false, exitUsage
+	}
+
+	if fs.NArg() < minArgs {
+		fmt.Fprintf(os.Stderr, "rapid %s: missing argument\n", fs.Name())
+		fs.Usage()
+		return false, exitUsage
+	}
+
+	return true, exitOK
+}
+
+func runGet(args []string) int {
+	opt := &options{}
+	fs := newFlagSet("get", opt, true)
+	inputFile := fs.String("i", "", `file of the urls with their options, "-" to read from stdin`)
+	fs.StringVar(inputFile, "input-file", "", `file of the urls with their options, "-" to read from stdin`)
+	if ok, code := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+
+	if fs.NArg() == 0 && *inputFile == "" {
+		fmt.Fprintln(os.Stderr, "rapid get: missing argument")
+		fs.Usage()
+		return exitUsage
+	}
+
+	setting, err := opt.setting()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid get: %v\n", err)
+		return exitUsage
+	}
+
+	entryOptions, err := opt.entryOptions(setting)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid get: %v\n", err)
+		return exitUsage
+	}
+
+	store := rapid.NewStore(rapid.StoreFile, setting)
+
+	code := exitOK
+	entries := make([]rapid.Entry, 0, fs.NArg())
+	for _, url := range fs.Args() {
+		entry, err := rapid.Fetch(url, entryOptions...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rapid get: %s: %v\n", url, err)
+			code = exitFetch
+			continue
+		}
+
+		if err := store.Save(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "rapid get: saving %s: %v\n", entry.ID(), err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if *inputFile != "" {
+		batch, batchCode := fetchBatch(*inputFile, entryOptions)
+		for _, entry := range batch {
+			if err := store.Save(entry); err != nil {
+				fmt.Fprintf(os.Stderr, "rapid get: saving %s: %v\n", entry.ID(), err)
+			}
+		}
+
+		entries = append(entries, batch...)
+		code = worse(code, batchCode)
+	}
+
+	return worse(code, transfer(opt, setting, store, entries, rapid.Downloader.Download))
+}
+
+// fetchBatch fetches the entries of the input file. Every malformed line is reported, while the valid ones are still downloaded
+func fetchBatch(name string, entryOptions []rapid.EntryOptions) ([]rapid.Entry, int) {
+	input := os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rapid get: %v\n", err)
+			return nil, exitUsage
+		}
+		defer file.Close()
+
+		input = file
+	}
+
+	entries, err := rapid.FetchBatch(input, entryOptions...)
+	if err == nil {
+		return entries, exitOK
+	}
+
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(os.Stderr, "rapid get: %s: %s\n", name, line)
+	}
+
+	return entries, exitFetch
+}
+
+func runResume(args []string) int {
+	return runStored("resume", args, rapid.Downloader.Resume)
+}
+
+func runRestart(args []string) int {
+	return runStored("restart", args, rapid.Downloader.Restart)
+}
+
+// runStored continues the entries that are saved by the previous command
+func runStored(name string, args []string, fn transferFunc) int {
+	opt := &options{}
+	fs := newFlagSet(name, opt, true)
+	if ok, code := parseFlags(fs, args, 1); !ok {
+		return code
+	}
+
+	setting, err := opt.setting()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid %s: %v\n", name, err)
+		return exitUsage
+	}
+
+	store := rapid.NewStore(rapid.StoreFile, setting)
+
+	code := exitOK
+	entries := make([]rapid.Entry, 0, fs.NArg())
+	for _, id := range fs.Args() {
+		entry, err := store.Get(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rapid %s: %s: %v\n", name, id, err)
+			code = worse(code, exitCode(err))
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return worse(code, transfer(opt, setting, store, entries, fn))
+}
+
+// transfer runs fn to the entries concurrently until all of them are done or the user interrupts it
+func transfer(opt *options, setting rapid.Setting, store rapid.Store, entries []rapid.Entry, fn transferFunc) int {
+	if len(entries) == 0 {
+		return exitOK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	downloader := rapid.NewDownloader(rapid.DownloaderDefault, rapid.SetDownloaderSetting(setting))
+	if closer, ok := downloader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	var bars *progress
+	if watcher, ok := downloader.(rapid.Watcher); ok && !opt.noProgress {
+		bars = newProgress(os.Stderr, opt.chunkBars)
+		for _, entry := range entries {
+			bars.add(entry)
+		}
+
+		watcher.Watch(bars.update)
+		bars.start()
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, entry := range entries {
+			downloader.Stop(entry)
+		}
+	}()
+
+	concurrent := setting.MaxActiveEntries()
+	if concurrent < 1 {
+		concurrent = 1
+	}
+
+	sem := make(chan struct{}, concurrent)
+	views := make([]view, len(entries))
+
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry rapid.Entry) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := fn(downloader, entry)
+
+			// the location may be renamed during the download, so the latest one is saved
+			if e := store.Save(entry); e != nil {
+				fmt.Fprintf(os.Stderr, "rapid: saving %s: %v\n", entry.ID(), e)
+			}
+
+			status := transferStatus(entry, err)
+			if bars != nil {
+				bars.finish(entry, status)
+			}
+
+			views[i] = newView(entry, status, err)
+		}(i, entry)
+	}
+
+	wg.Wait()
+	if bars != nil {
+		bars.stop()
+	}
+
+	printResults(os.Stdout, views, opt.json)
+
+	code := exitOK
+	for _, v := range views {
+		switch v.Status {
+		case statusInterrupted:
+			code = worse(code, exitInterrupted)
+		case statusFailed:
+			code = worse(code, exitFailure)
+		}
+	}
+
+	return code
+}
+
+func transferStatus(entry rapid.Entry, err error) string {
+	switch {
+	case errors.Is(err, rapid.ErrPaused), errors.Is(err, rapid.ErrCancelled), entry.Context().Err() != nil:
+		return statusInterrupted
+	case err != nil:
+		return statusFailed
+	}
+
+	return statusCompleted
+}
+
+func runList(args []string) int {
+	opt := &options{}
+	fs := newFlagSet("list", opt, false)
+	if ok, code := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+
+	setting, err := opt.setting()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid list: %v\n", err)
+		return exitUsage
+	}
+
+	store := rapid.NewStore(rapid.StoreFile, setting)
+	entries, err := store.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid list: %v\n", err)
+		return exitFailure
+	}
+
+	views := make([]view, 0, len(entries))
+	for _, entry := range entries {
+		views = append(views, newView(entry, entryStatus(entry), nil))
+	}
+
+	printList(os.Stdout, views, opt.json)
+	return exitOK
+}
+
+func runRemove(args []string) int {
+	opt := &options{}
+	fs := newFlagSet("remove", opt, false)
+	deleteFile := fs.Bool("delete-file", false, "delete the downloaded file as well")
+	if ok, code := parseFlags(fs, args, 1); !ok {
+		return code
+	}
+
+	setting, err := opt.setting()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid remove: %v\n", err)
+		return exitUsage
+	}
+
+	store := rapid.NewStore(rapid.StoreFile, setting)
+
+	code := exitOK
+	for _, id := range fs.Args() {
+		entry, err := store.Get(id)
+		if err == nil {
+			err = store.Delete(id)
+		}
+
+		// the chunks of the entry which is never completed are useless once it is removed
+		if err == nil {
+			err = os.RemoveAll(filepath.Join(setting.TempLocation(), entry.ID()))
+		}
+
+		if err == nil && *deleteFile {
+			if e := os.Remove(entry.Location()); e != nil && !os.IsNotExist(e) {
+				err = e
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rapid remove: %s: %v\n", id, err)
+			code = worse(code, exitCode(err))
+		}
+	}
+
+	return code
+}
+
+func runInfo(args []string) int {
+	opt := &options{}
+	fs := newFlagSet("info", opt, true)
+	if ok, code := parseFlags(fs, args, 1); !ok {
+		return code
+	}
+
+	setting, err := opt.setting()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid info: %v\n", err)
+		return exitUsage
+	}
+
+	entryOptions, err := opt.entryOptions(setting)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid info: %v\n", err)
+		return exitUsage
+	}
+
+	entry, err := rapid.Fetch(fs.Arg(0), entryOptions...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid info: %v\n", err)
+		return exitFetch
+	}
+
+	printInfo(os.Stdout, newView(entry, "", nil), opt.json)
+	return exitOK
+}
+
+func exitCode(err error) int {
+	if errors.Is(err, rapid.ErrEntryNotFound) {
+		return exitNotFound
+	}
+
+	return exitFailure
+}
+
+// worse returns the exit code that should be reported when both of the codes happen
+func worse(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,73 @@
+// Command rapid downloads files with multiple connections and lets them be resumed later
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK          = 0
+	exitFailure     = 1 // the download is failed
+	exitUsage       = 2 // the command or its flags are invalid
+	exitFetch       = 3 // the url can't be fetched
+	exitNotFound    = 4 // the entry is not found
+	exitInterrupted = 130
+)
+
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{"get", "<url...>", "download the urls", runGet},
+	{"resume", "<id>", "resume the stopped download", runResume},
+	{"restart", "<id>", "restart the download from the beginning", runRestart},
+	{"list", "", "list the downloads", runList},
+	{"remove", "<id>", "remove the download from the list", runRemove},
+	{"info", "<url>", "show the information of the url without downloading it", runInfo},
+	{"serve", "", "serve the aria2 compatible json-rpc and the http api", runServe},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: rapid <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %-9s %s\n", cmd.name, cmd.args, cmd.usage)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "rapid <command> -h" to see the flags of a command`)
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "rapid: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+
+	return exitUsage
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+type (
+	// listFlag is a flag that can be passed multiple times
+	listFlag []string
+
+	// sizeFlag is a flag of size in bytes which accepts unit, e.g 512K, 5M, or 1G
+	sizeFlag int64
+
+	options struct {
+		dir          string
+		minChunkSize sizeFlag
+		maxRetry     int
+		headers      listFlag
+		cookies      listFlag
+		rateLimit    sizeFlag
+		concurrent   int
+		noProgress   bool
+		chunkBars    bool
+		json         bool
+		verbose      bool
+	}
+
+	// cliSetting overrides the default setting with the flags
+	cliSetting struct {
+		rapid.Setting
+		opt *options
+	}
+)
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (f *sizeFlag) String() string {
+	return strconv.FormatInt(int64(*f), 10)
+}
+
+func (f *sizeFlag) Set(value string) error {
+	size, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+
+	*f = sizeFlag(size)
+	return nil
+}
+
+// parseSize parses the size with optional binary unit, e.g 512K, 5M, 1G, or 1GiB
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "IB"), "B")
+
+	multiplier := int64(1)
+	if len(value) > 0 {
+		switch value[len(value)-1] {
+		case 'K':
+			multiplier = 1024
+		case 'M':
+			multiplier = 1024 * 1024
+		case 'G':
+			multiplier = 1024 * 1024 * 1024
+		}
+	}
+
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return int64(number * float64(multiplier)), nil
+}
+
+// newFlagSet creates the flags of a command. The download flags are only added for the command that downloads something
+func newFlagSet(name string, opt *options, download bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&opt.json, "json", false, "print the result as json")
+	fs.BoolVar(&opt.verbose, "v", false, "print the debug logs")
+
+	if !download {
+		return fs
+	}
+
+	fs.StringVar(&opt.dir, "o", "", "output directory (default ~/Downloads)")
+	fs.StringVar(&opt.dir, "dir", "", "output directory (default ~/Downloads)")
+	fs.Var(&opt.minChunkSize, "min-chunk-size", "minimum size of a chunk, e.g 5M")
+	fs.IntVar(&opt.maxRetry, "max-retry", -1, "maximum retry of a failed chunk")
+	fs.Var(&opt.headers, "H", `header of the request, e.g "Referer: https://example.com". Can be repeated`)
+	fs.Var(&opt.headers, "header", `header of the request, e.g "Referer: https://example.com". Can be repeated`)
+	fs.Var(&opt.cookies, "cookie", `cookie of the request, e.g "session=abc". Can be repeated`)
+	fs.Var(&opt.rateLimit, "limit-rate", "maximum download speed per second, e.g 500K")
+	fs.IntVar(&opt.concurrent, "concurrent", 0, "maximum entries that are downloaded at the same time (default from the setting)")
+	fs.BoolVar(&opt.noProgress, "no-progress", false, "don't show the progress")
+	fs.BoolVar(&opt.chunkBars, "chunks", false, "show the progress of every chunk")
+
+	return fs
+}
+
+// setting loads the setting file and the environment variables, then overrides them with the flags
+func (o *options) setting() (rapid.Setting, error) {
+	setting, err := rapid.LoadSetting()
+	if err != nil {
+		return nil, err
+	}
+
+	return o.override(setting), nil
+}
+
+// override returns the setting whose values are overridden by the flags which are set
+func (o *options) override(setting rapid.Setting) rapid.Setting {
+	return &cliSetting{
+		Setting: setting,
+		opt:     o,
+	}
+}
+
+// Subscribe passes the changes of the underlying setting, so the values which aren't overridden can be changed at runtime
+func (s *cliSetting) Subscribe(fn func()) func() {
+	if notifier, ok := s.Setting.(rapid.SettingNotifier); ok {
+		return notifier.Subscribe(fn)
+	}
+
+	return func() {}
+}
+
+func (s *cliSetting) DownloadLocation() string {
+	if s.opt.dir != "" {
+		return s.opt.dir
+	}
+
+	return s.Setting.DownloadLocation()
+}
+
+func (s *cliSetting) CategoryLocation(filetype string) string {
+	if s.opt.dir != "" {
+		return s.opt.dir
+	}
+
+	return s.Setting.CategoryLocation(filetype)
+}
+
+func (s *cliSetting) MinChunkSize() int64 {
+	if s.opt.minChunkSize > 0 {
+		return int64(s.opt.minChunkSize)
+	}
+
+	return s.Setting.MinChunkSize()
+}
+
+func (s *cliSetting) MaxRetry() int {
+	if s.opt.maxRetry >= 0 {
+		return s.opt.maxRetry
+	}
+
+	return s.Setting.MaxRetry()
+}
+
+func (s *cliSetting) RateLimit() int64 {
+	if s.opt.rateLimit > 0 {
+		return int64(s.opt.rateLimit)
+	}
+
+	return s.Setting.RateLimit()
+}
+
+func (s *cliSetting) MaxActiveEntries() int {
+	if s.opt.concurrent > 0 {
+		return s.opt.concurrent
+	}
+
+	return s.Setting.MaxActiveEntries()
+}
+
+func (s *cliSetting) LogLevel() rapid.Level {
+	if s.opt.verbose {
+		return rapid.LevelDebug
+	}
+
+	// the result is already printed by the cli, so only the problems are logged
+	return rapid.LevelWarn
+}
+
+// entryOptions creates the options of the entry from the headers and cookies flags
+func (o *options) entryOptions(setting rapid.Setting) ([]rapid.EntryOptions, error) {
+	headers := http.Header{}
+	for _, header := range o.headers {
+		key, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+
+		headers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	cookies := make([]*http.Cookie, 0, len(o.cookies))
+	for _, cookie := range o.cookies {
+		// let the request parse the cookie header, as it's the same format
+		req := &http.Request{Header: http.Header{"Cookie": {cookie}}}
+		parsed := req.Cookies()
+		if len(parsed) == 0 {
+			return nil, fmt.Errorf("invalid cookie %q", cookie)
+		}
+
+		cookies = append(cookies, parsed...)
+	}
+
+	return []rapid.EntryOptions{
+		rapid.SetEntrySetting(setting),
+		rapid.AddHeaders(headers),
+		rapid.AddCookies(cookies),
+	}, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"100":   100,
+		"512K":  512 * 1024,
+		"1.5M":  3 * 1024 * 1024 / 2,
+		"2GiB":  2 * 1024 * 1024 * 1024,
+		"10kb":  10 * 1024,
+		" 1m  ": 1024 * 1024,
+	}
+
+	for value, expected := range cases {
+		size, err := parseSize(value)
+		if err != nil {
+			t.Errorf("Error parsing %q: %v", value, err)
+			continue
+		}
+
+		if size != expected {
+			t.Errorf("Expected %q to be %d, got %d", value, expected, size)
+		}
+	}
+
+	for _, value := range []string{"", "M", "-1K", "abc"} {
+		if _, err := parseSize(value); err == nil {
+			t.Errorf("Expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestFlagsOverrideSetting(t *testing.T) {
+	base, err := rapid.NewSettingBuilder().DataLocation(t.TempDir()).DownloadLocation("/tmp/downloads").MaxRetry(3).Build()
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	type expected struct {
+		location     string
+		minChunkSize int64
+		maxRetry     int
+		rateLimit    int64
+		concurrent   int
+		level        rapid.Level
+	}
+
+	defaults := expected{
+		location:     "/tmp/downloads",
+		minChunkSize: base.MinChunkSize(),
+		maxRetry:     3,
+		rateLimit:    base.RateLimit(),
+		concurrent:   base.MaxActiveEntries(),
+		level:        rapid.LevelWarn,
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected func(e *expected)
+	}{
+		{"defaults", nil, func(e *expected) {}},
+		{"short dir", []string{"-o", "/tmp/short"}, func(e *expected) { e.location = "/tmp/short" }},
+		{"long dir", []string{"--dir", "/tmp/long"}, func(e *expected) { e.location = "/tmp/long" }},
+		{"min chunk size", []string{"-min-chunk-size", "1M"}, func(e *expected) { e.minChunkSize = 1024 * 1024 }},
+		{"max retry", []string{"-max-retry", "7"}, func(e *expected) { e.maxRetry = 7 }},
+		{"no retry", []string{"-max-retry", "0"}, func(e *expected) { e.maxRetry = 0 }},
+		{"rate limit", []string{"-limit-rate", "500K"}, func(e *expected) { e.rateLimit = 500 * 1024 }},
+		{"concurrent", []string{"-concurrent", "2"}, func(e *expected) { e.concurrent = 2 }},
+		{"verbose", []string{"-v"}, func(e *expected) { e.level = rapid.LevelDebug }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opt := &options{}
+			if err := newFlagSet("get", opt, true).Parse(tc.args); err != nil {
+				t.Fatal("Error parsing flags:", err.Error())
+			}
+
+			want := defaults
+			tc.expected(&want)
+
+			setting := opt.override(base)
+			got := expected{
+				location:     setting.DownloadLocation(),
+				minChunkSize: setting.MinChunkSize(),
+				maxRetry:     setting.MaxRetry(),
+				rateLimit:    setting.RateLimit(),
+				concurrent:   setting.MaxActiveEntries(),
+				level:        setting.LogLevel(),
+			}
+
+			if got != want {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+
+			if location := setting.CategoryLocation("Video"); location != want.location {
+				t.Errorf("Expected the category location to follow the dir, got %s", location)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"-limit-rate", "fast"}, {"-max-retry", "many"}, {"-unknown"}} {
+		if err := newFlagSet("get", &options{}, true).Parse(args); err == nil {
+			t.Errorf("Expected %v to be invalid", args)
+		}
+	}
+}
+
+func TestEntryOptionsFlags(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader("rapid"))
+	}))
+	defer server.Close()
+
+	setting, err := rapid.NewSettingBuilder().DataLocation(t.TempDir()).DownloadLocation(t.TempDir()).Build()
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	opt := &options{}
+	args := []string{"-H", "Referer: https://example.com", "--header", "X-Token:abc", "-cookie", "session=abc; theme=dark"}
+	if err := newFlagSet("get", opt, true).Parse(args); err != nil {
+		t.Fatal("Error parsing flags:", err.Error())
+	}
+
+	entryOptions, err := opt.entryOptions(setting)
+	if err != nil {
+		t.Fatal("Error creating entry options:", err.Error())
+	}
+
+	if _, err := rapid.Fetch(server.URL+"/file.bin", entryOptions...); err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	if received.Header.Get("Referer") != "https://example.com" || received.Header.Get("X-Token") != "abc" {
+		t.Errorf("Expected the headers to be sent, got %v", received.Header)
+	}
+
+	if cookie, err := received.Cookie("theme"); err != nil || cookie.Value != "dark" {
+		t.Errorf("Expected the cookies to be sent, got %v", received.Cookies())
+	}
+
+	for _, invalid := range []*options{{headers: listFlag{"Referer"}}, {cookies: listFlag{""}}} {
+		if _, err := invalid.entryOptions(setting); err == nil {
+			t.Errorf("Expected %+v to be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+const (
+	statusCompleted   = "completed"
+	statusIncomplete  = "incomplete"
+	statusFailed      = "failed"
+	statusInterrupted = "interrupted"
+)
+
+// view is the representation of an entry that is printed by the commands
+type view struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Location  string `json:"location"`
+	Size      int64  `json:"size"`
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	ChunkLen  int    `json:"chunkLen"`
+	Resumable bool   `json:"resumable"`
+	Status    string `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func newView(entry rapid.Entry, status string, err error) view {
+	v := view{
+		ID:        entry.ID(),
+		Name:      entry.Name(),
+		Location:  entry.Location(),
+		Size:      entry.Size(),
+		Type:      entry.Type(),
+		URL:       entry.URL(),
+		ChunkLen:  entry.ChunkLen(),
+		Resumable: entry.Resumable(),
+		Status:    status,
+	}
+
+	if err != nil {
+		v.Error = err.Error()
+	}
+
+	return v
+}
+
+// entryStatus tells whether the file of the entry is already fully downloaded
+func entryStatus(entry rapid.Entry) string {
+	stat, err := os.Stat(entry.Location())
+	if err != nil {
+		return statusIncomplete
+	}
+
+	if entry.Size() > 0 && stat.Size() != entry.Size() {
+		return statusIncomplete
+	}
+
+	return statusCompleted
+}
+
+func printJSON(w io.Writer, value interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+func printResults(w io.Writer, views []view, asJSON bool) {
+	if asJSON {
+		printJSON(w, views)
+		return
+	}
+
+	for _, v := range views {
+		switch v.Status {
+		case statusCompleted:
+			fmt.Fprintf(w, "%s  %s -> %s\n", v.ID, v.Name, v.Location)
+		case statusInterrupted:
+			fmt.Fprintf(w, "%s  %s stopped, run \"rapid resume %s\" to continue\n", v.ID, v.Name, v.ID)
+		default:
+			fmt.Fprintf(w, "%s  %s %s: %s\n", v.ID, v.Name, v.Status, v.Error)
+		}
+	}
+}
+
+func printList(w io.Writer, views []view, asJSON bool) {
+	if asJSON {
+		printJSON(w, views)
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSIZE\tSTATUS\tLOCATION")
+	for _, v := range views {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", v.ID, v.Name, formatSize(v.Size), v.Status, v.Location)
+	}
+
+	tw.Flush()
+}
+
+func printInfo(w io.Writer, v view, asJSON bool) {
+	if asJSON {
+		printJSON(w, v)
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Name:\t%s\n", v.Name)
+	fmt.Fprintf(tw, "Size:\t%s\n", formatSize(v.Size))
+	fmt.Fprintf(tw, "Type:\t%s\n", v.Type)
+	fmt.Fprintf(tw, "Location:\t%s\n", v.Location)
+	fmt.Fprintf(tw, "Resumable:\t%t\n", v.Resumable)
+	fmt.Fprintf(tw, "Chunks:\t%d\n", v.ChunkLen)
+	fmt.Fprintf(tw, "URL:\t%s\n", v.URL)
+	tw.Flush()
+}
+
+// formatSize formats the bytes into human readable size, e.g 1.5 MiB
+func formatSize(size int64) string {
+	if size < 0 {
+		return "unknown"
+	}
+
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/thoriqadillah/rapid"
+)
+
+const (
+	ttyInterval   = 200 * time.Millisecond
+	plainInterval = 5 * time.Second
+	barWidth      = 30
+	nameWidth     = 24
+
+	// speedSmoothing is the weight of the latest speed sample, so the speed and eta don't jump around
+	speedSmoothing = 0.3
+)
+
+type (
+	// bar is the progress of an entry which is assembled from the progress of its chunks
+	bar struct {
+		entry       rapid.Entry
+		chunks      []int64
+		seen        []bool
+		extracting  float64
+		transferred int64 // bytes downloaded in this session, excluding the resumed bytes
+		last        int64 // transferred bytes on the previous render
+		speed       float64
+		status      string
+	}
+
+	// progress renders the bars of the entries. On terminal, the bars are redrawn in place, otherwise the progress is printed
+	// as plain lines periodically
+	progress struct {
+		mu       sync.Mutex
+		w        io.Writer
+		tty      bool
+		chunks   bool
+		width    int
+		interval time.Duration
+		bars     []*bar
+		byID     map[string]*bar
+		lines    int // lines drawn by the previous render, which are overwritten by the next one
+		rendered time.Time
+		done     chan struct{}
+		stopped  chan struct{}
+	}
+)
+
+func newProgress(w io.Writer, chunks bool) *progress {
+	tty := isTerminal(w)
+	interval := plainInterval
+	if tty {
+		interval = ttyInterval
+	}
+
+	return &progress{
+		w:        w,
+		tty:      tty,
+		chunks:   chunks,
+		width:    terminalWidth(),
+		interval: interval,
+		byID:     make(map[string]*bar),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// isTerminal tells whether the writer is a character device, e.g terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+func terminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 40 {
+		return width
+	}
+
+	return 100
+}
+
+func (p *progress) add(entry rapid.Entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := &bar{
+		entry:      entry,
+		chunks:     make([]int64, entry.ChunkLen()),
+		seen:       make([]bool, entry.ChunkLen()),
+		extracting: -1,
+	}
+
+	p.bars = append(p.bars, b)
+	p.byID[entry.ID()] = b
+}
+
+// update is the rapid.OnProgress which receives the id, chunk index, downloaded bytes of the chunk, and its progress in percent
+func (p *progress) update(data ...interface{}) {
+	if len(data) < 4 {
+		return
+	}
+
+	id, _ := data[0].(string)
+	index, _ := data[1].(int)
+	downloaded, _ := data[2].(int64)
+	percent, _ := data[3].(float64)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b, ok := p.byID[id]
+	if !ok {
+		return
+	}
+
+	if index == rapid.ExtractIndex {
+		b.extracting = percent
+		return
+	}
+
+	if index < 0 || index >= len(b.chunks) {
+		return
+	}
+
+	// the first update of a chunk may carry the bytes of the previous download, which are not counted into the speed
+	if b.seen[index] && downloaded > b.chunks[index] {
+		b.transferred += downloaded - b.chunks[index]
+	}
+
+	b.seen[index] = true
+	b.chunks[index] = downloaded
+}
+
+// finish marks the entry as done with the status, e.g completed, failed, or interrupted
+func (p *progress) finish(entry rapid.Entry, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if b, ok := p.byID[entry.ID()]; ok {
+		b.status = status
+	}
+}
+
+// start redraws the progress periodically until stop is called
+func (p *progress) start() {
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				p.render(true)
+				return
+			case <-ticker.C:
+				p.render(false)
+			}
+		}
+	}()
+}
+
+// stop draws the final progress and waits until it is written
+func (p *progress) stop() {
+	close(p.done)
+	<-p.stopped
+}
+
+func (p *progress) render(final bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(p.rendered).Seconds()
+	first := p.rendered.IsZero()
+	p.rendered = now
+
+	for _, b := range p.bars {
+		b.measure(elapsed, first)
+	}
+
+	// the whole frame is written at once to avoid flicker
+	var buf bytes.Buffer
+	if p.tty {
+		p.renderTTY(&buf)
+	} else {
+		p.renderPlain(&buf, final)
+	}
+
+	p.w.Write(buf.Bytes())
+}
+
+func (p *progress) renderTTY(buf *bytes.Buffer) {
+	if p.lines > 0 {
+		fmt.Fprintf(buf, "\x1b[%dA", p.lines)
+	}
+
+	lines := 0
+	for _, b := range p.bars {
+		fmt.Fprintf(buf, "\x1b[2K%s\n", p.line(b))
+		lines++
+
+		if !p.chunks || b.status != "" || len(b.chunks) < 2 {
+			continue
+		}
+
+		for i := range b.chunks {
+			fmt.Fprintf(buf, "\x1b[2K%s\n", b.chunkLine(i))
+			lines++
+		}
+	}
+
+	// clear the leftover sub-bars of the entries that are already done
+	for i := lines; i < p.lines; i++ {
+		buf.WriteString("\x1b[2K\n")
+	}
+
+	if p.lines > lines {
+		fmt.Fprintf(buf, "\x1b[%dA", p.lines-lines)
+	}
+
+	p.lines = lines
+}
+
+func (p *progress) renderPlain(buf *bytes.Buffer, final bool) {
+	for _, b := range p.bars {
+		// the entry that is done is only printed once by the final render
+		if b.status != "" && !final {
+			continue
+		}
+
+		fmt.Fprintln(buf, strings.TrimSpace(b.summary()))
+	}
+}
+
+// measure updates the speed of the entry with the bytes transferred since the previous render
+func (b *bar) measure(elapsed float64, first bool) {
+	delta := b.transferred - b.last
+	b.last = b.transferred
+
+	if first || elapsed <= 0 {
+		return
+	}
+
+	sample := float64(delta) / elapsed
+	if b.speed == 0 {
+		b.speed = sample
+		return
+	}
+
+	b.speed = speedSmoothing*sample + (1-speedSmoothing)*b.speed
+}
+
+func (b *bar) downloaded() int64 {
+	total := int64(0)
+	for _, downloaded := range b.chunks {
+		total += downloaded
+	}
+
+	return total
+}
+
+func (b *bar) percent() float64 {
+	if b.entry.Size() <= 0 {
+		return 0
+	}
+
+	percent := 100 * float64(b.downloaded()) / float64(b.entry.Size())
+	if percent > 100 {
+		return 100
+	}
+
+	return percent
+}
+
+func (b *bar) eta() string {
+	if b.speed <= 0 || b.entry.Size() <= 0 {
+		return "--:--"
+	}
+
+	remaining := float64(b.entry.Size()-b.downloaded()) / b.speed
+	return formatDuration(time.Duration(remaining * float64(time.Second)))
+}
+
+// summary is the progress of the entry without the bar
+func (b *bar) summary() string {
+	name := truncate(b.entry.Name(), nameWidth)
+	size := fmt.Sprintf("%s/%s", formatSize(b.downloaded()), formatSize(b.entry.Size()))
+
+	switch {
+	case b.status != "":
+		return fmt.Sprintf("%-*s %6.1f%% %s %s", nameWidth, name, b.percent(), size, b.status)
+	case b.extracting >= 0:
+		return fmt.Sprintf("%-*s extracting %5.1f%%", nameWidth, name, b.extracting)
+	}
+
+	return fmt.Sprintf("%-*s %6.1f%% %s %s/s ETA %s", nameWidth, name, b.percent(), size, formatSize(int64(b.speed)), b.eta())
+}
+
+func (p *progress) line(b *bar) string {
+	if p.width < nameWidth+barWidth+50 {
+		return b.summary()
+	}
+
+	name := truncate(b.entry.Name(), nameWidth)
+	rest := strings.TrimPrefix(b.summary(), fmt.Sprintf("%-*s", nameWidth, name))
+
+	return fmt.Sprintf("%-*s %s%s", nameWidth, name, drawBar(b.percent(), barWidth), rest)
+}
+
+func (b *bar) chunkLine(index int) string {
+	size := b.entry.Size() / int64(len(b.chunks))
+	percent := float64(0)
+	if size > 0 {
+		percent = 100 * float64(b.chunks[index]) / float64(size)
+	}
+
+	if percent > 100 {
+		percent = 100
+	}
+
+	return fmt.Sprintf("  #%-*d %s %6.1f%%", nameWidth-3, index, drawBar(percent, barWidth), percent)
+}
+
+func drawBar(percent float64, width int) string {
+	filled := int(percent / 100 * float64(width))
+	if filled > width {
+		filled = width
+	}
+
+	head := ""
+	if filled < width && filled > 0 {
+		filled--
+		head = ">"
+	}
+
+	return "[" + strings.Repeat("=", filled) + head + strings.Repeat(" ", width-filled-len(head)) + "]"
+}
+
+func truncate(name string, width int) string {
+	if utf8.RuneCountInString(name) <= width {
+		return name
+	}
+
+	runes := []rune(name)
+	return string(runes[:width-3]) + "..."
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	seconds := int(d.Seconds()) % 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+
+	return fmt.Sprintf("%02d:%02d", minutes, seconds)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+type fakeEntry struct {
+	id       string
+	size     int64
+	chunkLen int
+}
+
+func (e *fakeEntry) ID() string               { return e.id }
+func (e *fakeEntry) Name() string             { return "file.bin" }
+func (e *fakeEntry) Location() string         { return "file.bin" }
+func (e *fakeEntry) Size() int64              { return e.size }
+func (e *fakeEntry) Type() string             { return "other" }
+func (e *fakeEntry) URL() string              { return "http://localhost/file.bin" }
+func (e *fakeEntry) ChunkLen() int            { return e.chunkLen }
+func (e *fakeEntry) Resumable() bool          { return true }
+func (e *fakeEntry) Context() context.Context { return context.Background() }
+func (e *fakeEntry) Cancel()                  {}
+func (e *fakeEntry) Expired() bool            { return false }
+func (e *fakeEntry) Refresh() error           { return nil }
+
+func TestProgressUpdate(t *testing.T) {
+	var out bytes.Buffer
+	p := newProgress(&out, false)
+	entry := &fakeEntry{id: "abc", size: 1000, chunkLen: 2}
+	p.add(entry)
+
+	// the first update carries the resumed bytes, which must not be counted as transferred
+	p.update("abc", 0, int64(300), float64(60))
+	p.update("abc", 0, int64(400), float64(80))
+	p.update("abc", 1, int64(100), float64(20))
+	p.update("unknown", 0, int64(100), float64(20))
+
+	b := p.byID["abc"]
+	if got := b.downloaded(); got != 500 {
+		t.Errorf("Expected 500 bytes downloaded, got %d", got)
+	}
+
+	if b.transferred != 100 {
+		t.Errorf("Expected 100 bytes transferred, got %d", b.transferred)
+	}
+
+	if got := b.percent(); got != 50 {
+		t.Errorf("Expected 50%%, got %v", got)
+	}
+
+	p.finish(entry, statusCompleted)
+	p.render(true)
+
+	if !strings.Contains(out.String(), "completed") {
+		t.Errorf("Expected the final line to contain the status, got %q", out.String())
+	}
+
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Error("Expected plain output on non terminal")
+	}
+}
+
+func TestDrawBar(t *testing.T) {
+	cases := map[float64]string{
+		0:   "[          ]",
+		50:  "[====>     ]",
+		100: "[==========]",
+	}
+
+	for percent, expected := range cases {
+		if got := drawBar(percent, 10); got != expected {
+			t.Errorf("Expected %q for %v%%, got %q", expected, percent, got)
+		}
+	}
+}
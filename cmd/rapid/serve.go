@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thoriqadillah/rapid"
+	"github.com/thoriqadillah/rapid/api"
+	"github.com/thoriqadillah/rapid/aria2"
+)
+
+// settingInterval is how often the setting file is checked for changes
+const settingInterval = 2 * time.Second
+
+func runServe(args []string) int {
+	opt := &options{}
+	fs := newFlagSet("serve", opt, true)
+	rpcListen := fs.String("rpc-listen", "127.0.0.1:6800", "address of the aria2 compatible json-rpc")
+	rpcSecret := fs.String("rpc-secret", "", "secret token of the json-rpc")
+	rpcOrigins := fs.String("rpc-allow-origin", "", "comma separated origins of the web ui allowed to call the json-rpc, * needs the secret")
+	apiListen := fs.String("api-listen", "127.0.0.1:6900", "address of the http api, empty to disable it")
+	apiToken := fs.String("api-token", "", "bearer token of the http api")
+	apiOrigins := fs.String("api-allow-origin", "", "comma separated origins of the dashboard allowed to call the http api, * needs the token")
+	if ok, code := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+
+	loaded, err := rapid.LoadSetting()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid serve: %v\n", err)
+		return exitUsage
+	}
+
+	// the setting file is watched, so the changes are applied without restarting the downloads
+	live := rapid.NewLiveSetting(loaded)
+	setting := opt.override(live)
+
+	watch, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go live.WatchFile(watch, rapid.SettingFile(live.DataLocation()), settingInterval)
+
+	entryOptions, err := opt.entryOptions(setting)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rapid serve: %v\n", err)
+		return exitUsage
+	}
+
+	downloader := rapid.NewDownloader(rapid.DownloaderDefault, rapid.SetDownloaderSetting(setting))
+	manager := rapid.NewManager(downloader, rapid.NewQueue(rapid.QueueDefault, setting), setting)
+	defer manager.Close()
+
+	rpcOptions := []aria2.ServerOptions{
+		aria2.SetSecret(*rpcSecret),
+		aria2.SetListenAddress(*rpcListen),
+		aria2.SetEntryOptions(entryOptions...),
+	}
+	if *rpcOrigins != "" {
+		rpcOptions = append(rpcOptions, aria2.SetAllowedOrigins(splitList(*rpcOrigins)...))
+	}
+
+	rpc := aria2.NewServer(manager, setting, rpcOptions...)
+	defer rpc.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/jsonrpc", rpc)
+
+	servers := []*http.Server{{Addr: *rpcListen, Handler: mux}}
+	fmt.Fprintf(os.Stderr, "rapid: json-rpc is listening on http://%s/jsonrpc\n", *rpcListen)
+
+	if *apiListen != "" {
+		apiOptions := []api.ServerOptions{
+			api.SetToken(*apiToken),
+			api.SetListenAddress(*apiListen),
+			api.SetEntryOptions(entryOptions...),
+			api.SetLiveSetting(live),
+		}
+		if *apiOrigins != "" {
+			apiOptions = append(apiOptions, api.SetAllowedOrigins(splitList(*apiOrigins)...))
+		}
+
+		handler := api.NewServer(manager, setting, apiOptions...)
+		defer handler.Close()
+
+		servers = append(servers, &http.Server{Addr: *apiListen, Handler: handler})
+		fmt.Fprintf(os.Stderr, "rapid: api is listening on http://%s\n", *apiListen)
+	}
+
+	return listen(servers)
+}
+
+// splitList splits the comma separated values of the flag
+func splitList(value string) []string {
+	values := strings.Split(value, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+
+	return values
+}
+
+// listen serves the servers until one of them fails or the user interrupts it
+func listen(servers []*http.Server) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+
+	code := exitOK
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		fmt.Fprintf(os.Stderr, "rapid serve: %v\n", err)
+		code = exitFailure
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "rapid serve: %v\n", err)
+		}
+	}
+
+	return code
+}
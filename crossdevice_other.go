@@ -0,0 +1,13 @@
+//go:build !windows
+
+package rapid
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice checks whether the file can't be renamed because the destination is on another filesystem
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package rapid
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errNotSameDevice is ERROR_NOT_SAME_DEVICE, which is returned when the file is moved to another volume
+const errNotSameDevice = syscall.Errno(17)
+
+// crossDevice checks whether the file can't be renamed because the destination is on another volume
+func crossDevice(err error) bool {
+	return errors.Is(err, errNotSameDevice)
+}
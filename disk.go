@@ -0,0 +1,157 @@
+package rapid
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// InsufficientSpaceError is the error of the entry which doesn't fit into the free space of the disk
+type InsufficientSpaceError struct {
+	Path      string
+	Required  int64 // bytes the download still needs, including the free space to keep
+	Available int64
+}
+
+var (
+	ErrInsufficientSpace = fmt.Errorf("insufficient disk space")
+
+	// errDiskUnsupported is returned on the platform where the free space can't be checked, so the check is skipped
+	errDiskUnsupported = fmt.Errorf("disk space is not supported on this platform")
+)
+
+// spaceInterval is how often the free space is checked while the chunks are downloaded
+const spaceInterval = time.Second
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("%v at %s: %d bytes required, %d bytes available", ErrInsufficientSpace, e.Path, e.Required, e.Available)
+}
+
+func (e *InsufficientSpaceError) Is(target error) bool {
+	return target == ErrInsufficientSpace
+}
+
+// existingDir returns the closest directory of the path which exists, since the location may not be created yet
+func existingDir(path string) string {
+	for {
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+
+		path = parent
+	}
+}
+
+// requiredSpace returns the bytes the chunks still need, and the bytes the actual file needs. The single chunk is renamed
+// into the actual file, so it needs no more space unless it is moved to another disk
+func requiredSpace(entry Entry, chunks []*chunk, sameDisk bool) (int64, int64) {
+	var remaining int64
+	for _, chunk := range chunks {
+		remaining += chunk.size - (chunk.start - chunk.begin)
+	}
+
+	if entry.ChunkLen() == 1 && sameDisk {
+		return remaining, 0
+	}
+
+	return remaining, entry.Size()
+}
+
+// checkSpace makes sure the chunks and the actual file fit into the free space of their disks, while keeping the free
+// space of the setting. The check is skipped when the size is unknown or the disk can't be checked
+func checkSpace(entry Entry, chunks []*chunk, chunkDir string, setting Setting) error {
+	if entry.Size() <= 0 || len(chunks) == 0 {
+		return nil
+	}
+
+	chunkFree, chunkDisk, err := diskSpace(existingDir(chunkDir))
+	if errors.Is(err, errDiskUnsupported) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fileDir := existingDir(filepath.Dir(entry.Location()))
+	fileFree, fileDisk, err := diskSpace(fileDir)
+	if err != nil {
+		return err
+	}
+
+	sameDisk := chunkDisk == fileDisk
+	chunkSize, fileSize := requiredSpace(entry, chunks, sameDisk)
+	reserve := setting.MinFreeSpace()
+
+	// both of them are written into the same disk, so they share its free space
+	if sameDisk {
+		chunkSize += fileSize
+		fileSize = 0
+	}
+
+	if required := chunkSize + reserve; chunkSize > 0 && required > chunkFree {
+		return &InsufficientSpaceError{Path: chunkDir, Required: required, Available: chunkFree}
+	}
+
+	if required := fileSize + reserve; fileSize > 0 && required > fileFree {
+		return &InsufficientSpaceError{Path: fileDir, Required: required, Available: fileFree}
+	}
+
+	return nil
+}
+
+// guardSpace pauses the entry when the free space of any of the directories, e.g the chunks and the actual file, drops
+// below the setting while the chunks are downloaded. The returned function stops the guard, and returns the error if the
+// entry is paused by it
+func guardSpace(entry Entry, setting Setting, logger Logger, dirs ...string) func() error {
+	done := make(chan struct{})
+	result := make(chan error, 1)
+
+	go func() {
+		ticker := time.NewTicker(spaceInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				result <- nil
+				return
+			case <-entry.Context().Done():
+				result <- nil
+				return
+			case <-ticker.C:
+			}
+
+			// the threshold is read every time, so it follows the setting which is changed at runtime
+			reserve := setting.MinFreeSpace()
+			if reserve <= 0 {
+				continue
+			}
+
+			for _, dir := range dirs {
+				free, _, err := diskSpace(existingDir(dir))
+				if err != nil || free >= reserve {
+					continue
+				}
+
+				logger.Warn("Free space is low, pausing entry", "location", dir, "free", free, "min", reserve)
+				entry.Cancel()
+
+				result <- &InsufficientSpaceError{Path: dir, Required: reserve, Available: free}
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		return <-result
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package rapid
+
+func diskSpace(path string) (int64, string, error) {
+	return 0, "", errDiskUnsupported
+}
@@ -0,0 +1,88 @@
+package rapid
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckSpace(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	content := bytes.Repeat([]byte("0123456789"), 1024)
+	server := testServer(t, content)
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	chunks := []*chunk{newChunk(entry, 0, setting)}
+	if err := checkSpace(entry, chunks, setting.DownloadLocation(), setting); err != nil {
+		t.Errorf("Expected the entry to fit into the disk, got %v", err)
+	}
+
+	setting.minFreeSpace = math.MaxInt64 / 2
+	err = checkSpace(entry, chunks, setting.DownloadLocation(), setting)
+
+	var spaceErr *InsufficientSpaceError
+	if !errors.As(err, &spaceErr) || !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("Expected insufficient space error, got %v", err)
+	}
+
+	if spaceErr.Required <= spaceErr.Available {
+		t.Errorf("Expected more required than available, got %d and %d", spaceErr.Required, spaceErr.Available)
+	}
+}
+
+func TestDownloadInsufficientSpace(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.minFreeSpace = math.MaxInt64 / 2
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Download(entry); !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("Expected insufficient space error, got %v", err)
+	}
+
+	if _, err := os.Stat(entry.Location()); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be downloaded, got %v", err)
+	}
+}
+
+func TestGuardSpace(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	guard := guardSpace(entry, setting, NewLogger(setting), filepath.Join(setting.DownloadLocation(), "missing"))
+	time.Sleep(spaceInterval + 100*time.Millisecond)
+	if err := guard(); err != nil || entry.Context().Err() != nil {
+		t.Fatalf("Expected the entry to continue while there is enough space, got %v", err)
+	}
+
+	setting.minFreeSpace = math.MaxInt64 / 2
+	guard = guardSpace(entry, setting, NewLogger(setting), setting.TempLocation(), filepath.Dir(entry.Location()))
+
+	select {
+	case <-entry.Context().Done():
+	case <-time.After(3 * spaceInterval):
+		t.Fatal("Expected the entry to be paused when the free space is low")
+	}
+
+	if err := guard(); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("Expected insufficient space error, got %v", err)
+	}
+}
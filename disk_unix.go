@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package rapid
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// diskSpace returns the free space in bytes for the unprivileged user of the disk where the path is, and the device of
+// the disk to know if two paths are on the same disk
+func diskSpace(path string) (int64, string, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, "", err
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, "", err
+	}
+
+	return int64(fs.Bavail) * int64(fs.Bsize), strconv.FormatUint(uint64(stat.Dev), 10), nil
+}
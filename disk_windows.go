@@ -0,0 +1,33 @@
+//go:build windows
+
+package rapid
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskSpace returns the free space in bytes for the current user of the volume where the path is, and the volume to
+// know if two paths are on the same disk
+func diskSpace(path string) (int64, string, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var free uint64
+	if ok, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&free)), 0, 0); ok == 0 {
+		return 0, "", err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return int64(free), strings.ToLower(filepath.VolumeName(abs)), nil
+}
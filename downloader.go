@@ -15,6 +15,17 @@ type (
 		Watch(update OnProgress)
 	}
 
+	// Canceller is implemented by downloader which can stop the download for good, removing what is downloaded. Stop
+	// of such downloader pauses the download instead
+	Canceller interface {
+		Cancel(entry Entry) error
+	}
+
+	// Throttler is implemented by downloader which download speed can be changed while it is running
+	Throttler interface {
+		SetRateLimit(rate int64)
+	}
+
 	// DownloaderFactory is an abstract for creating a Downloader
 	DownloaderFactory func(o *downloaderOption) Downloader
 
@@ -22,6 +33,8 @@ type (
 
 	downloaderOption struct {
 		setting Setting
+		hooks   *hooks
+		extract *extractOption
 	}
 
 	DownloaderOptions func(o *downloaderOption)
@@ -38,6 +51,7 @@ var downloadermap = make(map[string]DownloaderFactory)
 func NewDownloader(provider string, options ...DownloaderOptions) Downloader {
 	opt := &downloaderOption{
 		setting: DefaultSetting(),
+		hooks:   &hooks{},
 	}
 
 	for _, option := range options {
@@ -1,6 +1,8 @@
 package rapid
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,133 +15,464 @@ import (
 type localDownloader struct {
 	setting    Setting
 	logger     Logger
+	hooks      *hooks
+	extract    *extractOption
+	limiter    *rateLimiter
 	onprogress OnProgress
+	stopping   sync.Map // why the entry is stopped by the id, either ErrPaused or ErrCancelled
+
+	unsubscribe func() // stops following the setting, nil if the setting doesn't change
+	closeOnce   sync.Once
 }
 
 var DownloaderDefault = "default"
 
 func newLocalDownloader(opt *downloaderOption) Downloader {
-	return &localDownloader{
+	dl := &localDownloader{
 		setting: opt.setting,
 		logger:  NewLogger(opt.setting),
+		hooks:   opt.hooks,
+		extract: opt.extract,
+		limiter: newRateLimiter(opt.setting.RateLimit()),
+	}
+
+	// the chunks of every downloader share the same pool, which is only grown by the later downloaders, so they can't
+	// shrink it under the ones which are already downloading
+	chunkScheduler.grow(opt.setting.MaxConnections())
+
+	// the rate limit and the max connections follow the setting, unless they are unchanged so the ones from
+	// SetRateLimit and SetMaxConnections are kept
+	if notifier, ok := opt.setting.(SettingNotifier); ok {
+		rate := opt.setting.RateLimit()
+		size := opt.setting.MaxConnections()
+		dl.unsubscribe = notifier.Subscribe(func() {
+			if current := opt.setting.RateLimit(); current != rate {
+				rate = current
+				dl.SetRateLimit(rate)
+			}
+
+			if current := opt.setting.MaxConnections(); current != size {
+				size = current
+				SetMaxConnections(size)
+			}
+		})
 	}
+
+	return dl
+}
+
+// Close stops following the setting, so the downloader which is no longer used can be collected
+func (dl *localDownloader) Close() error {
+	dl.closeOnce.Do(func() {
+		if dl.unsubscribe != nil {
+			dl.unsubscribe()
+		}
+	})
+
+	return nil
 }
 
 func (dl *localDownloader) Download(entry Entry) error {
-	start := time.Now()
+	return dl.track(entry, dl.download)
+}
+
+// log returns the logger with the fields of the entry
+func (dl *localDownloader) log(entry Entry) Logger {
+	return dl.logger.With("entry", entry.ID())
+}
+
+// track will record the entry as active while it is being downloaded, and run the failure hooks if the download is failed
+func (dl *localDownloader) track(entry Entry, download func(entry Entry) error) error {
+	metrics.activeEntries.add(1)
+	defer metrics.activeEntries.add(-1)
+
+	err := dl.settle(entry, download(entry))
+	if err != nil && !errors.Is(err, ErrPaused) && !errors.Is(err, ErrCancelled) && !errors.Is(err, ErrInvalidTransition) {
+		metrics.failures.add(failureCause(err), 1)
+		dl.hooks.runOnFailure(entry, err)
+	}
+
+	return err
+}
+
+// settle changes the state of the entry once its download returns. The download which is stopped returns ErrPaused or
+// ErrCancelled instead, and the cancelled one removes what is downloaded
+func (dl *localDownloader) settle(entry Entry, err error) error {
+	reason, _ := dl.stopping.LoadAndDelete(entry.ID())
+	if errors.Is(err, ErrInvalidTransition) {
+		return err
+	}
+
+	stopped := errors.Is(err, ErrPaused) || (err != nil && entry.Context().Err() != nil)
+	switch {
+	case stopped && reason == ErrCancelled:
+		if e := dl.removeChunks(entry); e != nil {
+			dl.log(entry).Error("Error removing cancelled download", "error", e)
+		}
+
+		dl.transition(entry, StateCancelled)
+		return ErrCancelled
+	case stopped:
+		dl.transition(entry, StatePaused)
+
+		// the entry may be paused by the downloader itself, e.g when the disk is full
+		if !errors.Is(err, ErrPaused) {
+			return fmt.Errorf("%w: %w", ErrPaused, err)
+		}
+
+		return ErrPaused
+	case err != nil:
+		dl.transition(entry, StateFailed)
+		return err
+	}
+
+	dl.transition(entry, StateCompleted)
+	return nil
+}
+
+// transition changes the state of the entry and runs the state hooks. The entry which doesn't keep its state is only
+// reported to the hooks
+func (dl *localDownloader) transition(entry Entry, state State) error {
+	var from State
+	if stater, ok := entry.(EntryStater); ok {
+		var err error
+		if from, err = stater.Transition(state); err != nil {
+			dl.log(entry).Warn("Error changing state", "error", err)
+			return err
+		}
+
+		if from == state {
+			return nil
+		}
+	}
+
+	dl.log(entry).Debug("State changed", "from", from, "to", state)
+	dl.hooks.runOnStateChange(entry, from, state)
+	return nil
+}
+
+// WatchState reports the state changes of every entry, in addition to the hooks from OnStateChange. WatchState must be
+// called before Download
+func (dl *localDownloader) WatchState(hook StateHook) {
+	dl.hooks.onStateChange = append(dl.hooks.onStateChange, hook)
+}
+
+// probe will check if the entry is still downloadable
+func (dl *localDownloader) probe(entry Entry) error {
+	if err := dl.hooks.runBeforeProbe(entry); err != nil {
+		return err
+	}
 
 	if entry.Expired() {
 		return errUrlExpired
 	}
 
-	worker, err := NewWorker(entry.Context(), entry.ChunkLen(), entry.ChunkLen(), dl.setting)
-	if err != nil {
-		dl.logger.Print("Error creating worker", err.Error())
+	return nil
+}
+
+func (dl *localDownloader) download(entry Entry) error {
+	start := time.Now()
+
+	if err := dl.transition(entry, StateProbing); err != nil {
 		return err
 	}
 
-	var wg sync.WaitGroup
-	worker.Start()
-	defer worker.Stop()
+	if err := dl.probe(entry); err != nil {
+		return err
+	}
 
-	chunks := make([]*chunk, entry.ChunkLen())
+	skip, err := dl.claim(entry)
+	if err != nil || skip {
+		return err
+	}
+
+	// the part file in the location may be left by another entry, so it can't be continued
+	if err := removePart(entry); err != nil {
+		return err
+	}
+
+	if err := dl.hooks.runBeforeChunk(entry); err != nil {
+		return err
+	}
+
+	if duplicatePolicy(entry, dl.setting) == DuplicateResume && entry.Resumable() {
+		if err := seedPartial(entry, dl.setting); err != nil {
+			dl.log(entry).Error("Error continuing from existing file", "location", entry.Location(), "error", err)
+			return err
+		}
+	}
+
+	if err := dl.transition(entry, StateDownloading); err != nil {
+		return err
+	}
+
+	if err := dl.downloadChunks(entry); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(start)
+	dl.log(entry).Info("Entry downloaded", "name", entry.Name(), "elapsed", elapsed.Seconds())
+
+	return nil
+}
+
+// downloadChunks downloads the chunks of the entry that are not completed yet, then combines them into the actual file
+func (dl *localDownloader) downloadChunks(entry Entry) error {
+	// the entry which is stopped before its chunks are started has no chunk to wait for
+	if entry.Context().Err() != nil {
+		return ErrPaused
+	}
+
+	dir := chunkDir(dl.setting, entry.ID())
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		dl.log(entry).Error("Error creating temp location", "location", dir, "error", err)
+		return err
+	}
+
+	// the chunks take turns with the chunks of the other entries in the shared pool
+	pool := chunkScheduler.pool(entry.Context(), entry, dl.setting, dl.log(entry))
+	pool.Start()
+	defer pool.Stop()
+
+	// the throttled chunks merge their ranges into the chunks which still have their connections
+	ranges := &chunkRanges{}
+	merged := mergedSize(entry)
+	chunks := make([]*chunk, 0, entry.ChunkLen())
 	for i := 0; i < entry.ChunkLen(); i++ {
-		chunks[i] = newChunk(entry, i, dl.setting, &wg)
+		chunk := newChunk(entry, i, dl.setting)
+
+		// the chunk is already combined into the part file by the merge which is stopped halfway
+		if _, err := os.Stat(chunk.path); os.IsNotExist(err) && merged >= chunk.begin+chunk.size {
+			if dl.onprogress != nil {
+				dl.onprogress(entry.ID(), chunk.index, chunk.size, float64(100))
+			}
+
+			continue
+		}
+
+		// unresumable chunk can't be continued, so it must be started over
+		if !entry.Resumable() {
+			if err := os.Remove(chunk.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if file, err := os.Stat(chunk.path); err == nil && file.Size() == chunk.size {
+			// let the watcher know that the chunk is already completed by the previous download
+			if dl.onprogress != nil {
+				dl.onprogress(entry.ID(), chunk.index, chunk.size, float64(100))
+			}
 
+			continue
+		}
+
+		chunk.resume()
+		chunk.ranges = ranges
+		chunk.limiter = dl.limiter
 		if dl.onprogress != nil {
-			chunks[i].onProgress(dl.onprogress)
+			chunk.onProgress(dl.onprogress)
 		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	if err := checkSpace(entry, chunks, dir, dl.setting); err != nil {
+		dl.log(entry).Error("Error checking free space", "error", err)
+		return err
 	}
 
+	// the part file and the actual file are written into the location of the entry, which may be on another disk
+	guard := guardSpace(entry, dl.setting, dl.log(entry), dir, filepath.Dir(entry.Location()))
+
 	for _, chunk := range chunks {
-		wg.Add(1)
-		worker.Add(chunk)
+		pool.Add(chunk)
 	}
 
-	wg.Wait()
+	// the chunks are waited for even when the entry is stopped, so none of them is still writing once this returns
+	err := pool.Wait(context.Background())
+
+	if err := guard(); err != nil {
+		return err
+	}
 
 	if entry.Context().Err() != nil {
-		return nil
+		return ErrPaused
 	}
 
-	// combining file
-	if err := dl.createFile(entry); err != nil {
-		dl.logger.Print("Error combining chunks:", err.Error())
+	if err != nil {
 		return err
 	}
 
-	elapsed := time.Since(start)
-	dl.logger.Print(entry.Name(), "downloaded  in", elapsed.Seconds(), "s")
+	return dl.merge(entry)
+}
 
-	return nil
+// claim resolves the location of the entry according to its duplicate policy, since another download can claim the name
+// while this one is running. It returns true if the download can be skipped because the file is already there
+func (dl *localDownloader) claim(entry Entry) (bool, error) {
+	policy := duplicatePolicy(entry, dl.setting)
+	location, skip, err := resolveDuplicate(entry.Location(), policy, entry.Size(), entry.Resumable(), entryChecksum(entry))
+	if err != nil {
+		dl.log(entry).Error("Error claiming the location", "location", entry.Location(), "error", err)
+		return false, err
+	}
+
+	if skip {
+		dl.log(entry).Info("Entry is already downloaded, skipping", "location", entry.Location())
+		return true, dl.removeChunks(entry)
+	}
+
+	if location == entry.Location() {
+		return false, nil
+	}
+
+	relocator, ok := entry.(EntryRelocator)
+	if !ok {
+		return false, ErrDuplicate
+	}
+
+	dl.log(entry).Warn("Location already exists, renaming", "location", entry.Location(), "renamed", location)
+	relocator.Relocate(location)
+
+	return false, nil
+}
+
+func (dl *localDownloader) removeChunks(entry Entry) error {
+	if err := os.RemoveAll(chunkDir(dl.setting, entry.ID())); err != nil {
+		return err
+	}
+
+	return removePart(entry)
 }
 
 var errUrlExpired = fmt.Errorf("link is expired")
 
-func (dl *localDownloader) Resume(entry Entry) error {
+// merge will combine the chunks into the actual file while running the hooks around it
+func (dl *localDownloader) merge(entry Entry) error {
+	if err := dl.hooks.runBeforeCreate(entry); err != nil {
+		return err
+	}
+
+	skip, err := dl.claim(entry)
+	if err != nil || skip {
+		return err
+	}
+
+	if err := dl.transition(entry, StateMerging); err != nil {
+		return err
+	}
+
+	// combining file
 	start := time.Now()
+	if err := dl.createFile(entry); err != nil {
+		dl.log(entry).Error("Error combining chunks", "error", err)
+		return err
+	}
 
-	if entry.Expired() {
-		return errUrlExpired
+	observeMerge(start)
+
+	if err := dl.transition(entry, StateVerifying); err != nil {
+		return err
 	}
 
-	// check if context is canceled (download stoppped by user)
-	if err := entry.Refresh(); err != nil {
+	part := partPath(entry.Location())
+	if err := verifyChecksum(entry, part); err != nil {
+		dl.log(entry).Error("Error verifying downloaded file", "location", part, "error", err)
+
+		// the combined file is corrupted, so it can't be continued
+		os.Remove(part)
 		return err
 	}
 
-	dl.logger.Print("Resuming download", entry.Name(), "...")
+	if err := finalize(part, entry.Location()); err != nil {
+		dl.log(entry).Error("Error moving downloaded file", "location", entry.Location(), "error", err)
+		return err
+	}
 
-	if !entry.Resumable() {
-		dl.logger.Print(entry.Name(), "does not support resume download. Restarting...")
-		return dl.Download(entry)
+	if err := dl.hooks.runAfterMerge(entry); err != nil {
+		return err
+	}
+
+	dl.extractArchive(entry)
+	return nil
+}
+
+// extractArchive will extract the entry if auto extract is enabled and the entry is a supported archive. The entry is
+// already downloaded and verified at this point, so the extraction which fails is only logged and the entry is still
+// completed, as the archive itself is kept
+func (dl *localDownloader) extractArchive(entry Entry) {
+	if dl.extract == nil || archiveExt(entry.Location()) == "" {
+		return
 	}
 
-	worker, err := NewWorker(entry.Context(), entry.ChunkLen(), entry.ChunkLen(), dl.setting)
+	dl.log(entry).Info("Extracting archive", "location", entry.Location())
+
+	dst, err := extract(entry, dl.extract, dl.onprogress)
 	if err != nil {
-		dl.logger.Print("Error creating worker", err.Error())
+		dl.log(entry).Error("Error extracting archive", "location", entry.Location(), "error", err)
+		return
+	}
+
+	dl.log(entry).Info("Archive extracted", "location", dst)
+}
+
+func (dl *localDownloader) Resume(entry Entry) error {
+	return dl.track(entry, dl.resume)
+}
+
+func (dl *localDownloader) resume(entry Entry) error {
+	start := time.Now()
+
+	if err := dl.transition(entry, StateProbing); err != nil {
 		return err
 	}
 
-	var wg sync.WaitGroup
-	worker.Start()
-	defer worker.Stop()
+	if err := dl.probe(entry); err != nil {
+		return err
+	}
 
-	chunks := make([]*chunk, 0)
-	for i := 0; i < entry.ChunkLen(); i++ {
-		chunk := newChunk(entry, i, dl.setting, &wg)
-		if file, err := os.Stat(chunk.path); err == nil && file.Size() == chunk.size {
-			continue
-		}
+	// check if context is canceled (download stoppped by user)
+	if err := entry.Refresh(); err != nil {
+		return err
+	}
 
-		chunk.start += resumePosition(chunk.path)
-		chunks = append(chunks, chunk)
+	dl.log(entry).Info("Resuming download", "name", entry.Name())
+
+	if !entry.Resumable() {
+		dl.log(entry).Warn("Entry does not support resume download, restarting", "name", entry.Name())
+		return dl.download(entry)
 	}
 
-	for _, chunk := range chunks {
-		wg.Add(1)
-		worker.Add(chunk)
+	if err := dl.hooks.runBeforeChunk(entry); err != nil {
+		return err
 	}
 
-	wg.Wait()
+	if err := dl.transition(entry, StateDownloading); err != nil {
+		return err
+	}
 
-	// // combining file
-	if err := dl.createFile(entry); err != nil {
-		dl.logger.Print("Error combining chunks:", err.Error())
+	if err := dl.downloadChunks(entry); err != nil {
 		return err
 	}
 
 	elapsed := time.Since(start)
-	dl.logger.Print(entry.Name(), "resumed in", elapsed.Seconds(), "s")
+	dl.log(entry).Info("Entry resumed", "name", entry.Name(), "elapsed", elapsed.Seconds())
 
 	return nil
 }
 
 func (dl *localDownloader) Restart(entry Entry) error {
-	dl.logger.Print("Restarting download", entry.Name(), "...")
+	return dl.track(entry, dl.restart)
+}
 
-	if entry.Expired() {
-		return errUrlExpired
+func (dl *localDownloader) restart(entry Entry) error {
+	dl.log(entry).Info("Restarting download", "name", entry.Name())
+
+	if err := dl.transition(entry, StateProbing); err != nil {
+		return err
+	}
+
+	if err := dl.probe(entry); err != nil {
+		return err
 	}
 
 	// check if context is canceled (download stoppped by user)
@@ -148,64 +481,159 @@ func (dl *localDownloader) Restart(entry Entry) error {
 	}
 
 	// remove the downloaded chunk if any
-	for i := 0; i < entry.ChunkLen(); i++ {
-		chunkFile := filepath.Join(dl.setting.DownloadLocation(), fmt.Sprintf("%s-%d", entry.ID(), i))
-		if err := os.Remove(chunkFile); err != nil {
-			return err
-		}
+	if err := dl.removeChunks(entry); err != nil {
+		return err
 	}
 
-	return dl.Download(entry)
+	return dl.download(entry)
 }
 
+// Stop pauses the download, see Pause
 func (dl *localDownloader) Stop(entry Entry) error {
-	dl.logger.Print("Stopping download", entry.Name(), "...")
+	return dl.Pause(entry)
+}
+
+// Pause stops the download while keeping what is downloaded, so it can be continued with Resume. The download returns
+// ErrPaused
+func (dl *localDownloader) Pause(entry Entry) error {
+	return dl.stop(entry, ErrPaused)
+}
+
+// Cancel stops the download and removes what is downloaded. The download returns ErrCancelled
+func (dl *localDownloader) Cancel(entry Entry) error {
+	return dl.stop(entry, ErrCancelled)
+}
 
+func (dl *localDownloader) stop(entry Entry, reason error) error {
+	dl.log(entry).Info("Stopping download", "name", entry.Name(), "reason", reason)
+
+	if err := dl.hooks.runOnCancel(entry); err != nil {
+		return err
+	}
+
+	// the entry which is not being downloaded has no download to settle its state, so it is changed right away
+	if state := entryState(entry); state != "" && state != StatePending && !state.active() {
+		if reason != ErrCancelled {
+			return nil
+		}
+
+		if err := dl.transition(entry, StateCancelled); err != nil {
+			return err
+		}
+
+		return dl.removeChunks(entry)
+	}
+
+	dl.stopping.Store(entry.ID(), reason)
 	entry.Cancel()
 	return nil
 }
 
-// Watch will update the id, index, downloaded bytes, and progress in percent of chunks. Watch must be called before Download
+// Watch will update the id, index, downloaded bytes, and progress in percent of chunks. The downloaded bytes include what is already
+// saved by the previous download when it is resumed. Watch must be called before Download
 func (dl *localDownloader) Watch(update OnProgress) {
 	dl.onprogress = update
 }
 
-// createFile will combine chunks into single actual file
+// SetRateLimit changes the maximum download speed in bytes per second of every entry being downloaded, zero means unlimited
+func (dl *localDownloader) SetRateLimit(rate int64) {
+	dl.limiter.setRate(rate)
+}
+
+// createFile will combine chunks into the part file of the entry, which is renamed into the actual file once it is
+// verified. The merge which is stopped halfway continues from the chunks that are not combined yet
 func (dl *localDownloader) createFile(entry Entry) error {
-	file, err := os.Create(entry.Location())
-	if err != nil {
-		dl.logger.Print("Error creating downloaded file:", err.Error())
+	if err := os.MkdirAll(filepath.Dir(entry.Location()), os.ModePerm); err != nil {
+		dl.log(entry).Error("Error creating download folder", "location", entry.Location(), "error", err)
 		return err
 	}
 
-	defer file.Close()
+	part := partPath(entry.Location())
 
-	// if chunk len is 1, then just rename the chunk into entry filename
+	// if chunk len is 1, then just rename the chunk into the part file
 	// we assume if the chunk len is 1, then it is not chunkable and unresumable
 	if entry.ChunkLen() == 1 {
-		chunkname := filepath.Join(dl.setting.DownloadLocation(), fmt.Sprintf("%s-%d", entry.ID(), 0))
-		return os.Rename(chunkname, entry.Location())
+		tmpFilename := chunkPath(dl.setting, entry.ID(), 0)
+		if _, err := os.Stat(tmpFilename); err == nil {
+			if err := moveFile(tmpFilename, part); err != nil {
+				dl.log(entry).Error("Error moving chunk file into actual file", "location", part, "error", err)
+				return err
+			}
+		}
+
+		os.Remove(chunkDir(dl.setting, entry.ID()))
+		return syncFile(part)
+	}
+
+	file, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		dl.log(entry).Error("Error creating downloaded file", "location", part, "error", err)
+		return err
+	}
+
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	merged := stat.Size()
+	if err := preallocate(file, entry.Size()); err != nil {
+		dl.log(entry).Error("Error reserving space for downloaded file", "location", part, "error", err)
+		return err
 	}
 
 	for i := 0; i < entry.ChunkLen(); i++ {
-		tmpFilename := filepath.Join(dl.setting.DownloadLocation(), fmt.Sprintf("%s-%d", entry.ID(), i))
+		tmpFilename := chunkPath(dl.setting, entry.ID(), i)
+		start, length := chunkBounds(entry, i)
+
+		// the chunk is removed once it is combined, so the missing chunk is already in the part file
+		if _, err := os.Stat(tmpFilename); os.IsNotExist(err) && merged >= start+length {
+			continue
+		}
+
+		// the chunk may be partly combined before the merge is stopped, so it is combined again from its start
+		if merged > start {
+			if err := file.Truncate(start); err != nil {
+				return err
+			}
+
+			merged = start
+		}
+
+		if _, err := file.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+
 		tmpFile, err := os.Open(tmpFilename)
 		if err != nil {
-			dl.logger.Print("Error opening downloaded chunk file:", err.Error())
+			dl.log(entry).Error("Error opening downloaded chunk file", "chunk", i, "error", err)
+			return err
+		}
+
+		_, err = io.Copy(file, tmpFile)
+		tmpFile.Close()
+
+		if err != nil {
+			dl.log(entry).Error("Error copying chunk file into actual file", "chunk", i, "error", err)
 			return err
 		}
 
-		if _, err := io.Copy(file, tmpFile); err != nil {
-			dl.logger.Print("Error copying chunk file into actual file:", err.Error())
+		// the chunk can only be removed once it is on the disk, otherwise it is lost when the process dies
+		if err := file.Sync(); err != nil {
+			dl.log(entry).Error("Error syncing downloaded file", "location", part, "error", err)
 			return err
 		}
 
 		if err := os.Remove(tmpFilename); err != nil {
-			dl.logger.Print("Error removing temp file:", err.Error())
+			dl.log(entry).Error("Error removing temp file", "chunk", i, "error", err)
 			return err
 		}
 	}
 
+	// the directory of the entry is empty once every chunk is combined
+	os.Remove(chunkDir(dl.setting, entry.ID()))
 	return nil
 }
 
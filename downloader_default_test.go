@@ -1,10 +1,9 @@
 package rapid
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"os"
-	"path/filepath"
 	"testing"
 	"time"
 )
@@ -85,7 +84,7 @@ func TestStopDownloadLocalOneChunkSuccess(t *testing.T) {
 	}
 
 	go func() {
-		if err := downloader.Download(entry); err != nil {
+		if err := downloader.Download(entry); err != nil && !errors.Is(err, ErrPaused) {
 			t.Error("Error downloading dummy video:", err.Error())
 		}
 	}()
@@ -99,7 +98,7 @@ func TestStopDownloadLocalOneChunkSuccess(t *testing.T) {
 	setting := DefaultSetting()
 
 	for i := 0; i < entry.ChunkLen(); i++ {
-		chunkfile := filepath.Join(setting.DownloadLocation(), fmt.Sprintf("%s-%d", entry.ID(), i))
+		chunkfile := chunkPath(setting, entry.ID(), i)
 		if err := os.Remove(chunkfile); err != nil {
 			t.Error("Error removing chunk file")
 		}
@@ -121,7 +120,7 @@ func TestStopDownloadLocalMultipleChunkSuccess(t *testing.T) {
 	}
 
 	go func() {
-		if err := downloader.Download(entry); err != nil {
+		if err := downloader.Download(entry); err != nil && !errors.Is(err, ErrPaused) {
 			t.Error("Error downloading dummy video:", err.Error())
 		}
 	}()
@@ -135,7 +134,7 @@ func TestStopDownloadLocalMultipleChunkSuccess(t *testing.T) {
 	setting := DefaultSetting()
 
 	for i := 0; i < entry.ChunkLen(); i++ {
-		chunkfile := filepath.Join(setting.DownloadLocation(), fmt.Sprintf("%s-%d", entry.ID(), i))
+		chunkfile := chunkPath(setting, entry.ID(), i)
 		if err := os.Remove(chunkfile); err != nil {
 			t.Error("Error removing chunk file")
 		}
@@ -157,7 +156,7 @@ func TestStopDownloadLocalResumeSuccess(t *testing.T) {
 	}
 
 	go func() {
-		if err := downloader.Download(entry); err != nil {
+		if err := downloader.Download(entry); err != nil && !errors.Is(err, ErrPaused) {
 			t.Error("Error downloading dummy video:", err.Error())
 		}
 	}()
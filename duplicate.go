@@ -0,0 +1,298 @@
+package rapid
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// DuplicatePolicy decides what to do when the file of an entry already exists in its location
+	DuplicatePolicy int
+
+	// EntryDuplicate is implemented by entry which has its own duplicate policy
+	EntryDuplicate interface {
+		DuplicatePolicy() DuplicatePolicy
+	}
+
+	// checksum is the hash of the remote file that is announced by the server
+	checksum struct {
+		algorithm string
+		sum       []byte
+	}
+)
+
+const (
+	// DuplicateRename will rename the file into "name (1).ext"
+	DuplicateRename DuplicatePolicy = iota
+
+	// DuplicateOverwrite will replace the existing file
+	DuplicateOverwrite
+
+	// DuplicateSkip will skip the download if the existing file is identical, otherwise it will be renamed
+	DuplicateSkip
+
+	// DuplicateResume will continue the download from the existing partial file, otherwise it will be renamed
+	DuplicateResume
+
+	// DuplicateFail will fail the download
+	DuplicateFail
+)
+
+var ErrDuplicate = fmt.Errorf("file already exists")
+
+var duplicateNumberRegex = regexp.MustCompile(`^(.*) \((\d+)\)$`)
+
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateRename:
+		return "rename"
+	case DuplicateOverwrite:
+		return "overwrite"
+	case DuplicateSkip:
+		return "skip"
+	case DuplicateResume:
+		return "resume"
+	case DuplicateFail:
+		return "fail"
+	}
+
+	return "unknown"
+}
+
+// ParseDuplicatePolicy parses the name of a policy, e.g rename, overwrite, skip, resume, or fail
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	for _, policy := range []DuplicatePolicy{DuplicateRename, DuplicateOverwrite, DuplicateSkip, DuplicateResume, DuplicateFail} {
+		if strings.EqualFold(name, policy.String()) {
+			return policy, nil
+		}
+	}
+
+	return DuplicateRename, fmt.Errorf("unknown duplicate policy %s", name)
+}
+
+// SetDuplicatePolicy overrides the duplicate policy of the setting for the entry
+func SetDuplicatePolicy(policy DuplicatePolicy) EntryOptions {
+	return func(o *entryOption) {
+		o.duplicate = &policy
+	}
+}
+
+// duplicatePolicy returns the policy of the entry, or the policy of the setting if the entry has none
+func duplicatePolicy(entry Entry, setting Setting) DuplicatePolicy {
+	if duplicate, ok := entry.(EntryDuplicate); ok {
+		return duplicate.DuplicatePolicy()
+	}
+
+	return setting.DuplicatePolicy()
+}
+
+// entryChecksum returns the checksum of the remote file which is announced when the entry is fetched
+func entryChecksum(entry Entry) checksum {
+	if e, ok := entry.(interface{ checksum() checksum }); ok {
+		return e.checksum()
+	}
+
+	return checksum{}
+}
+
+// handleDuplicate adds or increments the number of the filename until there is no file with the same name
+func handleDuplicate(filename string) string {
+	if _, err := os.Stat(filename); err != nil {
+		return filename
+	}
+
+	dir, base := filepath.Split(filename)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	number := 1
+	if match := duplicateNumberRegex.FindStringSubmatch(stem); match != nil {
+		if n, err := strconv.Atoi(match[2]); err == nil {
+			stem = match[1]
+			number = n + 1
+		}
+	}
+
+	for {
+		name := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, number, ext))
+		if _, err := os.Stat(name); err != nil {
+			return name
+		}
+
+		number++
+	}
+}
+
+// resolveDuplicate returns the location that should be used by the file according to the policy,
+// and whether the download can be skipped because the existing file is identical
+func resolveDuplicate(location string, policy DuplicatePolicy, size int64, resumable bool, sum checksum) (string, bool, error) {
+	stat, err := os.Stat(location)
+	if err != nil {
+		return location, false, nil
+	}
+
+	switch policy {
+	case DuplicateOverwrite:
+		return location, false, nil
+	case DuplicateFail:
+		return location, false, ErrDuplicate
+	case DuplicateSkip:
+		if identical(location, size, sum) {
+			return location, true, nil
+		}
+	case DuplicateResume:
+		if identical(location, size, sum) {
+			return location, true, nil
+		}
+
+		if resumable && stat.Mode().IsRegular() && stat.Size() < size {
+			return location, false, nil
+		}
+	}
+
+	return handleDuplicate(location), false, nil
+}
+
+// identical checks whether the existing file has the same size and checksum as the remote file
+func identical(location string, size int64, sum checksum) bool {
+	stat, err := os.Stat(location)
+	if err != nil || !stat.Mode().IsRegular() {
+		return false
+	}
+
+	if size <= 0 || stat.Size() != size {
+		return false
+	}
+
+	if sum.algorithm == "" {
+		return true
+	}
+
+	local, err := fileChecksum(location, sum.algorithm)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(local, sum.sum)
+}
+
+func fileChecksum(location string, algorithm string) ([]byte, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha-256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("checksum %s is not supported", algorithm)
+	}
+
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+var md5EtagRegex = regexp.MustCompile(`^"?([0-9a-fA-F]{32})"?$`)
+
+// remoteChecksum reads the checksum of the file from the Digest, Repr-Digest, Content-MD5, or the ETag that looks like md5
+func remoteChecksum(r *http.Response) checksum {
+	for _, header := range []string{"Repr-Digest", "Digest"} {
+		for _, digest := range strings.Split(r.Header.Get(header), ",") {
+			algorithm, value, ok := strings.Cut(strings.TrimSpace(digest), "=")
+			if !ok {
+				continue
+			}
+
+			algorithm = strings.ToLower(algorithm)
+			if algorithm != "md5" && algorithm != "sha-256" {
+				continue
+			}
+
+			if sum, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":")); err == nil {
+				return checksum{algorithm: algorithm, sum: sum}
+			}
+		}
+	}
+
+	if sum, err := base64.StdEncoding.DecodeString(r.Header.Get("Content-MD5")); err == nil && len(sum) == md5.Size {
+		return checksum{algorithm: "md5", sum: sum}
+	}
+
+	if match := md5EtagRegex.FindStringSubmatch(r.Header.Get("ETag")); match != nil {
+		if sum, err := hex.DecodeString(match[1]); err == nil {
+			return checksum{algorithm: "md5", sum: sum}
+		}
+	}
+
+	return checksum{}
+}
+
+// seedPartial copies the partial file that already exists in the location of the entry into its chunk files,
+// so the download can be continued from it
+func seedPartial(entry Entry, setting Setting) error {
+	file, err := os.Open(entry.Location())
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil || stat.Size() >= entry.Size() {
+		return nil
+	}
+
+	if err := os.MkdirAll(chunkDir(setting, entry.ID()), os.ModePerm); err != nil {
+		return err
+	}
+
+	chunkSize := entry.Size() / int64(entry.ChunkLen())
+	for i := 0; i < entry.ChunkLen(); i++ {
+		start, end := calculatePosition(entry, chunkSize, i)
+		if start >= stat.Size() {
+			break
+		}
+
+		path := chunkPath(setting, entry.ID(), i)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		end = min(end+1, stat.Size())
+		if err := copyPartial(file, path, start, end-start); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyPartial(src *os.File, path string, offset int64, size int64) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, io.NewSectionReader(src, offset, size))
+	return err
+}
@@ -0,0 +1,177 @@
+package rapid
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandleDuplicateParentheses(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "v1.0 (beta)")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal("Error creating folder:", err.Error())
+	}
+
+	testCases := map[string]string{
+		"report (final).pdf": "report (final) (1).pdf",
+		"report (2).pdf":     "report (3).pdf",
+		"archive.tar.gz":     "archive.tar (1).gz",
+		"README":             "README (1)",
+	}
+
+	for name, expected := range testCases {
+		t.Run(name, func(t *testing.T) {
+			location := filepath.Join(dir, name)
+			if _, err := os.Create(location); err != nil {
+				t.Fatal("Error creating file:", err.Error())
+			}
+
+			if result := handleDuplicate(location); result != filepath.Join(dir, expected) {
+				t.Errorf("Expected name to be %s, but got %s", filepath.Join(dir, expected), result)
+			}
+		})
+	}
+}
+
+func TestResolveDuplicate(t *testing.T) {
+	content := []byte("rapid")
+	sum := md5.Sum(content)
+
+	location := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(location, content, 0644); err != nil {
+		t.Fatal("Error creating file:", err.Error())
+	}
+
+	renamed := handleDuplicate(location)
+
+	testCases := []struct {
+		name     string
+		policy   DuplicatePolicy
+		size     int64
+		sum      checksum
+		location string
+		skip     bool
+		err      error
+	}{
+		{"rename", DuplicateRename, 5, checksum{}, renamed, false, nil},
+		{"overwrite", DuplicateOverwrite, 5, checksum{}, location, false, nil},
+		{"fail", DuplicateFail, 5, checksum{}, location, false, ErrDuplicate},
+		{"skip identical", DuplicateSkip, 5, checksum{"md5", sum[:]}, location, true, nil},
+		{"skip different size", DuplicateSkip, 10, checksum{}, renamed, false, nil},
+		{"skip different hash", DuplicateSkip, 5, checksum{"md5", make([]byte, md5.Size)}, renamed, false, nil},
+		{"resume partial", DuplicateResume, 10, checksum{}, location, false, nil},
+		{"resume bigger", DuplicateResume, 2, checksum{}, renamed, false, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, skip, err := resolveDuplicate(location, tc.policy, tc.size, true, tc.sum)
+			if err != tc.err {
+				t.Errorf("Expected error to be %v, but got %v", tc.err, err)
+			}
+
+			if result != tc.location {
+				t.Errorf("Expected location to be %s, but got %s", tc.location, result)
+			}
+
+			if skip != tc.skip {
+				t.Errorf("Expected skip to be %v, but got %v", tc.skip, skip)
+			}
+		})
+	}
+}
+
+func TestRemoteChecksum(t *testing.T) {
+	sum := md5.Sum([]byte("rapid"))
+
+	testCases := map[string]http.Header{
+		"etag":        {"Etag": {`"` + hex.EncodeToString(sum[:]) + `"`}},
+		"content-md5": {"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}},
+		"digest":      {"Digest": {"md5=" + base64.StdEncoding.EncodeToString(sum[:])}},
+	}
+
+	for name, header := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := remoteChecksum(&http.Response{Header: header})
+			if result.algorithm != "md5" || !bytes.Equal(result.sum, sum[:]) {
+				t.Errorf("Expected md5 checksum to be %x, but got %s %x", sum, result.algorithm, result.sum)
+			}
+		})
+	}
+
+	weak := remoteChecksum(&http.Response{Header: http.Header{"Etag": {`W/"abc"`}}})
+	if weak.algorithm != "" {
+		t.Errorf("Expected weak etag not to be a checksum, but got %s", weak.algorithm)
+	}
+}
+
+func TestDownloadDuplicateResume(t *testing.T) {
+	setting := testSetting(t)
+	content := bytes.Repeat([]byte("0123456789"), 1024)
+	server := testServer(t, content)
+
+	location := filepath.Join(setting.DownloadLocation(), "file.bin")
+	if err := os.WriteFile(location, content[:3000], 0644); err != nil {
+		t.Fatal("Error creating partial file:", err.Error())
+	}
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetDuplicatePolicy(DuplicateResume))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	if entry.Location() != location {
+		t.Fatalf("Expected location to be %s, but got %s", location, entry.Location())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	result, err := os.ReadFile(location)
+	if err != nil {
+		t.Fatal("Error reading file:", err.Error())
+	}
+
+	if !bytes.Equal(result, content) {
+		t.Errorf("Expected resumed file to be equal to the remote file, got %d bytes", len(result))
+	}
+}
+
+func TestDownloadDuplicateClaimedWhileRunning(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, []byte("rapid"))
+
+	entry, err := Fetch(server.URL+"/file.txt", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	// another download claims the name before this one is merged
+	claimed := entry.Location()
+	downloader := NewDownloader(DownloaderDefault,
+		SetDownloaderSetting(setting),
+		OnBeforeCreate(func(entry Entry, location string) (string, error) {
+			return location, os.WriteFile(claimed, []byte("other"), 0644)
+		}),
+	)
+
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	expected := filepath.Join(setting.DownloadLocation(), "file (1).txt")
+	if entry.Location() != expected {
+		t.Errorf("Expected location to be %s, but got %s", expected, entry.Location())
+	}
+
+	if content, _ := os.ReadFile(claimed); string(content) != "other" {
+		t.Errorf("Expected claimed file not to be overwritten, but got %s", content)
+	}
+}
@@ -3,16 +3,15 @@ package rapid
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"math"
+	"io"
 	"math/rand"
-	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -36,7 +35,18 @@ type (
 		Cookies() []*http.Cookie
 	}
 
+	// EntryHeaders is implemented by entry which has custom headers to be sent on every request
+	EntryHeaders interface {
+		Headers() http.Header
+	}
+
+	// EntryRelocator is implemented by entry which location can be changed after it is fetched
+	EntryRelocator interface {
+		Relocate(location string)
+	}
+
 	entry struct {
+		mu        sync.RWMutex // guards the location and the context, which are changed while the entry is downloaded
 		id        string
 		name      string
 		location  string
@@ -49,11 +59,42 @@ type (
 		ctx       context.Context
 		cancel    context.CancelFunc
 		cookies   []*http.Cookie
+		headers   http.Header
+		duplicate DuplicatePolicy
+		sum       checksum
+		verify    bool // the checksum is given by the user, so the downloaded file must match it
+		state     State
+		priority  Priority
+	}
+
+	// entryJSON is the representation of an entry when it is saved
+	entryJSON struct {
+		ID        string          `json:"id"`
+		Name      string          `json:"name"`
+		Location  string          `json:"location"`
+		Size      int64           `json:"size"`
+		Type      string          `json:"type"`
+		URL       string          `json:"url"`
+		ChunkLen  int             `json:"chunkLen"`
+		Resumable bool            `json:"resumable"`
+		Cookies   []*http.Cookie  `json:"cookies,omitempty"`
+		Headers   http.Header     `json:"headers,omitempty"`
+		Duplicate DuplicatePolicy `json:"duplicate"`
+		Checksum  string          `json:"checksum,omitempty"`
+		Verify    bool            `json:"verify,omitempty"`
+		State     State           `json:"state,omitempty"`
+		Priority  Priority        `json:"priority,omitempty"`
 	}
 
 	entryOption struct {
-		setting Setting
-		cookies []*http.Cookie
+		ctx       context.Context
+		setting   Setting
+		cookies   []*http.Cookie
+		headers   http.Header
+		duplicate *DuplicatePolicy
+		sum       *checksum
+		partition PartitionStrategy
+		priority  Priority
 	}
 
 	EntryOptions func(o *entryOption)
@@ -65,12 +106,50 @@ func SetEntrySetting(setting Setting) EntryOptions {
 	}
 }
 
+// SetEntryContext sets the context of fetching the url, so the fetch can be cancelled or time out
+func SetEntryContext(ctx context.Context) EntryOptions {
+	return func(o *entryOption) {
+		o.ctx = ctx
+	}
+}
+
 func AddCookies(cookies []*http.Cookie) EntryOptions {
 	return func(o *entryOption) {
 		o.cookies = cookies
 	}
 }
 
+// SetEntryPriority sets how much of the shared connections the entry gets compared to the other entries
+func SetEntryPriority(priority Priority) EntryOptions {
+	return func(o *entryOption) {
+		o.priority = priority
+	}
+}
+
+// AddHeaders adds custom headers, e.g Authorization or Referer, into every request of the entry
+func AddHeaders(headers http.Header) EntryOptions {
+	return func(o *entryOption) {
+		o.headers = headers
+	}
+}
+
+// prepareRequest adds the headers and cookies of the entry into the request
+func prepareRequest(req *http.Request, e Entry) {
+	if entryHeaders, ok := e.(EntryHeaders); ok {
+		for key, values := range entryHeaders.Headers() {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+
+	if entryCookie, ok := e.(EntryCookies); ok {
+		for _, cookie := range entryCookie.Cookies() {
+			req.AddCookie(cookie)
+		}
+	}
+}
+
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 const (
 	letterIdxBits = 6                    // 6 bits to represent a letter index
@@ -100,148 +179,105 @@ func randID(n int) string {
 	return sb.String()
 }
 
-func handleDuplicate(filename string) string {
-	name := filename
-	if _, err := os.Stat(filename); err != nil {
-		return name
-	}
-
-	regex, err := regexp.Compile(`\((.*?)\)`)
-	if err != nil { // if there is no number prefix
-		return name
-	}
-
-	prefix := regex.FindStringSubmatch(name)
-	if len(prefix) == 0 {
-		// add number before ext of a file if there is none
-		split := strings.Split(name, ".")
-		if len(split) > 2 {
-			split[len(split)-2] += " (1)"
-		} else {
-			split[0] += " (1)"
-		}
-
-		// re-check if the current name has duplication
-		name = strings.Join(split, ".")
-		name = handleDuplicate(name)
-		return name
-	}
-
-	// if it's still has, add the number
-	name = strings.ReplaceAll(name, " "+prefix[0], "")
-	number, err := strconv.Atoi(prefix[1])
-	if err != nil {
-		return name
-	}
-	split := strings.Split(name, ".")
-	if len(split) > 2 {
-		split[len(split)-2] += " (" + strconv.Itoa(number+1) + ")"
-	} else {
-		split[0] += " (" + strconv.Itoa(number+1) + ")"
-	}
-
-	// re-check if the current name has duplication
-	name = strings.Join(split, ".")
-	name = handleDuplicate(name)
-
-	return name
-}
-
 func resumable(r *http.Response) bool {
 	acceptRanges := r.Header.Get("Accept-Ranges")
 	return acceptRanges != "" || acceptRanges == "bytes"
 }
 
-func filename(r *http.Response) string {
-	disposition := r.Header.Get("Content-Disposition")
-	_, params, _ := mime.ParseMediaType(disposition)
+var errBadResponse = fmt.Errorf("bad response")
 
-	filename, ok := params["filename"]
-	if ok {
-		return filename
+func Fetch(url string, options ...EntryOptions) (Entry, error) {
+	opt := &entryOption{
+		ctx:      context.Background(),
+		setting:  DefaultSetting(),
+		priority: PriorityNormal,
 	}
 
-	urlPath := r.Request.URL.Path
-	if i := strings.LastIndex(urlPath, "/"); i != -1 {
-		return urlPath[i+1:]
+	for _, option := range options {
+		option(opt)
 	}
 
-	return "file"
-}
+	logger := NewLogger(opt.setting).With("url", url)
+	logger.Debug("Fetching url")
 
-// calculatePartition calculates how many chunks will be for certain size
-func calculatePartition(size int64, setting Setting) int {
-	if size == -1 {
-		return 1
+	req, err := http.NewRequestWithContext(opt.ctx, "GET", url, nil)
+	if err != nil {
+		logger.Error("Error preparing request", "error", err)
+		return nil, err
 	}
 
-	if size < setting.MinChunkSize() {
-		return 1
+	prepareRequest(req, &entry{cookies: opt.cookies, headers: opt.headers})
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Error("Error fetching url", "error", err)
+		return nil, err
 	}
 
-	total := math.Log10(float64(size / (1024 * 1024)))
-	partsize := setting.MinChunkSize()
+	defer res.Body.Close()
 
-	// dampening the total partition based on digit figures, e.g 100 -> 3 digits
-	for i := 0; i < int(total); i++ {
-		partsize *= int64(total) + 1
+	if res.StatusCode >= http.StatusBadRequest {
+		logger.Error("Error fetching url", "status", res.Status)
+		return nil, fmt.Errorf("%w: %s", errBadResponse, res.Status)
 	}
 
-	return int(size / partsize)
-
-}
+	// the response body is the beginning of the first chunk, so its magic bytes can tell the file type
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(res.Body, head)
 
-func Fetch(url string, options ...EntryOptions) (Entry, error) {
-	opt := &entryOption{
-		setting: DefaultSetting(),
+	resumable := resumable(res)
+	filename := filename(res)
+	filetype := detectFiletype(filename, res.Header.Get("Content-Type"), head[:n])
+	sum := remoteChecksum(res)
+	if opt.sum != nil {
+		sum = *opt.sum
 	}
 
-	for _, option := range options {
-		option(opt)
+	duplicate := opt.setting.DuplicatePolicy()
+	if opt.duplicate != nil {
+		duplicate = *opt.duplicate
 	}
 
-	logger := NewLogger(opt.setting)
-	logger.Print("Fetching url...")
-
-	req, err := http.NewRequest("GET", url, nil)
+	location := safeJoin(opt.setting.CategoryLocation(filetype), filename)
+	location, _, err = resolveDuplicate(location, duplicate, res.ContentLength, resumable, sum)
 	if err != nil {
-		logger.Print("Error preparing request:", err.Error())
+		logger.Error("Error resolving duplicate file", "location", location, "error", err)
 		return nil, err
 	}
 
-	for _, cookie := range opt.cookies {
-		req.AddCookie(cookie)
-	}
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		logger.Print("Error fetching url:", err.Error())
+	filename = filepath.Base(location)
+	ctx, cancel := context.WithCancel(context.Background())
+	partition := opt.setting.PartitionStrategy()
+	if opt.partition != nil {
+		partition = opt.partition
 	}
 
-	resumable := resumable(res)
-	filename := handleDuplicate(filename(res))
-	location := filepath.Join(opt.setting.DownloadLocation(), filename)
-	filetype := filetype(filename)
-	ctx, cancel := context.WithCancel(context.Background())
-	chunklen := calculatePartition(res.ContentLength, opt.setting)
+	chunklen := calculatePartition(res.ContentLength, partitionForHost(partition, hostOf(url)), opt.setting)
 
 	if !resumable {
 		chunklen = 1
 	}
 
+	id := randID(10)
+
 	return &entry{
-		id:        randID(10),
+		id:        id,
 		name:      filename,
 		location:  location,
 		filetype:  filetype,
 		url:       url,
 		size:      res.ContentLength,
-		logger:    logger,
+		logger:    logger.With("entry", id),
 		chunkLen:  chunklen,
 		ctx:       ctx,
 		cancel:    cancel,
 		resumable: resumable,
 		cookies:   opt.cookies,
+		headers:   opt.headers,
+		duplicate: duplicate,
+		sum:       sum,
+		verify:    opt.sum != nil,
+		priority:  opt.priority,
 	}, nil
 }
 
@@ -250,13 +286,27 @@ func (e *entry) ID() string {
 }
 
 func (e *entry) Name() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.name
 }
 
 func (e *entry) Location() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.location
 }
 
+func (e *entry) Relocate(location string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.location = location
+	e.name = filepath.Base(location)
+}
+
 func (e *entry) Size() int64 {
 	return e.size
 }
@@ -278,37 +328,89 @@ func (e *entry) Resumable() bool {
 }
 
 func (e *entry) Context() context.Context {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.ctx
 }
 
 func (e *entry) Cancel() {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	e.cancel()
 }
 
-func (e *entry) Expired() bool {
-	req, err := http.NewRequest("HEAD", e.url, nil)
+func (e *entry) State() State {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	if len(e.cookies) > 0 {
-		for _, cookie := range e.cookies {
-			req.AddCookie(cookie)
-		}
+	if e.state == "" {
+		return StatePending
+	}
+
+	return e.state
+}
+
+func (e *entry) Transition(state State) (State, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	from := e.state
+	if from == "" {
+		from = StatePending
+	}
+
+	if from != state && !canTransition(from, state) {
+		return from, fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, from, state)
 	}
 
+	e.state = state
+	return from, nil
+}
+
+func (e *entry) Priority() Priority {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.priority == "" {
+		return PriorityNormal
+	}
+
+	return e.priority
+}
+
+func (e *entry) Prioritize(priority Priority) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.priority = priority
+}
+
+func (e *entry) Expired() bool {
+	req, err := http.NewRequest("HEAD", e.url, nil)
 	if err != nil {
-		e.logger.Print("Could not prepare for checking url expiration:", err.Error())
+		e.logger.Error("Could not prepare for checking url expiration", "error", err)
 		return true
 	}
 
+	prepareRequest(req, e)
+
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		e.logger.Print("Error checking url expiration:", err.Error())
+		e.logger.Error("Error checking url expiration", "error", err)
+		return true
 	}
+	defer res.Body.Close()
 
 	return res.StatusCode != http.StatusOK && res.ContentLength <= 0
 }
 
 func (e *entry) Refresh() error {
+	e.mu.Lock()
 	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.mu.Unlock()
+
 	// TODO: do something else, such as refresh the link (future feature if browser extenstion is present)
 
 	return nil
@@ -318,8 +420,8 @@ func (e *entry) String() string {
 	var buffer bytes.Buffer
 
 	buffer.WriteString(fmt.Sprintf("ID: %v\n", e.id))
-	buffer.WriteString(fmt.Sprintf("Name: %v\n", e.name))
-	buffer.WriteString(fmt.Sprintf("Location: %v\n", e.location))
+	buffer.WriteString(fmt.Sprintf("Name: %v\n", e.Name()))
+	buffer.WriteString(fmt.Sprintf("Location: %v\n", e.Location()))
 	buffer.WriteString(fmt.Sprintf("Size: %v\n", e.size))
 	buffer.WriteString(fmt.Sprintf("Filetype: %v\n", e.filetype))
 	buffer.WriteString(fmt.Sprintf("URL: %v\n", e.url))
@@ -330,6 +432,83 @@ func (e *entry) String() string {
 	return buffer.String()
 }
 
+func (e *entry) MarshalJSON() ([]byte, error) {
+	sum := ""
+	if e.sum.algorithm != "" {
+		sum = e.sum.algorithm + ":" + hex.EncodeToString(e.sum.sum)
+	}
+
+	return json.Marshal(entryJSON{
+		ID:        e.id,
+		Name:      e.Name(),
+		Location:  e.Location(),
+		Size:      e.size,
+		Type:      e.filetype,
+		URL:       e.url,
+		ChunkLen:  e.chunkLen,
+		Resumable: e.resumable,
+		Cookies:   e.cookies,
+		Headers:   e.headers,
+		Duplicate: e.duplicate,
+		Checksum:  sum,
+		Verify:    e.verify,
+		State:     e.State(),
+		Priority:  e.Priority(),
+	})
+}
+
+func (e *entry) UnmarshalJSON(data []byte) error {
+	var v entryJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	e.id = v.ID
+	e.name = v.Name
+	e.location = v.Location
+	e.size = v.Size
+	e.filetype = v.Type
+	e.url = v.URL
+	e.chunkLen = v.ChunkLen
+	e.resumable = v.Resumable
+	e.cookies = v.Cookies
+	e.headers = v.Headers
+	e.duplicate = v.Duplicate
+	e.verify = v.Verify
+	e.state = v.State
+	e.priority = v.Priority
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	// the entry which is saved while it is downloaded is stopped by the process that died, so it can only be resumed
+	if e.state.active() {
+		e.state = StatePaused
+	}
+
+	if algorithm, sum, ok := strings.Cut(v.Checksum, ":"); ok {
+		if decoded, err := hex.DecodeString(sum); err == nil {
+			e.sum = checksum{algorithm: algorithm, sum: decoded}
+		}
+	}
+
+	return nil
+}
+
 func (e *entry) Cookies() []*http.Cookie {
 	return e.cookies
 }
+
+func (e *entry) Headers() http.Header {
+	return e.headers
+}
+
+func (e *entry) DuplicatePolicy() DuplicatePolicy {
+	return e.duplicate
+}
+
+func (e *entry) checksum() checksum {
+	return e.sum
+}
+
+func (e *entry) verifyChecksum() bool {
+	return e.verify
+}
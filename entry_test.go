@@ -188,3 +188,69 @@ func TestCalculatePartitionMoreOneChunkLen(t *testing.T) {
 		t.Error("Chunk length expected to be more than one, but got", entry.ChunkLen())
 	}
 }
+
+func TestCategoryLocationExpandHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	builder := NewSettingBuilder().DataLocation(t.TempDir()).CategoryLocation("Video", "~/Downloads/Video")
+	setting, err := builder.Build()
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	if location := setting.CategoryLocation("Video"); location != filepath.Join(home, "Downloads", "Video") {
+		t.Errorf("Expected the home directory to be expanded, got %s", location)
+	}
+
+	if location := builder.setting.categoryLocations["Video"]; location != "~/Downloads/Video" {
+		t.Errorf("Expected the location of the builder to be left as it is, got %s", location)
+	}
+}
+
+func TestFetchCategoryLocation(t *testing.T) {
+	videos := filepath.Join(t.TempDir(), "Video")
+	setting := testSetting(t).(*settings)
+	setting.categoryLocations = map[string]string{"Video": videos}
+
+	server := testServer(t, []byte("rapid"))
+
+	entry, err := Fetch(server.URL+"/movie.mp4", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	expected := filepath.Join(videos, "movie.mp4")
+	if entry.Location() != expected {
+		t.Errorf("Expected location to be %s, but got %s", expected, entry.Location())
+	}
+
+	// duplicate should be checked against the category location
+	if err := os.MkdirAll(videos, os.ModePerm); err != nil {
+		t.Fatal("Error creating folder:", err.Error())
+	}
+
+	if _, err := os.Create(expected); err != nil {
+		t.Fatal("Error creating file:", err.Error())
+	}
+
+	entry, err = Fetch(server.URL+"/movie.mp4", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	expected = filepath.Join(videos, "movie (1).mp4")
+	if entry.Location() != expected || entry.Name() != "movie (1).mp4" {
+		t.Errorf("Expected location to be %s, but got %s", expected, entry.Location())
+	}
+
+	entry, err = Fetch(server.URL+"/document.pdf", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	expected = filepath.Join(setting.DownloadLocation(), "document.pdf")
+	if entry.Location() != expected {
+		t.Errorf("Expected location to be %s, but got %s", expected, entry.Location())
+	}
+}
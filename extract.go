@@ -0,0 +1,408 @@
+package rapid
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type (
+	// extractor extracts the archive into the destination directory of the extraction
+	extractor func(archive *os.File, ex *extraction) error
+
+	extractOption struct {
+		maxSize       int64   // maximum total size in bytes of the extracted files
+		maxRatio      float64 // maximum ratio between the extracted size and the archive size
+		maxFiles      int     // maximum number of extracted files
+		removeArchive bool
+	}
+
+	ExtractOptions func(o *extractOption)
+
+	extraction struct {
+		*extractOption
+		entry      Entry
+		dst        string
+		size       int64 // size of the archive
+		total      int64 // expected size of the extracted files, zero if unknown
+		consumed   int64 // bytes of the archive that is already read
+		written    int64
+		files      int
+		onprogress OnProgress
+	}
+
+	// countingReader counts how many bytes of the archive is consumed for reporting the progress
+	countingReader struct {
+		reader io.Reader
+		ex     *extraction
+	}
+)
+
+// ExtractIndex is the chunk index reported to OnProgress while an entry is being extracted
+const ExtractIndex = -1
+
+var (
+	errExtractSize     = fmt.Errorf("extracted size exceeds the limit")
+	errExtractRatio    = fmt.Errorf("compression ratio exceeds the limit")
+	errExtractFiles    = fmt.Errorf("extracted files exceed the limit")
+	errExtractPath     = fmt.Errorf("archive contains illegal file path")
+	errExtractNotFound = fmt.Errorf("archive format is not supported")
+)
+
+// AutoExtract will extract the compressed entry into a folder next to it after being downloaded
+func AutoExtract(options ...ExtractOptions) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.extract = &extractOption{
+			maxSize:  1024 * 1024 * 1024 * 10, // 10 GB
+			maxRatio: 100,
+			maxFiles: 10000,
+		}
+
+		for _, option := range options {
+			option(o.extract)
+		}
+	}
+}
+
+// ExtractMaxSize sets the maximum total size in bytes of the extracted files
+func ExtractMaxSize(size int64) ExtractOptions {
+	return func(o *extractOption) {
+		o.maxSize = size
+	}
+}
+
+// ExtractMaxRatio sets the maximum ratio between the extracted size and the archive size
+func ExtractMaxRatio(ratio float64) ExtractOptions {
+	return func(o *extractOption) {
+		o.maxRatio = ratio
+	}
+}
+
+// ExtractMaxFiles sets the maximum number of files that can be extracted from an archive
+func ExtractMaxFiles(files int) ExtractOptions {
+	return func(o *extractOption) {
+		o.maxFiles = files
+	}
+}
+
+// RemoveArchive will remove the archive after it is extracted successfully
+func RemoveArchive() ExtractOptions {
+	return func(o *extractOption) {
+		o.removeArchive = true
+	}
+}
+
+var extractorMap = map[string]extractor{
+	".zip":     extractZip,
+	".tar":     extractTar(nil),
+	".tar.gz":  extractTar(gzipReader),
+	".tgz":     extractTar(gzipReader),
+	".tar.bz2": extractTar(bzip2Reader),
+	".tbz2":    extractTar(bzip2Reader),
+	".tar.xz":  extractTar(xzReader),
+	".txz":     extractTar(xzReader),
+	".tar.zst": extractTar(zstdReader),
+	".tzst":    extractTar(zstdReader),
+	".zst":     extractSingle(zstdReader),
+	".zstd":    extractSingle(zstdReader),
+}
+
+// archiveExt returns the longest extension of the filename that has an extractor
+func archiveExt(filename string) string {
+	filename = strings.ToLower(filename)
+
+	ext := ""
+	for name := range extractorMap {
+		if strings.HasSuffix(filename, name) && len(name) > len(ext) {
+			ext = name
+		}
+	}
+
+	return ext
+}
+
+// extract will extract the archive into a folder next to it
+func extract(entry Entry, opt *extractOption, onprogress OnProgress) (string, error) {
+	ext := archiveExt(entry.Location())
+	extractor, ok := extractorMap[ext]
+	if !ok {
+		return "", errExtractNotFound
+	}
+
+	archive, err := os.Open(entry.Location())
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	stat, err := archive.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	location := entry.Location()
+	dst := handleDuplicate(location[:len(location)-len(ext)])
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	ex := &extraction{
+		extractOption: opt,
+		entry:         entry,
+		dst:           dst,
+		size:          stat.Size(),
+		onprogress:    onprogress,
+	}
+
+	if err := extractor(archive, ex); err != nil {
+		os.RemoveAll(dst)
+		return "", err
+	}
+
+	archive.Close()
+	if opt.removeArchive {
+		if err := os.Remove(entry.Location()); err != nil {
+			return dst, err
+		}
+	}
+
+	return dst, nil
+}
+
+// path returns the location of a file inside the destination and makes sure it does not escape from it
+func (ex *extraction) path(name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", errExtractPath
+	}
+
+	path := filepath.Join(ex.dst, name)
+	if path != ex.dst && !strings.HasPrefix(path, ex.dst+string(filepath.Separator)) {
+		return "", errExtractPath
+	}
+
+	return path, nil
+}
+
+func (ex *extraction) Write(payload []byte) (int, error) {
+	ex.written += int64(len(payload))
+	if ex.maxSize > 0 && ex.written > ex.maxSize {
+		return 0, errExtractSize
+	}
+
+	// small archive can have huge ratio without being harmful, so only check them after a while
+	if ex.maxRatio > 0 && ex.written > 1024*1024 && float64(ex.written)/float64(ex.size) > ex.maxRatio {
+		return 0, errExtractRatio
+	}
+
+	ex.progress()
+	return len(payload), nil
+}
+
+func (ex *extraction) progress() {
+	if ex.onprogress == nil {
+		return
+	}
+
+	progress := float64(0)
+	if ex.total > 0 {
+		progress = float64(100 * ex.written / ex.total)
+	} else if ex.size > 0 {
+		progress = float64(100 * ex.consumed / ex.size)
+	}
+
+	ex.onprogress(
+		ex.entry.ID(),
+		ExtractIndex,
+		ex.written,
+		progress,
+	)
+}
+
+func (r *countingReader) Read(payload []byte) (int, error) {
+	n, err := r.reader.Read(payload)
+	r.ex.consumed += int64(n)
+
+	return n, err
+}
+
+func (ex *extraction) mkdir(name string) error {
+	path, err := ex.path(name)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(path, os.ModePerm)
+}
+
+// create will write the content of the reader into a file inside the destination
+func (ex *extraction) create(name string, mode os.FileMode, reader io.Reader) error {
+	ex.files++
+	if ex.maxFiles > 0 && ex.files > ex.maxFiles {
+		return errExtractFiles
+	}
+
+	path, err := ex.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	if mode = mode.Perm(); mode == 0 {
+		mode = 0644
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(io.MultiWriter(file, ex), reader)
+	return err
+}
+
+func extractZip(archive *os.File, ex *extraction) error {
+	reader, err := zip.NewReader(archive, ex.size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		ex.total += int64(file.UncompressedSize64)
+	}
+
+	// the declared size can be forged, but it is cheap to reject the obvious bomb early
+	if ex.maxSize > 0 && ex.total > ex.maxSize {
+		return errExtractSize
+	}
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			if err := ex.mkdir(file.Name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		src, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		err = ex.create(file.Name, file.Mode(), src)
+		src.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type decompressor func(r io.Reader) (io.Reader, error)
+
+func gzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+func bzip2Reader(r io.Reader) (io.Reader, error) {
+	return bzip2.NewReader(r), nil
+}
+
+func xzReader(r io.Reader) (io.Reader, error) {
+	return xz.NewReader(r)
+}
+
+func zstdReader(r io.Reader) (io.Reader, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoder.IOReadCloser(), nil
+}
+
+// decompress wraps the archive with the decompressor, if any
+func (ex *extraction) decompress(archive *os.File, decompress decompressor) (io.Reader, error) {
+	var reader io.Reader = &countingReader{reader: archive, ex: ex}
+	if decompress == nil {
+		return reader, nil
+	}
+
+	return decompress(reader)
+}
+
+func extractTar(decompress decompressor) extractor {
+	return func(archive *os.File, ex *extraction) error {
+		src, err := ex.decompress(archive, decompress)
+		if err != nil {
+			return err
+		}
+
+		if closer, ok := src.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		reader := tar.NewReader(src)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			switch header.Typeflag {
+			case tar.TypeDir:
+				err = ex.mkdir(header.Name)
+			case tar.TypeReg:
+				err = ex.create(header.Name, os.FileMode(header.Mode), reader)
+			default:
+				// links and devices are skipped since they can point outside the destination
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractSingle extracts compressed single file which is not a tarball
+func extractSingle(decompress decompressor) extractor {
+	return func(archive *os.File, ex *extraction) error {
+		src, err := ex.decompress(archive, decompress)
+		if err != nil {
+			return err
+		}
+
+		if closer, ok := src.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		name := filepath.Base(ex.dst)
+		return ex.create(name, 0644, src)
+	}
+}
@@ -0,0 +1,247 @@
+package rapid
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func createZip(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal("Error creating zip file:", err.Error())
+		}
+
+		file.Write(content)
+	}
+
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func createTarGz(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(gz)
+
+	for name, content := range files {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal("Error creating tar file:", err.Error())
+		}
+
+		writer.Write(content)
+	}
+
+	writer.Close()
+	gz.Close()
+	return buffer.Bytes()
+}
+
+func archiveEntry(t *testing.T, name string, content []byte) Entry {
+	location := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(location, content, 0644); err != nil {
+		t.Fatal("Error writing archive:", err.Error())
+	}
+
+	return &entry{
+		id:       "archive",
+		name:     name,
+		location: location,
+		size:     int64(len(content)),
+	}
+}
+
+func defaultExtractOption() *extractOption {
+	opt := &downloaderOption{}
+	AutoExtract()(opt)
+
+	return opt.extract
+}
+
+func TestExtractZip(t *testing.T) {
+	content := createZip(t, map[string][]byte{
+		"a.txt":     []byte("hello"),
+		"dir/b.txt": []byte("world"),
+	})
+
+	entry := archiveEntry(t, "archive.zip", content)
+
+	dst, err := extract(entry, defaultExtractOption(), nil)
+	if err != nil {
+		t.Fatal("Error extracting archive:", err.Error())
+	}
+
+	expected := filepath.Join(filepath.Dir(entry.Location()), "archive")
+	if dst != expected {
+		t.Errorf("Expected destination to be %s, but got %s", expected, dst)
+	}
+
+	for name, expected := range map[string]string{"a.txt": "hello", "dir/b.txt": "world"} {
+		content, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Error("Error reading extracted file:", err.Error())
+			continue
+		}
+
+		if string(content) != expected {
+			t.Errorf("Expected %s to be %s, but got %s", name, expected, content)
+		}
+	}
+}
+
+func TestExtractTarGzRemoveArchive(t *testing.T) {
+	content := createTarGz(t, map[string][]byte{"a.txt": []byte("hello")})
+	entry := archiveEntry(t, "archive.tar.gz", content)
+
+	opt := defaultExtractOption()
+	RemoveArchive()(opt)
+
+	var progress []interface{}
+	dst, err := extract(entry, opt, func(i ...interface{}) {
+		progress = i
+	})
+
+	if err != nil {
+		t.Fatal("Error extracting archive:", err.Error())
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); err != nil {
+		t.Error("Error extracting file:", err.Error())
+	}
+
+	if _, err := os.Stat(entry.Location()); err == nil {
+		t.Error("Expected archive to be removed")
+	}
+
+	if len(progress) != 4 || progress[1] != ExtractIndex {
+		t.Errorf("Expected extraction progress to be reported, but got %v", progress)
+	}
+}
+
+func TestExtractZst(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder, _ := zstd.NewWriter(&buffer)
+	encoder.Write([]byte("hello"))
+	encoder.Close()
+
+	entry := archiveEntry(t, "data.json.zst", buffer.Bytes())
+
+	dst, err := extract(entry, defaultExtractOption(), nil)
+	if err != nil {
+		t.Fatal("Error extracting archive:", err.Error())
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "data.json"))
+	if err != nil {
+		t.Fatal("Error reading extracted file:", err.Error())
+	}
+
+	if string(content) != "hello" {
+		t.Errorf("Expected content to be hello, but got %s", content)
+	}
+}
+
+func TestExtractPathTraversal(t *testing.T) {
+	testCases := map[string][]byte{
+		"archive.zip":    createZip(t, map[string][]byte{"../evil.txt": []byte("evil")}),
+		"archive.tar.gz": createTarGz(t, map[string][]byte{"../../evil.txt": []byte("evil")}),
+	}
+
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			entry := archiveEntry(t, name, content)
+
+			if _, err := extract(entry, defaultExtractOption(), nil); err != errExtractPath {
+				t.Errorf("Expected error to be %v, but got %v", errExtractPath, err)
+			}
+
+			if _, err := os.Stat(filepath.Join(filepath.Dir(entry.Location()), "evil.txt")); err == nil {
+				t.Error("Expected file outside the destination not to be created")
+			}
+		})
+	}
+}
+
+func TestExtractBomb(t *testing.T) {
+	content := createZip(t, map[string][]byte{"zero": make([]byte, 1024*1024*4)})
+	entry := archiveEntry(t, "bomb.zip", content)
+
+	opt := defaultExtractOption()
+	ExtractMaxRatio(10)(opt)
+
+	if _, err := extract(entry, opt, nil); err != errExtractRatio {
+		t.Errorf("Expected error to be %v, but got %v", errExtractRatio, err)
+	}
+
+	opt = defaultExtractOption()
+	ExtractMaxSize(1024)(opt)
+
+	if _, err := extract(entry, opt, nil); err != errExtractSize {
+		t.Errorf("Expected error to be %v, but got %v", errExtractSize, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(entry.Location()), "bomb")); err == nil {
+		t.Error("Expected partial extraction to be removed")
+	}
+}
+
+func TestDownloadAutoExtract(t *testing.T) {
+	setting := testSetting(t)
+	content := createZip(t, map[string][]byte{"a.txt": []byte("hello")})
+
+	server := testServer(t, content)
+	entry, err := Fetch(server.URL+"/archive.zip", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting), AutoExtract())
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	if _, err := os.Stat(filepath.Join(setting.DownloadLocation(), "archive", "a.txt")); err != nil {
+		t.Error("Error extracting downloaded archive:", err.Error())
+	}
+}
+
+func TestDownloadAutoExtractFailed(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, []byte("not a zip archive"))
+
+	entry, err := Fetch(server.URL+"/broken.zip", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	// the archive is downloaded and verified, so the extraction which fails doesn't fail the download
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting), AutoExtract())
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Expected the download to succeed, got", err.Error())
+	}
+
+	if state := entryState(entry); state != StateCompleted {
+		t.Errorf("Expected the entry to be %s, got %s", StateCompleted, state)
+	}
+
+	if _, err := os.Stat(entry.Location()); err != nil {
+		t.Error("Expected the archive to be kept:", err.Error())
+	}
+}
@@ -0,0 +1,199 @@
+package rapid
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const defaultFilename = "file"
+
+// ErrUnsafeLocation is returned for the location given by a client which would be placed outside the download location
+var ErrUnsafeLocation = fmt.Errorf("location must stay inside the download location")
+
+// maxFilenameLen is the maximum length in bytes of a filename on most file systems
+const maxFilenameLen = 255
+
+var (
+	extendedFilenameRegex = regexp.MustCompile(`(?i)filename\*\s*=\s*([^']*)'[^']*'([^;\s]+)`)
+	plainFilenameRegex    = regexp.MustCompile(`(?i)filename\s*=\s*("([^"]*)"|[^;]+)`)
+	reservedFilenameRegex = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9]|lpt[0-9])(\..*)?$`)
+)
+
+// filename resolves the name of the file from the Content-Disposition header (RFC 6266 and RFC 5987),
+// or from the last segment of the final url after the redirects. The result is always safe to be used as a filename
+func filename(r *http.Response) string {
+	if name := dispositionFilename(r.Header.Get("Content-Disposition")); name != "" {
+		if name = sanitizeFilename(name); name != "" {
+			return name
+		}
+	}
+
+	// r.Request is the last request that is made by the client, so it has the redirected url
+	if r.Request != nil && r.Request.URL != nil {
+		if name := sanitizeFilename(urlFilename(r.Request.URL)); name != "" {
+			return name
+		}
+	}
+
+	return defaultFilename
+}
+
+func dispositionFilename(disposition string) string {
+	if disposition == "" {
+		return ""
+	}
+
+	// standard library already handles the quoted filename and the utf-8 encoded filename*
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		if name, ok := params["filename"]; ok && name != "" {
+			return name
+		}
+	}
+
+	// fallback for the malformed header or the filename* with other charset
+	if match := extendedFilenameRegex.FindStringSubmatch(disposition); match != nil {
+		if name, ok := decodeExtendedValue(match[1], match[2]); ok {
+			return name
+		}
+	}
+
+	if match := plainFilenameRegex.FindStringSubmatch(disposition); match != nil {
+		if match[2] != "" {
+			return match[2]
+		}
+
+		return strings.Trim(strings.TrimSpace(match[1]), `"`)
+	}
+
+	return ""
+}
+
+// decodeExtendedValue decodes the percent encoded value of RFC 5987 with its charset
+func decodeExtendedValue(charset string, value string) (string, bool) {
+	decoded, err := url.PathUnescape(value)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(charset) {
+	case "utf-8", "us-ascii", "":
+		return decoded, utf8.ValidString(decoded)
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, 0, len(decoded))
+		for i := 0; i < len(decoded); i++ {
+			runes = append(runes, rune(decoded[i]))
+		}
+
+		return string(runes), true
+	}
+
+	return "", false
+}
+
+func urlFilename(u *url.URL) string {
+	path := u.EscapedPath()
+	if i := strings.LastIndex(path, "/"); i != -1 {
+		path = path[i+1:]
+	}
+
+	name, err := url.PathUnescape(path)
+	if err != nil {
+		return path
+	}
+
+	return name
+}
+
+// sanitizeFilename removes the path, control and illegal characters from the name, avoids the reserved names, and caps its length
+func sanitizeFilename(name string) string {
+	// only take the base name, since the server may send a path
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+
+	name = strings.ToValidUTF8(name, "")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+
+		return r
+	}, name)
+
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return ""
+	}
+
+	if reservedFilenameRegex.MatchString(name) {
+		name = "_" + name
+	}
+
+	return truncateFilename(name, maxFilenameLen)
+}
+
+// truncateFilename caps the length of the name in bytes while keeping its extension and utf-8 characters intact
+func truncateFilename(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > max/2 {
+		ext = ""
+	}
+
+	base := name[:len(name)-len(ext)]
+	limit := max - len(ext)
+	for limit > 0 && !utf8.RuneStart(base[limit]) {
+		limit--
+	}
+
+	return base[:limit] + ext
+}
+
+// safeJoin joins the filename into the directory and guarantees the result stays inside of it
+func safeJoin(dir string, name string) string {
+	dir = filepath.Clean(dir)
+	location := filepath.Join(dir, name)
+
+	if filepath.Dir(location) != dir {
+		return filepath.Join(dir, defaultFilename)
+	}
+
+	return location
+}
+
+// SafeLocation resolves the location given by a client, e.g through the api, inside the root. The location must be
+// relative to the root and can't go up from it, so the client can't write anywhere else
+func SafeLocation(root string, location string) (string, error) {
+	if location == "" || filepath.IsAbs(location) || filepath.VolumeName(location) != "" ||
+		strings.HasPrefix(location, "/") || strings.HasPrefix(location, `\`) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafeLocation, location)
+	}
+
+	for _, part := range strings.FieldsFunc(location, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %q", ErrUnsafeLocation, location)
+		}
+	}
+
+	root = filepath.Clean(root)
+	resolved := filepath.Join(root, location)
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%w: %q", ErrUnsafeLocation, location)
+	}
+
+	return safeJoin(filepath.Dir(resolved), filepath.Base(resolved)), nil
+}
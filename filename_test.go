@@ -0,0 +1,146 @@
+package rapid
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testResponse(t *testing.T, link string, disposition string) *http.Response {
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal("Error parsing url:", err.Error())
+	}
+
+	header := http.Header{}
+	if disposition != "" {
+		header.Set("Content-Disposition", disposition)
+	}
+
+	return &http.Response{
+		Header:  header,
+		Request: &http.Request{URL: u},
+	}
+}
+
+func TestFilenameDisposition(t *testing.T) {
+	testCases := []struct {
+		disposition string
+		expected    string
+	}{
+		{`attachment; filename="report.pdf"`, "report.pdf"},
+		{`attachment; filename=report.pdf`, "report.pdf"},
+		{`attachment; filename*=UTF-8''na%C3%AFve%20file.txt`, "naïve file.txt"},
+		{`attachment; filename="fallback.txt"; filename*=UTF-8''%E2%82%AC%20rates.txt`, "€ rates.txt"},
+		{`attachment; filename*=iso-8859-1'en'%A3%20rates.txt`, "£ rates.txt"},
+		{`attachment; filename=my report.pdf`, "my report.pdf"},
+		{`attachment; filename="../../.bashrc"`, "bashrc"},
+		{`attachment; filename="C:\Windows\system32.dll"`, "system32.dll"},
+		{`attachment; filename="a/b/c.txt"`, "c.txt"},
+		{`attachment; filename="evil` + "\x00\x1f" + `name?.txt"`, "evilname_.txt"},
+		{`attachment; filename="CON.txt"`, "_CON.txt"},
+		{`attachment; filename="nul"`, "_nul"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.disposition, func(t *testing.T) {
+			res := testResponse(t, "https://example.com/download", tc.disposition)
+			if name := filename(res); name != tc.expected {
+				t.Errorf("Expected filename to be %s, but got %s", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestFilenameURL(t *testing.T) {
+	testCases := []struct {
+		link     string
+		expected string
+	}{
+		{"https://example.com/files/report.pdf", "report.pdf"},
+		{"https://example.com/files/my%20report.pdf?token=abc", "my report.pdf"},
+		{"https://example.com/files/a%2F..%2F..%2Fetc%2Fpasswd", "passwd"},
+		{"https://example.com/download?id=123", "download"},
+		{"https://example.com/", "file"},
+		{"https://example.com/..", "file"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.link, func(t *testing.T) {
+			res := testResponse(t, tc.link, "")
+			if name := filename(res); name != tc.expected {
+				t.Errorf("Expected filename to be %s, but got %s", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestFilenameLength(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".pdf"
+	res := testResponse(t, "https://example.com/"+url.PathEscape(long), "")
+
+	name := filename(res)
+	if len(name) > maxFilenameLen {
+		t.Errorf("Expected filename to be at most %d bytes, but got %d", maxFilenameLen, len(name))
+	}
+
+	if !strings.HasSuffix(name, ".pdf") {
+		t.Errorf("Expected extension to be kept, but got %s", name)
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	dir := filepath.Join("downloads", "rapid")
+
+	testCases := map[string]string{
+		"file.txt":     filepath.Join(dir, "file.txt"),
+		"../file.txt":  filepath.Join(dir, "file"),
+		"a/b/file.txt": filepath.Join(dir, "file"),
+		"..":           filepath.Join(dir, "file"),
+	}
+
+	for name, expected := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if location := safeJoin(dir, name); location != expected {
+				t.Errorf("Expected location to be %s, but got %s", expected, location)
+			}
+		})
+	}
+}
+
+func TestSafeLocation(t *testing.T) {
+	root := filepath.Join("downloads", "rapid")
+
+	testCases := map[string]string{
+		"file.txt":         filepath.Join(root, "file.txt"),
+		"video/file.mp4":   filepath.Join(root, "video", "file.mp4"),
+		"./a/../file.txt":  "",
+		"../file.txt":      "",
+		"a/../../file.txt": "",
+		"/etc/passwd":      "",
+		`\windows\file`:    "",
+		"..":               "",
+		".":                "",
+		"":                 "",
+	}
+
+	for location, expected := range testCases {
+		t.Run(location, func(t *testing.T) {
+			resolved, err := SafeLocation(root, location)
+			if expected == "" {
+				if !errors.Is(err, ErrUnsafeLocation) {
+					t.Errorf("Expected location to be rejected, but got %s, %v", resolved, err)
+				}
+
+				return
+			}
+
+			if err != nil || resolved != expected {
+				t.Errorf("Expected location to be %s, but got %s, %v", expected, resolved, err)
+			}
+		})
+	}
+}
@@ -1,11 +1,38 @@
 package rapid
 
 import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
 	"regexp"
 	"strings"
+	"sync"
 )
 
-type TypeExpression func() string
+type (
+	TypeExpression func() string
+
+	// Signature is the magic bytes of a file content at certain offset
+	Signature struct {
+		Offset int
+		Magic  []byte
+	}
+
+	// matcher decides the file type based on the filename, mime type, or the content of a file
+	matcher struct {
+		name       string
+		expr       *regexp.Regexp
+		mimetypes  []string // pattern of the mime type, e.g video/*
+		signatures []Signature
+	}
+)
+
+const filetypeOther = "Other"
+
+// sniffLen is how many bytes of the first chunk are needed to detect the file type
+const sniffLen = 512
 
 func imagetype() string {
 	return `^.*\.(jpg|jpeg|png|gif|svg|bmp)$`
@@ -27,29 +54,204 @@ func compressedtype() string {
 	return `^.*\.(zip|rar|7z|tar|gz|bz2|tgz|tbz2|xz|txz|zst|zstd)$`
 }
 
-var filetypeMap = map[string]TypeExpression{
-	"Audio":      audiotype,
-	"Video":      videotype,
-	"Image":      imagetype,
-	"Compressed": compressedtype,
-	"Document":   documenttype,
+// filetypesMu guards the filetypes along with their matchers, as the file type can be registered while the entries are
+// fetched
+var filetypesMu sync.RWMutex
+
+// filetypes are matched in order, the built-in types first and then the registered ones in the order they are
+// registered, so the file which matches more than one type always gets the same one
+var filetypes = []*matcher{
+	{
+		name:      "Audio",
+		expr:      regexp.MustCompile(audiotype()),
+		mimetypes: []string{"audio/*"},
+		signatures: []Signature{
+			{Magic: []byte("ID3")},
+			{Magic: []byte("fLaC")},
+			{Magic: []byte("OggS")},
+			{Offset: 8, Magic: []byte("WAVE")},
+		},
+	},
+	{
+		name:      "Video",
+		expr:      regexp.MustCompile(videotype()),
+		mimetypes: []string{"video/*"},
+		signatures: []Signature{
+			{Offset: 4, Magic: []byte("ftyp")},
+			{Offset: 8, Magic: []byte("AVI ")},
+			{Magic: []byte{0x1a, 0x45, 0xdf, 0xa3}}, // matroska and webm
+			{Magic: []byte("FLV")},
+		},
+	},
+	{
+		name:      "Image",
+		expr:      regexp.MustCompile(imagetype()),
+		mimetypes: []string{"image/*"},
+		signatures: []Signature{
+			{Magic: []byte("\x89PNG\r\n\x1a\n")},
+			{Magic: []byte{0xff, 0xd8, 0xff}},
+			{Magic: []byte("GIF8")},
+			{Offset: 8, Magic: []byte("WEBP")},
+		},
+	},
+	{
+		name: "Compressed",
+		expr: regexp.MustCompile(compressedtype()),
+		mimetypes: []string{
+			"application/zip",
+			"application/x-zip-compressed",
+			"application/gzip",
+			"application/x-gzip",
+			"application/x-tar",
+			"application/x-bzip2",
+			"application/x-xz",
+			"application/zstd",
+			"application/x-7z-compressed",
+			"application/vnd.rar",
+			"application/x-rar-compressed",
+		},
+		signatures: []Signature{
+			{Magic: []byte("PK\x03\x04")},
+			{Magic: []byte{0x1f, 0x8b}},
+			{Magic: []byte("BZh")},
+			{Magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+			{Magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+			{Magic: []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+			{Magic: []byte("Rar!\x1a\x07")},
+			{Offset: 257, Magic: []byte("ustar")},
+		},
+	},
+	{
+		name: "Document",
+		expr: regexp.MustCompile(documenttype()),
+		mimetypes: []string{
+			"application/pdf",
+			"application/msword",
+			"application/rtf",
+			"application/vnd.ms-excel",
+			"application/vnd.ms-powerpoint",
+			"application/vnd.openxmlformats-officedocument.*",
+			"application/vnd.oasis.opendocument.*",
+			"text/plain",
+		},
+		signatures: []Signature{
+			{Magic: []byte("%PDF-")},
+			{Magic: []byte("{\\rtf")},
+		},
+	},
 }
 
+// filetype detects the file type only based on the filename
 func filetype(filename string) string {
-	for name, expr := range filetypeMap {
-		regex, err := regexp.Compile(expr())
-		if err != nil {
-			return "Other"
+	return detectFiletype(filename, "", nil)
+}
+
+// detectFiletype detects the file type based on the extension of the filename, then the magic bytes of the content, then the content type
+func detectFiletype(filename string, contentType string, head []byte) string {
+	filetypesMu.RLock()
+	defer filetypesMu.RUnlock()
+
+	filename = strings.ToLower(filename)
+	for _, matcher := range filetypes {
+		if matcher.expr != nil && matcher.expr.MatchString(filename) {
+			return matcher.name
 		}
+	}
 
-		if match := regex.MatchString(strings.ToLower(filename)); match {
-			return name
+	for _, matcher := range filetypes {
+		if matcher.matchSignature(head) {
+			return matcher.name
 		}
 	}
 
-	return "Other"
+	mimetypes := make([]string, 0, 2)
+	if mimetype, _, err := mime.ParseMediaType(contentType); err == nil {
+		mimetypes = append(mimetypes, mimetype)
+	}
+
+	// let the standard library sniff the content type which has no registered signature
+	if len(head) > 0 {
+		if mimetype, _, err := mime.ParseMediaType(http.DetectContentType(head)); err == nil {
+			mimetypes = append(mimetypes, mimetype)
+		}
+	}
+
+	for _, mimetype := range mimetypes {
+		for _, matcher := range filetypes {
+			if matcher.matchMimetype(mimetype) {
+				return matcher.name
+			}
+		}
+	}
+
+	return filetypeOther
 }
 
-func RegisterFiletype(name string, expr TypeExpression) {
-	filetypeMap[name] = expr
+func (m *matcher) matchSignature(head []byte) bool {
+	for _, signature := range m.signatures {
+		end := signature.Offset + len(signature.Magic)
+		if len(head) >= end && bytes.Equal(head[signature.Offset:end], signature.Magic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *matcher) matchMimetype(mimetype string) bool {
+	for _, pattern := range m.mimetypes {
+		if match, _ := path.Match(pattern, mimetype); match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getMatcher returns the matcher of the file type, the new file type is matched after the ones which are known. It must
+// be called with the lock held
+func getMatcher(name string) *matcher {
+	for _, m := range filetypes {
+		if m.name == name {
+			return m
+		}
+	}
+
+	m := &matcher{name: name}
+	filetypes = append(filetypes, m)
+
+	return m
+}
+
+// RegisterFiletype registers the file type with the regex of its filename. The file type is left as it is if the
+// expression is invalid, so the file which it should match is still detected by the other ways, or as Other
+func RegisterFiletype(name string, expr TypeExpression) error {
+	regex, err := regexp.Compile(expr())
+	if err != nil {
+		return fmt.Errorf("invalid expression of file type %s: %w", name, err)
+	}
+
+	filetypesMu.Lock()
+	defer filetypesMu.Unlock()
+
+	getMatcher(name).expr = regex
+	return nil
+}
+
+// RegisterMimetype registers the mime types of a file type. The mime type can be a pattern, e.g video/*
+func RegisterMimetype(name string, mimetypes ...string) {
+	filetypesMu.Lock()
+	defer filetypesMu.Unlock()
+
+	m := getMatcher(name)
+	m.mimetypes = append(m.mimetypes, mimetypes...)
+}
+
+// RegisterSignature registers the magic bytes of a file type
+func RegisterSignature(name string, signatures ...Signature) {
+	filetypesMu.Lock()
+	defer filetypesMu.Unlock()
+
+	m := getMatcher(name)
+	m.signatures = append(m.signatures, signatures...)
 }
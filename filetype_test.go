@@ -154,9 +154,161 @@ func TestFiletypeOther(t *testing.T) {
 func TestBadFiletypeSuccess(t *testing.T) {
 	// link with bad header
 	link := "https://cartographicperspectives.org/index.php/journal/article/view/cp13-full/pdf"
-	entry, _ := Fetch(link)
+	entry, err := Fetch(link)
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	// the name and the content type tell nothing, but the content is still detected as the pdf by its magic bytes
+	if entry.Type() != "Document" {
+		t.Error("File type expected to be Document, but got", entry.Type())
+	}
+}
+
+func TestDetectFiletypeSignature(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+
+	testCases := map[string][]byte{
+		"Compressed": []byte("PK\x03\x04rest of the zip"),
+		"Document":   []byte("%PDF-1.7"),
+		"Image":      []byte("\x89PNG\r\n\x1a\nrest of the png"),
+		"Video":      []byte("\x00\x00\x00\x20ftypisom"),
+		"Audio":      []byte("ID3\x03\x00"),
+	}
+
+	for expected, head := range testCases {
+		t.Run(expected, func(t *testing.T) {
+			result := detectFiletype("file.bin", "application/octet-stream", head)
+			if result != expected {
+				t.Errorf("Expected detectFiletype to be %s, but got %s", expected, result)
+			}
+		})
+	}
+
+	if result := detectFiletype("download", "", tar); result != "Compressed" {
+		t.Errorf("Expected tarball to be Compressed, but got %s", result)
+	}
+}
+
+func TestDetectFiletypeMimetype(t *testing.T) {
+	testCases := map[string]string{
+		"video/mp4":                "Video",
+		"audio/mpeg":               "Audio",
+		"image/webp":               "Image",
+		"application/zip":          "Compressed",
+		"application/pdf":          "Document",
+		"text/plain; charset=utf8": "Document",
+		"application/octet-stream": "Other",
+		"":                         "Other",
+	}
+
+	for contentType, expected := range testCases {
+		t.Run(contentType, func(t *testing.T) {
+			result := detectFiletype("download?id=123", contentType, nil)
+			if result != expected {
+				t.Errorf("Expected detectFiletype(%s) to be %s, but got %s", contentType, expected, result)
+			}
+		})
+	}
+}
+
+func TestDetectFiletypeExtensionFirst(t *testing.T) {
+	// docx is a zip file, but the extension should win
+	result := detectFiletype("document.docx", "application/zip", []byte("PK\x03\x04"))
+	if result != "Document" {
+		t.Errorf("Expected detectFiletype to be Document, but got %s", result)
+	}
+}
+
+func TestRegisterFiletype(t *testing.T) {
+	RegisterFiletype("Torrent", func() string {
+		return `^.*\.torrent$`
+	})
+	RegisterMimetype("Torrent", "application/x-bittorrent")
+	RegisterSignature("Torrent", Signature{Magic: []byte("d8:announce")})
+
+	t.Cleanup(func() {
+		unregisterFiletypes("Torrent")
+	})
+
+	if result := filetype("ubuntu.torrent"); result != "Torrent" {
+		t.Errorf("Expected filetype to be Torrent, but got %s", result)
+	}
+
+	if result := detectFiletype("download", "application/x-bittorrent", nil); result != "Torrent" {
+		t.Errorf("Expected filetype to be Torrent, but got %s", result)
+	}
+
+	if result := detectFiletype("download", "", []byte("d8:announce")); result != "Torrent" {
+		t.Errorf("Expected filetype to be Torrent, but got %s", result)
+	}
+}
+
+// unregisterFiletypes removes the file types which are registered by the test
+func unregisterFiletypes(names ...string) {
+	filetypesMu.Lock()
+	defer filetypesMu.Unlock()
+
+	for _, name := range names {
+		for i, m := range filetypes {
+			if m.name == name {
+				filetypes = append(filetypes[:i], filetypes[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func TestRegisterFiletypeInvalid(t *testing.T) {
+	t.Cleanup(func() {
+		unregisterFiletypes("Broken")
+	})
+
+	if err := RegisterFiletype("Broken", func() string { return `^.*\.(broken$` }); err == nil {
+		t.Fatal("Expected the invalid expression to be reported")
+	}
+
+	if result := filetype("file.broken"); result != "Other" {
+		t.Errorf("Expected the file to fall back to Other, but got %s", result)
+	}
+
+	// registering while the entries are fetched doesn't race with the detection
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			RegisterMimetype("Broken", "application/x-broken")
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		detectFiletype("file.bin", "application/x-broken", nil)
+	}
+	<-done
+}
+
+func TestRegisterFiletypeOrder(t *testing.T) {
+	RegisterFiletype("Ebook", func() string { return `^.*\.(pdf|epub)$` })
+	RegisterFiletype("Book", func() string { return `^.*\.epub$` })
+	RegisterSignature("Ebook", Signature{Magic: []byte("%PDF-")})
+
+	t.Cleanup(func() {
+		unregisterFiletypes("Ebook", "Book")
+	})
+
+	// the built-in types come first, then the registered ones in the order they are registered
+	for i := 0; i < 20; i++ {
+		if result := filetype("book.pdf"); result != "Document" {
+			t.Fatalf("Expected the built-in type to win, but got %s", result)
+		}
+
+		if result := filetype("book.epub"); result != "Ebook" {
+			t.Fatalf("Expected the first registered type to win, but got %s", result)
+		}
 
-	if entry.Type() != "Other" {
-		t.Error("File type expected to be Other, but got", entry.Type())
+		if result := detectFiletype("download", "", []byte("%PDF-1.7")); result != "Document" {
+			t.Fatalf("Expected the built-in signature to win, but got %s", result)
+		}
 	}
 }
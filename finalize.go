@@ -0,0 +1,104 @@
+package rapid
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// partPath returns where the chunks are combined before the file is verified, which is next to the location so it can
+// be renamed into the location at once
+func partPath(location string) string {
+	return location + ".part"
+}
+
+// mergedSize returns the bytes that are already combined into the part file of the entry
+func mergedSize(entry Entry) int64 {
+	stat, err := os.Stat(partPath(entry.Location()))
+	if err != nil {
+		return 0
+	}
+
+	return stat.Size()
+}
+
+func removePart(entry Entry) error {
+	if err := os.Remove(partPath(entry.Location())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// syncFile flushes the file to the disk
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
+
+// moveFile renames the file, or copies it when the destination is on another filesystem where it can't be renamed
+func moveFile(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// the copy is made next to the destination first, so the destination is never left incomplete
+	tmp := dst + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, source); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	source.Close()
+	return os.Remove(src)
+}
+
+// finalize renames the verified part file into the location, so the location never has an incomplete file. The directory
+// is synced as well so the rename survives a crash
+func finalize(part string, location string) error {
+	if err := os.Rename(part, location); err != nil {
+		return err
+	}
+
+	// the directory can't be synced on some platforms, e.g windows, which is fine as the rename is already done
+	if dir, err := os.Open(filepath.Dir(location)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package rapid
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCreateFileResume(t *testing.T) {
+	setting := testSetting(t)
+	content := bytes.Repeat([]byte("0123456789"), 1024)
+
+	var ranges atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranges.Add(1)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetPartitionStrategy(CountPartition(4)))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	// the merge is stopped after the first two chunks and half of the third are combined
+	if err := os.MkdirAll(chunkDir(setting, entry.ID()), os.ModePerm); err != nil {
+		t.Fatal("Error creating temp location:", err.Error())
+	}
+
+	for i := 0; i < entry.ChunkLen(); i++ {
+		start, length := chunkBounds(entry, i)
+		if i < 2 {
+			continue
+		}
+
+		if err := os.WriteFile(chunkPath(setting, entry.ID(), i), content[start:start+length], 0644); err != nil {
+			t.Fatal("Error writing chunk:", err.Error())
+		}
+	}
+
+	start, length := chunkBounds(entry, 2)
+	if err := os.WriteFile(partPath(entry.Location()), content[:start+length/2], 0644); err != nil {
+		t.Fatal("Error writing part file:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Resume(entry); err != nil {
+		t.Fatal("Error resuming download:", err.Error())
+	}
+
+	result, err := os.ReadFile(entry.Location())
+	if err != nil || !bytes.Equal(result, content) {
+		t.Errorf("Expected the merge to be continued, got %d bytes, %v", len(result), err)
+	}
+
+	if ranges.Load() != 0 {
+		t.Errorf("Expected the combined chunks not to be downloaded again, got %d requests", ranges.Load())
+	}
+
+	if _, err := os.Stat(partPath(entry.Location())); !os.IsNotExist(err) {
+		t.Errorf("Expected the part file to be renamed, got %v", err)
+	}
+}
+
+func TestCreateFileChecksumMismatch(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetChecksum("sha-256", make([]byte, 32)))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Download(entry); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected %v, got %v", ErrChecksumMismatch, err)
+	}
+
+	for _, location := range []string{entry.Location(), partPath(entry.Location())} {
+		if _, err := os.Stat(location); !os.IsNotExist(err) {
+			t.Errorf("Expected no file at %s, got %v", location, err)
+		}
+	}
+}
+
+func TestDownloadTempLocation(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.tempLocation = t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 1024)
+	server := testServer(t, content)
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetPartitionStrategy(CountPartition(4)))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	var chunks []string
+	downloader := NewDownloader(DownloaderDefault,
+		SetDownloaderSetting(setting),
+		OnBeforeCreate(func(entry Entry, location string) (string, error) {
+			chunks, _ = filepath.Glob(filepath.Join(setting.tempLocation, entry.ID(), "*"))
+			return location, nil
+		}),
+	)
+
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	if len(chunks) != entry.ChunkLen() {
+		t.Errorf("Expected %d chunks in the directory of the entry, got %v", entry.ChunkLen(), chunks)
+	}
+
+	files, _ := os.ReadDir(setting.downloadLocation)
+	if len(files) != 1 || files[0].Name() != entry.Name() {
+		t.Errorf("Expected only the downloaded file in the download location, got %v", files)
+	}
+
+	if _, err := os.Stat(filepath.Join(setting.tempLocation, entry.ID())); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory of the entry to be removed, got %v", err)
+	}
+}
+
+func TestMoveFileCrossDevice(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "chunk")
+	if err := os.WriteFile(src, []byte("rapid"), 0644); err != nil {
+		t.Fatal("Error writing file:", err.Error())
+	}
+
+	dir, err := os.MkdirTemp("/dev/shm", "rapid")
+	if err != nil {
+		t.Skip("No other filesystem to move the file to:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, srcDisk, _ := diskSpace(filepath.Dir(src))
+	_, dstDisk, _ := diskSpace(dir)
+	if srcDisk == dstDisk {
+		t.Skip("The temp directory and /dev/shm are on the same filesystem")
+	}
+
+	dst := filepath.Join(dir, "file.bin")
+	if err := moveFile(src, dst); err != nil {
+		t.Fatal("Error moving file:", err.Error())
+	}
+
+	if content, err := os.ReadFile(dst); err != nil || string(content) != "rapid" {
+		t.Errorf("Expected the file to be copied, got %q, %v", content, err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("Expected the source to be removed, got %v", err)
+	}
+}
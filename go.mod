@@ -1,3 +1,10 @@
 module github.com/thoriqadillah/rapid
 
-go 1.19
+go 1.22
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,129 @@
+package rapid
+
+import "fmt"
+
+type (
+	// Hook is a callback that will be called on certain lifecycle point of an entry. Returning an error will veto the operation
+	Hook func(entry Entry) error
+
+	// LocationHook is called right before the chunks are combined into the actual file. It may return a different location for the entry
+	LocationHook func(entry Entry, location string) (string, error)
+
+	// FailureHook is called when the download of an entry is failed for good
+	FailureHook func(entry Entry, err error)
+
+	hooks struct {
+		beforeProbe   []Hook
+		beforeChunk   []Hook
+		beforeCreate  []LocationHook
+		afterMerge    []Hook
+		onFailure     []FailureHook
+		onCancel      []Hook
+		onStateChange []StateHook
+	}
+)
+
+// OnBeforeProbe registers a hook that will be called before the url of an entry is checked before downloading
+func OnBeforeProbe(hook Hook) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.hooks.beforeProbe = append(o.hooks.beforeProbe, hook)
+	}
+}
+
+// OnBeforeChunk registers a hook that will be called before an entry is splitted into chunks and downloaded
+func OnBeforeChunk(hook Hook) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.hooks.beforeChunk = append(o.hooks.beforeChunk, hook)
+	}
+}
+
+// OnBeforeCreate registers a hook that will be called before the chunks are combined into the actual file
+func OnBeforeCreate(hook LocationHook) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.hooks.beforeCreate = append(o.hooks.beforeCreate, hook)
+	}
+}
+
+// OnAfterMerge registers a hook that will be called after the chunks are combined into the actual file
+func OnAfterMerge(hook Hook) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.hooks.afterMerge = append(o.hooks.afterMerge, hook)
+	}
+}
+
+// OnFailure registers a hook that will be called when the download is failed
+func OnFailure(hook FailureHook) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.hooks.onFailure = append(o.hooks.onFailure, hook)
+	}
+}
+
+// OnCancel registers a hook that will be called before the download is stopped
+func OnCancel(hook Hook) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.hooks.onCancel = append(o.hooks.onCancel, hook)
+	}
+}
+
+func runHooks(entry Entry, hooks []Hook) error {
+	for _, hook := range hooks {
+		if err := hook(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *hooks) runBeforeProbe(entry Entry) error {
+	return runHooks(entry, h.beforeProbe)
+}
+
+func (h *hooks) runBeforeChunk(entry Entry) error {
+	return runHooks(entry, h.beforeChunk)
+}
+
+var errNotRelocatable = fmt.Errorf("entry can't be relocated")
+
+// runBeforeCreate will pass the location through every hook and relocate the entry if it is changed
+func (h *hooks) runBeforeCreate(entry Entry) error {
+	location := entry.Location()
+	for _, hook := range h.beforeCreate {
+		var err error
+		if location, err = hook(entry, location); err != nil {
+			return err
+		}
+	}
+
+	if location == entry.Location() {
+		return nil
+	}
+
+	relocator, ok := entry.(EntryRelocator)
+	if !ok {
+		return errNotRelocatable
+	}
+
+	relocator.Relocate(location)
+	return nil
+}
+
+func (h *hooks) runAfterMerge(entry Entry) error {
+	return runHooks(entry, h.afterMerge)
+}
+
+func (h *hooks) runOnFailure(entry Entry, err error) {
+	for _, hook := range h.onFailure {
+		hook(entry, err)
+	}
+}
+
+func (h *hooks) runOnCancel(entry Entry) error {
+	return runHooks(entry, h.onCancel)
+}
+
+func (h *hooks) runOnStateChange(entry Entry, from State, to State) {
+	for _, hook := range h.onStateChange {
+		hook(entry, from, to)
+	}
+}
@@ -0,0 +1,136 @@
+package rapid
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testSetting(t *testing.T) Setting {
+	return &settings{
+		downloadLocation: t.TempDir(),
+		dataLocation:     t.TempDir(),
+		maxRetry:         3,
+		loggerProvider:   LoggerStdOut,
+		minChunkSize:     1024,
+	}
+}
+
+func testServer(t *testing.T, content []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHookRelocateBeforeCreate(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	target := filepath.Join(t.TempDir(), "moved.bin")
+	merged := false
+
+	downloader := NewDownloader(DownloaderDefault,
+		SetDownloaderSetting(setting),
+		OnBeforeCreate(func(entry Entry, location string) (string, error) {
+			return target, nil
+		}),
+		OnAfterMerge(func(entry Entry) error {
+			merged = true
+			return nil
+		}),
+	)
+
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	if entry.Location() != target {
+		t.Errorf("Expected location to be %s, but got %s", target, entry.Location())
+	}
+
+	file, err := os.Stat(target)
+	if err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	if file.Size() != entry.Size() {
+		t.Errorf("Download has different size. Expected %d, but got %d", entry.Size(), file.Size())
+	}
+
+	if !merged {
+		t.Error("Expected after merge hook to be called")
+	}
+}
+
+func TestHookVetoBeforeChunk(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, []byte("rapid"))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	veto := fmt.Errorf("vetoed")
+	var failure error
+
+	downloader := NewDownloader(DownloaderDefault,
+		SetDownloaderSetting(setting),
+		OnBeforeChunk(func(entry Entry) error {
+			return veto
+		}),
+		OnFailure(func(entry Entry, err error) {
+			failure = err
+		}),
+	)
+
+	if err := downloader.Download(entry); err != veto {
+		t.Errorf("Expected download to be vetoed, but got %v", err)
+	}
+
+	if failure != veto {
+		t.Errorf("Expected failure hook to receive %v, but got %v", veto, failure)
+	}
+
+	if _, err := os.Stat(entry.Location()); err == nil {
+		t.Error("Expected file not to be created")
+	}
+}
+
+func TestHookVetoCancel(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, []byte("rapid"))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault,
+		SetDownloaderSetting(setting),
+		OnCancel(func(entry Entry) error {
+			return fmt.Errorf("can't be stopped")
+		}),
+	)
+
+	if err := downloader.Stop(entry); err == nil {
+		t.Error("Expected stop to be vetoed")
+	}
+
+	if entry.Context().Err() != nil {
+		t.Error("Expected entry not to be canceled")
+	}
+}
@@ -0,0 +1,300 @@
+package rapid
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// hostLimiter caps the connections to the same host, which are shared by every entry of every downloader, so the
+	// chunks of many entries can't flood the host
+	hostLimiter struct {
+		mu        sync.Mutex
+		hosts     map[string]*hostSlot
+		learned   map[string]*hostLearned // the limits learned from the hosts that throttle, kept for the later entries
+		listeners []func()                // called whenever there may be room for a new connection
+	}
+
+	// heldHostKey marks the context of the job which connection to the host is already acquired by the scheduler
+	heldHostKey struct{}
+
+	hostSlot struct {
+		active   int
+		next     time.Time     // the earliest time of the next connection
+		released chan struct{} // closed whenever a connection is released, so the waiters can try again
+	}
+
+	hostLearned struct {
+		limit     int
+		changed   time.Time // when the limit was lowered or raised
+		successes int       // the connections that succeeded since the limit was changed
+	}
+)
+
+const (
+	// throttleCooldown keeps the connections that are throttled at once from lowering the limit more than once
+	throttleCooldown = time.Second
+
+	// raiseInterval is the least time between the raises of the learned limit
+	raiseInterval = 5 * time.Second
+)
+
+var connections = newHostLimiter()
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{
+		hosts:   make(map[string]*hostSlot),
+		learned: make(map[string]*hostLearned),
+	}
+}
+
+// acquire waits until there is room for a new connection to the host and the delay since the previous one has passed.
+// The limit is read from the setting every time, so it follows the setting which is changed at runtime, unless a lower
+// limit is learned from the host. The returned function must be called when the connection is closed
+func (l *hostLimiter) acquire(ctx context.Context, host string, setting Setting) (func(), error) {
+	for {
+		l.mu.Lock()
+		delay, ok := l.take(host, setting)
+		if ok {
+			l.mu.Unlock()
+
+			release := l.releaser(host)
+			if err := sleep(ctx, delay); err != nil {
+				release()
+				return nil, err
+			}
+
+			return release, nil
+		}
+
+		released := l.hosts[host].released
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// holdHost marks the context of the job which connection to the host is acquired before the job is started
+func holdHost(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, heldHostKey{}, host)
+}
+
+// acquireHost acquires the connection to the host, unless the job of the context already holds it
+func acquireHost(ctx context.Context, host string, setting Setting) (func(), error) {
+	if held, _ := ctx.Value(heldHostKey{}).(string); held == host {
+		return func() {}, nil
+	}
+
+	return connections.acquire(ctx, host, setting)
+}
+
+// tryAcquire takes the connection to the host if there is room for it, without waiting. It returns how long the
+// connection has to wait for the delay since the previous one, and the function to call when it is closed
+func (l *hostLimiter) tryAcquire(host string, setting Setting) (func(), time.Duration, bool) {
+	l.mu.Lock()
+	delay, ok := l.take(host, setting)
+	l.mu.Unlock()
+
+	if !ok {
+		return nil, 0, false
+	}
+
+	return l.releaser(host), delay, true
+}
+
+// take counts the new connection to the host if there is room for it, and returns how long it has to wait for the
+// delay. Must be called with the lock held
+func (l *hostLimiter) take(host string, setting Setting) (time.Duration, bool) {
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{released: make(chan struct{})}
+		l.hosts[host] = slot
+	}
+
+	max := l.limit(host, setting)
+	if max > 0 && slot.active >= max {
+		return 0, false
+	}
+
+	slot.active++
+
+	// the connections are spaced by the delay in the order they are acquired
+	now := time.Now()
+	start := now
+	if slot.next.After(now) {
+		start = slot.next
+	}
+
+	slot.next = start.Add(setting.ConnectionDelay(host))
+	return start.Sub(now), true
+}
+
+// releaser returns the function which releases the connection to the host once
+func (l *hostLimiter) releaser(host string) func() {
+	var once sync.Once
+	return func() { once.Do(func() { l.release(host) }) }
+}
+
+// subscribe registers the function which is called whenever there may be room for a new connection
+func (l *hostLimiter) subscribe(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.listeners = append(l.listeners, fn)
+}
+
+// notify calls the listeners. Must be called without the lock held, as the listeners may acquire the connections
+func (l *hostLimiter) notify() {
+	l.mu.Lock()
+	listeners := l.listeners
+	l.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener()
+	}
+}
+
+func (l *hostLimiter) release(host string) {
+	defer l.notify()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot, ok := l.hosts[host]
+	if !ok {
+		return
+	}
+
+	slot.active--
+	close(slot.released)
+	slot.released = make(chan struct{})
+
+	// the idle host is forgotten, unless its delay still has to be kept for the next connection
+	if slot.active == 0 && !slot.next.After(time.Now()) {
+		delete(l.hosts, host)
+	}
+}
+
+// limit returns the max connections to the host, which is the lower of the setting and the learned limit. Must be
+// called with the lock held
+func (l *hostLimiter) limit(host string, setting Setting) int {
+	max := setting.MaxConnectionsPerHost(host)
+	if learned, ok := l.learned[host]; ok && (max <= 0 || learned.limit < max) {
+		return learned.limit
+	}
+
+	return max
+}
+
+// throttle halves the connections to the host, as the host refuses the connections it has. The connections which are
+// already open are not closed, but no new one is made until they are fewer than the limit
+func (l *hostLimiter) throttle(host string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	learned, ok := l.learned[host]
+	if ok && time.Since(learned.changed) < throttleCooldown {
+		return learned.limit
+	}
+
+	current := 0
+	if slot, ok := l.hosts[host]; ok {
+		current = slot.active
+	}
+
+	if ok && (current == 0 || learned.limit < current) {
+		current = learned.limit
+	}
+
+	limit := max(current/2, 1)
+	l.learned[host] = &hostLearned{limit: limit, changed: time.Now()}
+	metrics.throttles.add(host, 1)
+
+	return limit
+}
+
+// succeed raises the learned limit of the host by one connection after as many connections as the limit succeeded, so
+// the connections are slowly raised back to the setting. The host is forgotten once it is back at the setting
+func (l *hostLimiter) succeed(host string, setting Setting) {
+	if l.raise(host, setting) {
+		l.notify()
+	}
+}
+
+// raise counts the connection which succeeded, and returns true if the limit is raised
+func (l *hostLimiter) raise(host string, setting Setting) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	learned, ok := l.learned[host]
+	if !ok {
+		return false
+	}
+
+	learned.successes++
+	if learned.successes < learned.limit || time.Since(learned.changed) < raiseInterval {
+		return false
+	}
+
+	learned.limit++
+	learned.changed = time.Now()
+	learned.successes = 0
+
+	if max := setting.MaxConnectionsPerHost(host); max > 0 && learned.limit >= max {
+		delete(l.learned, host)
+	}
+
+	// the waiters may have room now
+	if slot, ok := l.hosts[host]; ok {
+		close(slot.released)
+		slot.released = make(chan struct{})
+	}
+
+	return true
+}
+
+// learnedLimit returns the limit learned from the host, or zero if the host has never throttled
+func (l *hostLimiter) learnedLimit(host string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if learned, ok := l.learned[host]; ok {
+		return learned.limit
+	}
+
+	return 0
+}
+
+// active returns the number of the connections to the host
+func (l *hostLimiter) active(host string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if slot, ok := l.hosts[host]; ok {
+		return slot.active
+	}
+
+	return 0
+}
+
+// sleep waits for the duration, or returns the error of the context if it is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
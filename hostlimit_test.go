@@ -0,0 +1,125 @@
+package rapid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterMaxConnections(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.maxConnections = 4
+	setting.hostConnections = map[string]int{"slow.example.com": 2}
+
+	limiter := &hostLimiter{hosts: make(map[string]*hostSlot)}
+
+	for host, max := range map[string]int{"slow.example.com": 2, "fast.example.com": 4} {
+		var active, peak atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				release, err := limiter.acquire(context.Background(), host, setting)
+				if err != nil {
+					t.Error("Error acquiring connection:", err)
+					return
+				}
+				defer release()
+
+				n := active.Add(1)
+				for {
+					current := peak.Load()
+					if n <= current || peak.CompareAndSwap(current, n) {
+						break
+					}
+				}
+
+				time.Sleep(5 * time.Millisecond)
+				active.Add(-1)
+			}()
+		}
+
+		wg.Wait()
+
+		if peak.Load() != int64(max) {
+			t.Errorf("Expected at most %d connections to %s, got %d", max, host, peak.Load())
+		}
+
+		if n := limiter.active(host); n != 0 {
+			t.Errorf("Expected every connection to %s to be released, got %d", host, n)
+		}
+	}
+}
+
+func TestHostLimiterDelay(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.connectionDelay = 20 * time.Millisecond
+
+	limiter := &hostLimiter{hosts: make(map[string]*hostSlot)}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.acquire(context.Background(), "example.com", setting)
+		if err != nil {
+			t.Fatal("Error acquiring connection:", err.Error())
+		}
+		release()
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected the connections to be spaced by the delay, got %s for 3 connections", elapsed)
+	}
+}
+
+func TestHostLimiterCancel(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.maxConnections = 1
+
+	limiter := &hostLimiter{hosts: make(map[string]*hostSlot)}
+
+	release, err := limiter.acquire(context.Background(), "example.com", setting)
+	if err != nil {
+		t.Fatal("Error acquiring connection:", err.Error())
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := limiter.acquire(ctx, "example.com", setting); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the waiting connection to be canceled, got %v", err)
+	}
+}
+
+func TestDownloadMaxConnections(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.maxConnections = 1
+	content := bytes.Repeat([]byte("0123456789"), 1024)
+	server := testServer(t, content)
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	if entry.ChunkLen() < 2 {
+		t.Fatalf("Expected the entry to have more than one chunk, got %d", entry.ChunkLen())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	result, err := os.ReadFile(entry.Location())
+	if err != nil || !bytes.Equal(result, content) {
+		t.Errorf("Expected the file to be downloaded one chunk at a time, got %d bytes, %v", len(result), err)
+	}
+}
@@ -1,22 +1,276 @@
 package rapid
 
 import (
+	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type (
-	Logger interface {
+	// Level is the severity of a log
+	Level int
+
+	// Printer is the logger which only prints, as the logger providers were before the leveled Logger. RegisterPrinter
+	// keeps such providers working
+	Printer interface {
+		// Print logs the arguments at info level
 		Print(...interface{})
 	}
 
+	Logger interface {
+		Printer
+
+		Debug(msg string, keyvals ...interface{})
+		Info(msg string, keyvals ...interface{})
+		Warn(msg string, keyvals ...interface{})
+		Error(msg string, keyvals ...interface{})
+
+		// With returns a logger that always adds the key-value fields, e.g "entry", entry.ID()
+		With(keyvals ...interface{}) Logger
+	}
+
+	// LogWriter writes a single log record. Logger provider can implement only this and let NewLevelLogger handles the rest
+	LogWriter interface {
+		Write(level Level, msg string, keyvals []interface{})
+	}
+
+	// LevelSetter is implemented by logger whose minimum level can be changed while it is used
+	LevelSetter interface {
+		SetLevel(level Level)
+	}
+
 	LoggerFunc func(setting Setting) Logger
+
+	PrinterFunc func(setting Setting) Printer
+
+	levelLogger struct {
+		writer  LogWriter
+		level   *atomic.Int64 // shared with the loggers created by With, so they follow the change of the level
+		keyvals []interface{}
+	}
+
+	// settingLogger filters the logs of the shared logger of the provider by the level of its own setting on every call,
+	// so the loggers of the same provider keep their own level, and follow the setting which is changed at runtime
+	settingLogger struct {
+		logger  Logger
+		setting Setting
+	}
+
+	// providerSetting is given to the provider, so the shared logger writes every level and leaves the level to the
+	// setting of every logger
+	providerSetting struct {
+		Setting
+	}
+
+	// printWriter writes the logs through the logger which only prints
+	printWriter struct {
+		printer Printer
+	}
 )
 
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// ParseLevel parses the name of a level, e.g debug, info, warn, or error
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %s", name)
+}
+
+// NewLevelLogger creates a logger that only writes the log with the level of at least the minimum level
+func NewLevelLogger(writer LogWriter, level Level) Logger {
+	l := &levelLogger{
+		writer: writer,
+		level:  &atomic.Int64{},
+	}
+
+	l.level.Store(int64(level))
+	return l
+}
+
+func (l *levelLogger) log(level Level, msg string, keyvals []interface{}) {
+	if int64(level) < l.level.Load() {
+		return
+	}
+
+	if len(l.keyvals) > 0 {
+		keyvals = append(append(make([]interface{}, 0, len(l.keyvals)+len(keyvals)), l.keyvals...), keyvals...)
+	}
+
+	l.writer.Write(level, msg, keyvals)
+}
+
+func (l *levelLogger) Print(args ...interface{}) {
+	l.log(LevelInfo, strings.TrimSuffix(fmt.Sprintln(args...), "\n"), nil)
+}
+
+func (l *levelLogger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+func (l *levelLogger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+func (l *levelLogger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+func (l *levelLogger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// SetLevel changes the minimum level of the logger and the loggers created from it by With
+func (l *levelLogger) SetLevel(level Level) {
+	l.level.Store(int64(level))
+}
+
+func (l *levelLogger) With(keyvals ...interface{}) Logger {
+	return &levelLogger{
+		writer:  l.writer,
+		level:   l.level,
+		keyvals: append(append(make([]interface{}, 0, len(l.keyvals)+len(keyvals)), l.keyvals...), keyvals...),
+	}
+}
+
+// formatKeyvals formats the key-value fields into key=value pairs
+func formatKeyvals(keyvals []interface{}) string {
+	var sb strings.Builder
+	for i := 0; i < len(keyvals); i += 2 {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+
+		str := fmt.Sprint(value)
+		if strings.ContainsAny(str, " \"=") {
+			str = fmt.Sprintf("%q", str)
+		}
+
+		sb.WriteString(fmt.Sprintf("%v=%s", keyvals[i], str))
+	}
+
+	return sb.String()
+}
+
+// NewPrintLogger adapts the logger which only prints into the leveled logger, the level and the fields are printed along
+// with the message
+func NewPrintLogger(printer Printer, level Level) Logger {
+	if logger, ok := printer.(Logger); ok {
+		return logger
+	}
+
+	return NewLevelLogger(&printWriter{printer: printer}, level)
+}
+
+func (w *printWriter) Write(level Level, msg string, keyvals []interface{}) {
+	if len(keyvals) == 0 {
+		w.printer.Print(fmt.Sprintf("%s %s", level, msg))
+		return
+	}
+
+	w.printer.Print(fmt.Sprintf("%s %s %s", level, msg, formatKeyvals(keyvals)))
+}
+
+func (s providerSetting) LogLevel() Level {
+	return LevelDebug
+}
+
+func (l *settingLogger) enabled(level Level) bool {
+	return level >= l.setting.LogLevel()
+}
+
+func (l *settingLogger) Print(args ...interface{}) {
+	if l.enabled(LevelInfo) {
+		l.logger.Print(args...)
+	}
+}
+
+func (l *settingLogger) Debug(msg string, keyvals ...interface{}) {
+	if l.enabled(LevelDebug) {
+		l.logger.Debug(msg, keyvals...)
+	}
+}
+
+func (l *settingLogger) Info(msg string, keyvals ...interface{}) {
+	if l.enabled(LevelInfo) {
+		l.logger.Info(msg, keyvals...)
+	}
+}
+
+func (l *settingLogger) Warn(msg string, keyvals ...interface{}) {
+	if l.enabled(LevelWarn) {
+		l.logger.Warn(msg, keyvals...)
+	}
+}
+
+func (l *settingLogger) Error(msg string, keyvals ...interface{}) {
+	if l.enabled(LevelError) {
+		l.logger.Error(msg, keyvals...)
+	}
+}
+
+func (l *settingLogger) With(keyvals ...interface{}) Logger {
+	return &settingLogger{
+		logger:  l.logger.With(keyvals...),
+		setting: l.setting,
+	}
+}
+
 var loggermap = make(map[string]LoggerFunc)
 var instance sync.Map
 
+// NewLogger creates the logger of the provider of the setting, which only logs the level of the setting. The provider
+// is created once and shared by the loggers of every setting, while the level is read from the setting on every log, so
+// it follows the setting which is changed at runtime
 func NewLogger(setting Setting) Logger {
+	return &settingLogger{
+		logger:  providerLogger(setting),
+		setting: setting,
+	}
+}
+
+// providerLogger returns the shared logger of the provider of the setting, it is created by the first setting
+func providerLogger(setting Setting) Logger {
 	val, ok := instance.Load(setting.LoggerProvider())
 	if ok {
 		return val.(Logger)
@@ -28,12 +282,17 @@ func NewLogger(setting Setting) Logger {
 		return nil
 	}
 
-	l := logger(setting)
-	instance.Store(setting.LoggerProvider(), l)
-
-	return l
+	val, _ = instance.LoadOrStore(setting.LoggerProvider(), logger(providerSetting{Setting: setting}))
+	return val.(Logger)
 }
 
 func RegisterLogger(name string, impl LoggerFunc) {
 	loggermap[name] = impl
 }
+
+// RegisterPrinter registers the provider which only prints, like the providers before the leveled Logger
+func RegisterPrinter(name string, impl PrinterFunc) {
+	RegisterLogger(name, func(setting Setting) Logger {
+		return NewPrintLogger(impl(setting), setting.LogLevel())
+	})
+}
@@ -0,0 +1,391 @@
+package rapid
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	fileLogger struct {
+		mu         sync.Mutex
+		dir        string
+		main       *logFile
+		entries    map[string]*logFile // the open log files of the entries, closed once they are idle
+		maxSize    int64
+		maxAge     time.Duration
+		maxBackups int
+		perEntry   bool
+	}
+
+	// logFile is the log file which is rotated by its size and age into the compressed backups next to it
+	logFile struct {
+		dir     string
+		name    string // the name of the file without .log, which prefixes the names of its backups
+		file    *os.File
+		size    int64
+		opened  time.Time
+		written time.Time // the last write, so the log file of the entry which is done can be closed
+	}
+)
+
+const LoggerFile = "file"
+
+const (
+	logFilename   = "rapid.log"
+	logTimeFormat = "2006-01-02T15-04-05.000"
+
+	// entryLogIdle is how long the log file of the entry is kept open without any write
+	entryLogIdle = time.Minute
+
+	// maxEntryLogs is how many log files of the entries are kept open at most
+	maxEntryLogs = 32
+)
+
+// file logger will log into DataLocation/logs/rapid.log and rotate it by its size and age
+func newFileLogger(setting Setting) Logger {
+	l := &fileLogger{dir: filepath.Join(setting.DataLocation(), "logs")}
+	l.configure(setting)
+
+	// the logger is shared by every setting of the provider, so it follows the rotation of the setting which creates it
+	// when it is changed at runtime. The location of the logs can't be changed without a restart
+	base := setting
+	if provider, ok := setting.(providerSetting); ok {
+		base = provider.Setting
+	}
+
+	if notifier, ok := base.(SettingNotifier); ok {
+		notifier.Subscribe(func() { l.configure(setting) })
+	}
+
+	return NewLevelLogger(l, setting.LogLevel())
+}
+
+// configure reads the rotation of the logs from the setting. The log files of the entries are closed when they are no
+// longer written separately
+func (l *fileLogger) configure(setting Setting) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.maxSize = setting.LogMaxSize()
+	l.maxAge = setting.LogMaxAge()
+	l.maxBackups = setting.LogMaxBackups()
+	l.perEntry = setting.LogPerEntry()
+
+	if !l.perEntry {
+		for name, f := range l.entries {
+			f.close()
+			delete(l.entries, name)
+		}
+	}
+}
+
+func (l *fileLogger) Write(level Level, msg string, keyvals []interface{}) {
+	line := fmt.Sprintf("%s %s %s", time.Now().Format(time.RFC3339), level, msg)
+	if len(keyvals) > 0 {
+		line += " " + formatKeyvals(keyvals)
+	}
+	line += "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.main == nil {
+		l.main = &logFile{dir: l.dir, name: strings.TrimSuffix(logFilename, ".log")}
+	}
+
+	if err := l.write(l.main, line); err != nil {
+		log.Println("Error writing log file:", err.Error())
+	}
+
+	if !l.perEntry {
+		return
+	}
+
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "entry" {
+			if err := l.writeEntry(fmt.Sprint(keyvals[i+1]), line); err != nil {
+				log.Println("Error writing entry log file:", err.Error())
+			}
+
+			return
+		}
+	}
+}
+
+// write appends the line into the log file, which is rotated first if the line makes it too big or it is too old
+func (l *fileLogger) write(f *logFile, line string) error {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+
+	tooBig := l.maxSize > 0 && f.size+int64(len(line)) > l.maxSize && f.size > 0
+	tooOld := l.maxAge > 0 && time.Since(f.opened) > l.maxAge && f.size > 0
+	if tooBig || tooOld {
+		if err := l.rotate(f); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.WriteString(line)
+	f.size += int64(n)
+	f.written = time.Now()
+
+	return err
+}
+
+func (f *logFile) path() string {
+	return filepath.Join(f.dir, f.name+".log")
+}
+
+func (f *logFile) open() error {
+	if err := os.MkdirAll(f.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = stat.Size()
+	f.opened = time.Now()
+	if stat.Size() > 0 {
+		f.opened = f.created(stat.ModTime())
+	}
+
+	return nil
+}
+
+// created returns the time the log file is started, which is the time of its first line, as the file system only keeps
+// the time of the last write. The fallback is used when the first line has no time, e.g it is written by another tool
+func (f *logFile) created(fallback time.Time) time.Time {
+	file, err := os.Open(f.path())
+	if err != nil {
+		return fallback
+	}
+	defer file.Close()
+
+	head := make([]byte, len(time.RFC3339)+16)
+	n, _ := io.ReadFull(file, head)
+
+	stamp, _, _ := strings.Cut(string(head[:n]), " ")
+	created, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return fallback
+	}
+
+	return created
+}
+
+func (f *logFile) close() error {
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+// rotate will compress the current log file into a backup, remove the old backups, and start a new log file
+func (l *fileLogger) rotate(f *logFile) error {
+	if err := f.close(); err != nil {
+		return err
+	}
+
+	backup := filepath.Join(f.dir, fmt.Sprintf("%s-%s.log", f.name, time.Now().Format(logTimeFormat)))
+	if err := os.Rename(f.path(), backup); err != nil {
+		return err
+	}
+
+	if err := compressLog(backup); err != nil {
+		return err
+	}
+
+	if err := l.prune(f); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+func compressLog(location string) error {
+	src, err := os.Open(location)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(location + ".gz")
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(location)
+}
+
+// backups returns the backups of the log file from the oldest
+func (f *logFile) backups() ([]string, error) {
+	files, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the name of the entry can't be used as a glob pattern, so the timestamp is checked instead
+	var backups []string
+	prefix := f.name + "-"
+	for _, file := range files {
+		stamp, ok := strings.CutPrefix(file.Name(), prefix)
+		if !ok || !strings.HasSuffix(stamp, ".log.gz") {
+			continue
+		}
+
+		if _, err := time.Parse(logTimeFormat, strings.TrimSuffix(stamp, ".log.gz")); err == nil {
+			backups = append(backups, filepath.Join(f.dir, file.Name()))
+		}
+	}
+
+	// the timestamp in the name makes the backups sorted from the oldest
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// prune removes the oldest backups when there are more than the max backups. The logs of the entries which are older
+// than the oldest backup of the main log are removed along with it
+func (l *fileLogger) prune(f *logFile) error {
+	if l.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > l.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+
+		backups = backups[1:]
+	}
+
+	if f != l.main || len(backups) < l.maxBackups {
+		return nil
+	}
+
+	oldest, err := os.Stat(backups[0])
+	if err != nil {
+		return err
+	}
+
+	return l.pruneEntries(oldest.ModTime())
+}
+
+// pruneEntries removes the logs of the entries, along with their backups, which are not written since the time
+func (l *fileLogger) pruneEntries(before time.Time) error {
+	dir := filepath.Join(l.dir, "entries")
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	open := make(map[string]bool, len(l.entries))
+	for _, f := range l.entries {
+		open[filepath.Base(f.path())] = true
+	}
+
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || open[file.Name()] || !info.ModTime().Before(before) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeEntry writes the log into a separate file for every entry, so a failed download can be debugged on its own. The
+// file is rotated and pruned like the main log, and kept open while the entry keeps logging
+func (l *fileLogger) writeEntry(id string, line string) error {
+	name := strings.TrimSuffix(sanitizeFilename(id), ".log")
+	if name == "" {
+		return nil
+	}
+
+	if l.entries == nil {
+		l.entries = make(map[string]*logFile)
+	}
+
+	f, ok := l.entries[name]
+	if !ok {
+		l.closeEntries()
+		f = &logFile{dir: filepath.Join(l.dir, "entries"), name: name}
+		l.entries[name] = f
+	}
+
+	return l.write(f, line)
+}
+
+// closeEntries closes the log files of the entries which are idle, and the least recently written ones if there are
+// still too many of them open, so there is room for one more
+func (l *fileLogger) closeEntries() {
+	for name, f := range l.entries {
+		if time.Since(f.written) > entryLogIdle {
+			f.close()
+			delete(l.entries, name)
+		}
+	}
+
+	for len(l.entries) >= maxEntryLogs {
+		var oldest string
+		for name, f := range l.entries {
+			if oldest == "" || f.written.Before(l.entries[oldest].written) {
+				oldest = name
+			}
+		}
+
+		l.entries[oldest].close()
+		delete(l.entries, oldest)
+	}
+}
+
+func init() {
+	RegisterLogger(LoggerFile, newFileLogger)
+}
@@ -0,0 +1,240 @@
+package rapid
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileLoggerRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	writer := &fileLogger{
+		dir:        dir,
+		maxSize:    200,
+		maxBackups: 2,
+	}
+
+	logger := NewLevelLogger(writer, LevelDebug)
+	for i := 0; i < 20; i++ {
+		logger.Info("Downloading chunk", "chunk", i)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "rapid-*.log.gz"))
+	if len(backups) == 0 || len(backups) > 2 {
+		t.Fatalf("Expected 1 to 2 backups, but got %d", len(backups))
+	}
+
+	stat, err := os.Stat(filepath.Join(dir, logFilename))
+	if err != nil {
+		t.Fatal("Error reading log file:", err.Error())
+	}
+
+	if stat.Size() > 200 {
+		t.Errorf("Expected log file to be rotated at 200 bytes, but got %d", stat.Size())
+	}
+
+	file, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal("Error opening backup:", err.Error())
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal("Error reading compressed backup:", err.Error())
+	}
+
+	content, _ := io.ReadAll(gz)
+	if !strings.Contains(string(content), "INFO Downloading chunk chunk=") {
+		t.Errorf("Expected backup to contain the logs, but got %s", content)
+	}
+}
+
+func TestFileLoggerRotateByAge(t *testing.T) {
+	dir := t.TempDir()
+	writer := &fileLogger{
+		dir:    dir,
+		maxAge: time.Hour,
+	}
+
+	logger := NewLevelLogger(writer, LevelDebug)
+	logger.Info("first")
+
+	writer.main.opened = time.Now().Add(-2 * time.Hour)
+	logger.Info("second")
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "rapid-*.log.gz"))
+	if len(backups) != 1 {
+		t.Errorf("Expected 1 backup, but got %d", len(backups))
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, logFilename))
+	if strings.Contains(string(content), "first") || !strings.Contains(string(content), "second") {
+		t.Errorf("Expected log file to only contain the newest log, but got %s", content)
+	}
+}
+
+func TestFileLoggerReopenAge(t *testing.T) {
+	dir := t.TempDir()
+
+	// the log file is started long ago, but written just now, so its age comes from the first line
+	started := time.Now().Add(-2 * time.Hour).Format(time.RFC3339)
+	content := started + " INFO first\n" + time.Now().Format(time.RFC3339) + " INFO second\n"
+	if err := os.WriteFile(filepath.Join(dir, logFilename), []byte(content), 0644); err != nil {
+		t.Fatal("Error writing log file:", err.Error())
+	}
+
+	writer := &fileLogger{
+		dir:    dir,
+		maxAge: time.Hour,
+	}
+
+	NewLevelLogger(writer, LevelDebug).Info("third")
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "rapid-*.log.gz"))
+	if len(backups) != 1 {
+		t.Errorf("Expected the reopened log file to be rotated by its age, but got %d backups", len(backups))
+	}
+}
+
+func TestFileLoggerLiveSetting(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.logPerEntry = true
+
+	live := NewLiveSetting(setting)
+	writer := newFileLogger(providerSetting{Setting: live}).(*levelLogger).writer.(*fileLogger)
+
+	changed := *setting
+	changed.logMaxSize = 1024
+	changed.logMaxBackups = 3
+	changed.logPerEntry = false
+	if err := live.Update(&changed); err != nil {
+		t.Fatal("Error updating setting:", err)
+	}
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.maxSize != 1024 || writer.maxBackups != 3 || writer.perEntry {
+		t.Errorf("Expected the logger to follow the setting, got %+v", writer)
+	}
+}
+
+func TestFileLoggerPerEntry(t *testing.T) {
+	setting := testSetting(t)
+	setting.(*settings).logPerEntry = true
+
+	logger := newFileLogger(setting)
+	logger.With("entry", "abc").Error("Failed downloading chunk", "chunk", 1)
+	logger.Info("Starting worker")
+
+	content, err := os.ReadFile(filepath.Join(setting.DataLocation(), "logs", "entries", "abc.log"))
+	if err != nil {
+		t.Fatal("Error reading entry log file:", err.Error())
+	}
+
+	if !strings.Contains(string(content), "ERROR Failed downloading chunk entry=abc chunk=1") {
+		t.Errorf("Expected entry log to contain the error, but got %s", content)
+	}
+
+	if strings.Contains(string(content), "Starting worker") {
+		t.Errorf("Expected entry log not to contain other logs, but got %s", content)
+	}
+
+	content, _ = os.ReadFile(filepath.Join(setting.DataLocation(), "logs", logFilename))
+	if !strings.Contains(string(content), "Failed downloading chunk") || !strings.Contains(string(content), "Starting worker") {
+		t.Errorf("Expected main log to contain every log, but got %s", content)
+	}
+}
+
+func TestFileLoggerPerEntryRotate(t *testing.T) {
+	dir := t.TempDir()
+	writer := &fileLogger{
+		dir:        dir,
+		maxSize:    200,
+		maxBackups: 2,
+		perEntry:   true,
+	}
+
+	logger := NewLevelLogger(writer, LevelDebug).With("entry", "abc")
+	logger.Info("Downloading chunk", "chunk", 0)
+
+	// the file of the entry is kept open between the logs
+	file := writer.entries["abc"].file
+	for i := 1; i < 20; i++ {
+		logger.Info("Downloading chunk", "chunk", i)
+	}
+
+	if file == nil || writer.entries["abc"] == nil {
+		t.Fatal("Expected the entry log file to be kept open")
+	}
+
+	entries := filepath.Join(dir, "entries")
+	backups, _ := filepath.Glob(filepath.Join(entries, "abc-*.log.gz"))
+	if len(backups) == 0 || len(backups) > 2 {
+		t.Errorf("Expected 1 to 2 backups of the entry log, but got %d", len(backups))
+	}
+
+	stat, err := os.Stat(filepath.Join(entries, "abc.log"))
+	if err != nil || stat.Size() > 200 {
+		t.Errorf("Expected the entry log file to be rotated at 200 bytes, but got %v %v", stat, err)
+	}
+}
+
+func TestFileLoggerPerEntryPrune(t *testing.T) {
+	dir := t.TempDir()
+	writer := &fileLogger{
+		dir:        dir,
+		maxSize:    100,
+		maxBackups: 1,
+		perEntry:   true,
+	}
+
+	// the log of the entry which is long done is older than every backup of the main log
+	entries := filepath.Join(dir, "entries")
+	os.MkdirAll(entries, os.ModePerm)
+	stale := filepath.Join(entries, "old.log")
+	os.WriteFile(stale, []byte("done\n"), 0644)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(stale, past, past)
+
+	logger := NewLevelLogger(writer, LevelDebug)
+	logger.With("entry", "new").Info("Downloading chunk")
+	for i := 0; i < 10; i++ {
+		time.Sleep(2 * time.Millisecond)
+		logger.Info("Starting worker", "worker", i)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale entry log to be pruned, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(entries, "new.log")); err != nil {
+		t.Errorf("Expected the open entry log to be kept, got %v", err)
+	}
+}
+
+func TestFileLoggerCloseEntries(t *testing.T) {
+	writer := &fileLogger{dir: t.TempDir(), perEntry: true}
+	logger := NewLevelLogger(writer, LevelDebug)
+
+	logger.With("entry", "idle").Info("Entry downloaded")
+	writer.entries["idle"].written = time.Now().Add(-2 * entryLogIdle)
+
+	for i := 0; i < maxEntryLogs+5; i++ {
+		logger.With("entry", fmt.Sprintf("entry%d", i)).Info("Fetching url")
+	}
+
+	if _, ok := writer.entries["idle"]; ok {
+		t.Error("Expected the idle entry log file to be closed")
+	}
+
+	if len(writer.entries) > maxEntryLogs {
+		t.Errorf("Expected at most %d entry log files open, but got %d", maxEntryLogs, len(writer.entries))
+	}
+}
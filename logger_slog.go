@@ -0,0 +1,43 @@
+package rapid
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+const LoggerSlog = "slog"
+
+// NewSlogLogger adapts the slog logger, so the logs can be handled by any slog handler
+func NewSlogLogger(logger *slog.Logger, level Level) Logger {
+	return NewLevelLogger(&slogLogger{logger: logger}, level)
+}
+
+// slog logger will log through the default slog logger
+func newSlogLogger(setting Setting) Logger {
+	return NewSlogLogger(slog.Default(), setting.LogLevel())
+}
+
+func (l *slogLogger) Write(level Level, msg string, keyvals []interface{}) {
+	l.logger.Log(context.Background(), slogLevel(level), msg, keyvals...)
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+
+	return slog.LevelInfo
+}
+
+func init() {
+	RegisterLogger(LoggerSlog, newSlogLogger)
+}
@@ -7,12 +7,17 @@ type stdLogger struct{}
 const LoggerStdOut = "stdout"
 
 // StdLogger will log into std out
-func newStdLogger(_ Setting) Logger {
-	return &stdLogger{}
+func newStdLogger(setting Setting) Logger {
+	return NewLevelLogger(&stdLogger{}, setting.LogLevel())
 }
 
-func (l *stdLogger) Print(args ...interface{}) {
-	log.Println(args...)
+func (l *stdLogger) Write(level Level, msg string, keyvals []interface{}) {
+	if len(keyvals) == 0 {
+		log.Println(level, msg)
+		return
+	}
+
+	log.Println(level, msg, formatKeyvals(keyvals))
 }
 
 func init() {
@@ -0,0 +1,158 @@
+package rapid
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type testLogWriter struct {
+	records []string
+}
+
+func (w *testLogWriter) Write(level Level, msg string, keyvals []interface{}) {
+	w.records = append(w.records, strings.TrimSpace(fmt.Sprint(level, " ", msg, " ", formatKeyvals(keyvals))))
+}
+
+func TestLevelLoggerMinimumLevel(t *testing.T) {
+	writer := &testLogWriter{}
+	logger := NewLevelLogger(writer, LevelWarn)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Print("print")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	expected := []string{"WARN warn", "ERROR error"}
+	if strings.Join(writer.records, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected records to be %v, but got %v", expected, writer.records)
+	}
+}
+
+func TestLevelLoggerWith(t *testing.T) {
+	writer := &testLogWriter{}
+	logger := NewLevelLogger(writer, LevelDebug).With("entry", "abc")
+
+	logger.With("chunk", 1).Error("Error downloading chunk", "attempt", 2, "error", fmt.Errorf("connection reset"))
+	logger.Info("Entry downloaded")
+
+	expected := []string{
+		`ERROR Error downloading chunk entry=abc chunk=1 attempt=2 error="connection reset"`,
+		`INFO Entry downloaded entry=abc`,
+	}
+
+	for i, record := range expected {
+		if i >= len(writer.records) || writer.records[i] != record {
+			t.Errorf("Expected record to be %s, but got %v", record, writer.records)
+		}
+	}
+}
+
+// testPrinter is the logger which only prints, like the providers before the leveled logger
+type testPrinter struct {
+	lines []string
+}
+
+func (p *testPrinter) Print(args ...interface{}) {
+	p.lines = append(p.lines, fmt.Sprint(args...))
+}
+
+func TestNewLoggerLevel(t *testing.T) {
+	writer := &testLogWriter{}
+	RegisterLogger("test-level", func(setting Setting) Logger {
+		return NewLevelLogger(writer, setting.LogLevel())
+	})
+
+	quiet := testSetting(t).(*settings)
+	quiet.loggerProvider = "test-level"
+	quiet.logLevel = LevelError
+
+	verbose := *quiet
+	verbose.logLevel = LevelDebug
+
+	// the loggers share the provider, but every one of them keeps the level of its own setting
+	NewLogger(quiet).Info("quiet info")
+	NewLogger(&verbose).Info("verbose info")
+
+	live := NewLiveSetting(quiet)
+	logger := NewLogger(live).With("entry", "abc")
+	logger.Warn("before")
+
+	changed := *quiet
+	changed.logLevel = LevelWarn
+	if err := live.Update(&changed); err != nil {
+		t.Fatal("Error updating setting:", err)
+	}
+
+	logger.Warn("after")
+
+	expected := []string{"INFO verbose info", "WARN after entry=abc"}
+	if strings.Join(writer.records, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected records to be %v, but got %v", expected, writer.records)
+	}
+}
+
+func TestRegisterPrinter(t *testing.T) {
+	printer := &testPrinter{}
+	RegisterPrinter("test-printer", func(setting Setting) Printer {
+		return printer
+	})
+
+	setting := testSetting(t).(*settings)
+	setting.loggerProvider = "test-printer"
+	setting.logLevel = LevelInfo
+
+	logger := NewLogger(setting).With("entry", "abc")
+	logger.Debug("hidden")
+	logger.Info("Entry downloaded", "elapsed", 2)
+
+	expected := []string{"INFO Entry downloaded entry=abc elapsed=2"}
+	if strings.Join(printer.lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected lines to be %v, but got %v", expected, printer.lines)
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	handler := slog.NewTextHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := NewSlogLogger(slog.New(handler), LevelInfo).With("entry", "abc")
+
+	logger.Debug("hidden")
+	logger.Warn("Error downloading chunk, retrying", "chunk", 1)
+
+	output := buffer.String()
+	if strings.Contains(output, "hidden") {
+		t.Errorf("Expected debug log to be filtered, but got %s", output)
+	}
+
+	for _, expected := range []string{"level=WARN", `msg="Error downloading chunk, retrying"`, "entry=abc", "chunk=1"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %s, but got %s", expected, output)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	testCases := map[string]Level{
+		"debug":   LevelDebug,
+		"INFO":    LevelInfo,
+		"warning": LevelWarn,
+		"error":   LevelError,
+	}
+
+	for name, expected := range testCases {
+		t.Run(name, func(t *testing.T) {
+			level, err := ParseLevel(name)
+			if err != nil || level != expected {
+				t.Errorf("Expected level to be %v, but got %v (%v)", expected, level, err)
+			}
+		})
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected error when parsing unknown level")
+	}
+}
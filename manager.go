@@ -0,0 +1,647 @@
+package rapid
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type (
+	// Status is the state of an entry in the manager
+	Status string
+
+	// Task is the snapshot of an entry managed by the manager
+	Task struct {
+		Entry      Entry
+		Status     Status
+		State      State // the state of the entry within its status, empty if the entry doesn't keep it
+		Downloaded int64 // downloaded bytes, including what is downloaded before the entry is resumed
+		Speed      int64 // download speed in bytes per second
+		Err        error // the error of the failed download
+	}
+
+	// Event is emitted whenever the status of an entry is changed, or its state when the downloader reports it
+	Event struct {
+		ID     string
+		Status Status
+		State  State // only set by the state change, which doesn't change the status
+		Err    error
+	}
+
+	// OnEvent is the listener of the events, which is called outside the lock of the manager so it can call the manager
+	// back. It must not block for long, as it holds up whoever changes the entry
+	OnEvent func(event Event)
+
+	// GlobalStat is the summary of every entry in the manager
+	GlobalStat struct {
+		Speed   int64
+		Active  int
+		Waiting int // waiting and paused entries
+		Stopped int // completed, failed, and removed entries
+	}
+
+	task struct {
+		entry       Entry
+		status      Status
+		started     bool
+		restart     bool // the entry is started over when it is scheduled
+		chunks      []int64
+		seen        []bool
+		transferred int64 // bytes downloaded by this process, excluding the resumed bytes
+		last        int64
+		speed       int64
+		err         error
+	}
+
+	// Manager downloads the entries with the downloader, keeping at most MaxActiveEntries of them active at the same time
+	// while the rest wait in the queue
+	Manager struct {
+		mu          sync.Mutex
+		downloader  Downloader
+		queue       Queue
+		logger      Logger
+		tasks       map[string]*task
+		order       []string
+		maxActive   int
+		active      int
+		listeners   map[int]OnEvent
+		listenerID  int
+		done        chan struct{}
+		closeOnce   sync.Once
+		unsubscribe func()
+	}
+)
+
+// The entry is waiting in the queue until there is room for it to be active. The active entry ends up complete, error,
+// or paused, and the one which is stopped for good is removed. The paused and the failed entries can be continued with
+// Unpause, while every entry which isn't active can be started over with Restart or forgotten with Purge
+const (
+	StatusWaiting  Status = "waiting"
+	StatusActive   Status = "active"
+	StatusPaused   Status = "paused"
+	StatusComplete Status = "complete"
+	StatusError    Status = "error"
+	StatusRemoved  Status = "removed"
+)
+
+// speedInterval is how often the speed of the active entries is measured
+const speedInterval = time.Second
+
+var (
+	// ErrEntryExists is returned by Add when the entry with the same id is already managed
+	ErrEntryExists = fmt.Errorf("entry is already added")
+
+	// ErrInvalidStatus is returned when the entry can't be changed in its status, e.g unpausing the complete entry
+	ErrInvalidStatus = fmt.Errorf("entry can't be changed in its current status")
+)
+
+// NewManager creates the manager which downloads the entries with the downloader in the order of the queue
+func NewManager(downloader Downloader, queue Queue, setting Setting) *Manager {
+	m := &Manager{
+		downloader: downloader,
+		queue:      queue,
+		logger:     NewLogger(setting),
+		tasks:      make(map[string]*task),
+		maxActive:  setting.MaxActiveEntries(),
+		listeners:  make(map[int]OnEvent),
+		done:       make(chan struct{}),
+	}
+
+	if watcher, ok := downloader.(Watcher); ok {
+		watcher.Watch(m.update)
+	}
+
+	if watcher, ok := downloader.(StateWatcher); ok {
+		watcher.WatchState(m.changeState)
+	}
+
+	// the max active entries follows the setting, unless it is unchanged so the one from SetMaxActive is kept
+	if notifier, ok := setting.(SettingNotifier); ok {
+		max := setting.MaxActiveEntries()
+		m.unsubscribe = notifier.Subscribe(func() {
+			if current := setting.MaxActiveEntries(); current != max {
+				max = current
+				m.SetMaxActive(max)
+			}
+		})
+	}
+
+	go m.measure()
+
+	return m
+}
+
+// Add puts the entry into the queue to be downloaded
+func (m *Manager) Add(entry Entry) error {
+	m.mu.Lock()
+
+	if _, ok := m.tasks[entry.ID()]; ok {
+		m.mu.Unlock()
+		return ErrEntryExists
+	}
+
+	m.tasks[entry.ID()] = &task{
+		entry:  entry,
+		status: StatusWaiting,
+		chunks: make([]int64, entry.ChunkLen()),
+		seen:   make([]bool, entry.ChunkLen()),
+	}
+
+	m.order = append(m.order, entry.ID())
+	m.queue.Push(entry)
+
+	events := []Event{{ID: entry.ID(), Status: StatusWaiting}}
+	events = append(events, m.schedule()...)
+	m.mu.Unlock()
+
+	m.emit(events)
+	return nil
+}
+
+// schedule starts the waiting entries while there is room for them. It must be called with the lock held
+func (m *Manager) schedule() []Event {
+	events := make([]Event, 0)
+
+	for (m.maxActive <= 0 || m.active < m.maxActive) && !m.queue.IsEmpty() {
+		entry := m.queue.Pop()
+
+		// the entry may be paused or removed while it is waiting
+		t, ok := m.tasks[entry.ID()]
+		if !ok || t.status != StatusWaiting {
+			continue
+		}
+
+		transfer := m.downloader.Download
+		switch {
+		case t.started && t.restart:
+			transfer = m.downloader.Restart
+		case t.started:
+			transfer = m.downloader.Resume
+		}
+
+		t.status = StatusActive
+		t.started = true
+		t.restart = false
+		t.err = nil
+		m.active++
+
+		events = append(events, Event{ID: entry.ID(), Status: StatusActive})
+		go m.run(t, transfer)
+	}
+
+	return events
+}
+
+func (m *Manager) run(t *task, transfer func(entry Entry) error) {
+	err := transfer(t.entry)
+
+	m.mu.Lock()
+	m.active--
+
+	// the entry which is restarted while it is active can only be queued once it is stopped
+	if t.status == StatusWaiting && t.restart {
+		m.queue.Push(t.entry)
+	}
+
+	// the status is already changed when the entry is paused or removed by the manager
+	if t.status == StatusActive {
+		switch {
+		case errors.Is(err, ErrPaused):
+			t.status = StatusPaused
+
+			// the entry may be paused by the downloader itself, e.g until there is enough space to continue
+			if err != ErrPaused {
+				t.err = err
+			}
+		case errors.Is(err, ErrCancelled):
+			t.status = StatusRemoved
+		case err != nil:
+			t.status = StatusError
+			t.err = err
+		case t.entry.Context().Err() != nil:
+			t.status = StatusPaused
+		default:
+			t.status = StatusComplete
+			t.complete()
+		}
+	}
+
+	if err != nil && err != ErrPaused && err != ErrCancelled {
+		m.logger.Warn("Entry is stopped with error", "entry", t.entry.ID(), "status", t.status, "error", err)
+	}
+
+	t.speed = 0
+	events := []Event{{ID: t.entry.ID(), Status: t.status, Err: t.err}}
+	events = append(events, m.schedule()...)
+	m.mu.Unlock()
+
+	m.emit(events)
+}
+
+// complete fills the progress of every chunk, as a chunk can be skipped without any progress when its file already exists
+func (t *task) complete() {
+	if t.entry.Size() <= 0 || len(t.chunks) == 0 {
+		return
+	}
+
+	for i := range t.chunks {
+		t.chunks[i] = 0
+	}
+
+	t.chunks[0] = t.entry.Size()
+}
+
+// Pause stops the active entry or holds the waiting entry, so it can be continued later with Unpause
+func (m *Manager) Pause(id string) error {
+	return m.stop(id, StatusPaused)
+}
+
+// Remove stops the entry for good. The completed file is kept, while what is downloaded by the active entry is removed
+// if the downloader can cancel it
+func (m *Manager) Remove(id string) error {
+	return m.stop(id, StatusRemoved)
+}
+
+func (m *Manager) stop(id string, status Status) error {
+	m.mu.Lock()
+
+	t, ok := m.tasks[id]
+	if !ok {
+		m.mu.Unlock()
+		return ErrEntryNotFound
+	}
+
+	switch t.status {
+	case StatusWaiting, StatusPaused:
+		if t.status == status {
+			m.mu.Unlock()
+			return nil
+		}
+
+		t.status = status
+		m.mu.Unlock()
+
+		m.emit([]Event{{ID: id, Status: status}})
+		return nil
+	case StatusActive:
+		t.status = status
+		m.mu.Unlock()
+
+		stop := m.downloader.Stop
+		if canceller, ok := m.downloader.(Canceller); ok && status == StatusRemoved {
+			stop = canceller.Cancel
+		}
+
+		// the event is emitted by run once the download is really stopped
+		if err := stop(t.entry); err != nil {
+			m.mu.Lock()
+			t.status = StatusActive
+			m.mu.Unlock()
+
+			return err
+		}
+
+		return nil
+	}
+
+	m.mu.Unlock()
+	return ErrInvalidStatus
+}
+
+// Unpause puts the paused or failed entry back into the queue, so it continues from what is already downloaded
+func (m *Manager) Unpause(id string) error {
+	m.mu.Lock()
+
+	t, ok := m.tasks[id]
+	if !ok {
+		m.mu.Unlock()
+		return ErrEntryNotFound
+	}
+
+	if t.status != StatusPaused && t.status != StatusError {
+		m.mu.Unlock()
+		return ErrInvalidStatus
+	}
+
+	t.status = StatusWaiting
+	m.queue.Push(t.entry)
+
+	events := []Event{{ID: id, Status: StatusWaiting}}
+	events = append(events, m.schedule()...)
+	m.mu.Unlock()
+
+	m.emit(events)
+	return nil
+}
+
+// Restart puts the entry back into the queue to be downloaded from the beginning. The active entry is stopped first
+func (m *Manager) Restart(id string) error {
+	m.mu.Lock()
+
+	t, ok := m.tasks[id]
+	if !ok {
+		m.mu.Unlock()
+		return ErrEntryNotFound
+	}
+
+	if t.status == StatusWaiting && t.restart {
+		m.mu.Unlock()
+		return nil
+	}
+
+	active := t.status == StatusActive
+	t.status = StatusWaiting
+	t.restart = true
+	t.transferred, t.last = 0, 0
+	for i := range t.chunks {
+		t.chunks[i] = 0
+		t.seen[i] = false
+	}
+
+	if active {
+		m.mu.Unlock()
+		return m.downloader.Stop(t.entry)
+	}
+
+	m.queue.Push(t.entry)
+
+	events := []Event{{ID: id, Status: StatusWaiting}}
+	events = append(events, m.schedule()...)
+	m.mu.Unlock()
+
+	m.emit(events)
+	return nil
+}
+
+// Purge forgets the entry which is not active anymore, so it is no longer listed
+func (m *Manager) Purge(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[id]
+	if !ok {
+		return ErrEntryNotFound
+	}
+
+	if t.status == StatusActive {
+		return ErrInvalidStatus
+	}
+
+	delete(m.tasks, id)
+	for i, existing := range m.order {
+		if existing == id {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Get returns the snapshot of the entry
+func (m *Manager) Get(id string) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[id]
+	if !ok {
+		return Task{}, ErrEntryNotFound
+	}
+
+	return t.snapshot(), nil
+}
+
+// List returns the snapshot of the entries in the order they are added. Every entry is returned if no status is given
+func (m *Manager) List(statuses ...Status) []Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := make([]Task, 0, len(m.order))
+	for _, id := range m.order {
+		t := m.tasks[id]
+		if len(statuses) > 0 && !hasStatus(statuses, t.status) {
+			continue
+		}
+
+		tasks = append(tasks, t.snapshot())
+	}
+
+	return tasks
+}
+
+func hasStatus(statuses []Status, status Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stat returns the summary of every entry
+func (m *Manager) Stat() GlobalStat {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat := GlobalStat{}
+	for _, t := range m.tasks {
+		stat.Speed += t.speed
+
+		switch t.status {
+		case StatusActive:
+			stat.Active++
+		case StatusWaiting, StatusPaused:
+			stat.Waiting++
+		default:
+			stat.Stopped++
+		}
+	}
+
+	return stat
+}
+
+// SetMaxActive changes how many entries can be downloaded at the same time. Zero means unlimited
+func (m *Manager) SetMaxActive(max int) {
+	m.mu.Lock()
+	m.maxActive = max
+	events := m.schedule()
+	m.mu.Unlock()
+
+	m.emit(events)
+}
+
+// SetRateLimit changes the maximum download speed in bytes per second if the downloader supports it
+func (m *Manager) SetRateLimit(rate int64) error {
+	throttler, ok := m.downloader.(Throttler)
+	if !ok {
+		return fmt.Errorf("downloader does not support changing the rate limit")
+	}
+
+	throttler.SetRateLimit(rate)
+	return nil
+}
+
+// Prioritize changes how much of the shared connections the entry gets, which applies to its active download as well
+func (m *Manager) Prioritize(id string, priority Priority) error {
+	priority, err := ParsePriority(string(priority))
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	t, ok := m.tasks[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return ErrEntryNotFound
+	}
+
+	prioritizer, ok := t.entry.(EntryPrioritizer)
+	if !ok {
+		return fmt.Errorf("entry does not support changing the priority")
+	}
+
+	prioritizer.Prioritize(priority)
+	return nil
+}
+
+// Subscribe registers the listener of the events. It returns the function to unregister it
+func (m *Manager) Subscribe(listener OnEvent) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.listenerID
+	m.listenerID++
+	m.listeners[id] = listener
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		delete(m.listeners, id)
+	}
+}
+
+func (m *Manager) emit(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	listeners := make([]OnEvent, 0, len(m.listeners))
+	for _, listener := range m.listeners {
+		listeners = append(listeners, listener)
+	}
+	m.mu.Unlock()
+
+	for _, event := range events {
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+}
+
+// Close pauses the active entries, stops measuring the speed, and closes the downloader if it can be closed
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+
+		if m.unsubscribe != nil {
+			m.unsubscribe()
+		}
+
+		for _, t := range m.List(StatusActive) {
+			m.Pause(t.Entry.ID())
+		}
+
+		// the downloader which follows the setting, like the default one, stops following it
+		if closer, ok := m.downloader.(io.Closer); ok {
+			closer.Close()
+		}
+	})
+}
+
+// changeState is the StateHook of the downloader, which emits the state change of the managed entry
+func (m *Manager) changeState(entry Entry, from State, to State) {
+	m.mu.Lock()
+	t, ok := m.tasks[entry.ID()]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+
+	event := Event{ID: entry.ID(), Status: t.status, State: to}
+	m.mu.Unlock()
+
+	m.emit([]Event{event})
+}
+
+// update is the OnProgress of the downloader
+func (m *Manager) update(data ...interface{}) {
+	if len(data) < 3 {
+		return
+	}
+
+	id, _ := data[0].(string)
+	index, _ := data[1].(int)
+	downloaded, _ := data[2].(int64)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[id]
+	if !ok || index < 0 || index >= len(t.chunks) {
+		return
+	}
+
+	// the first update of a chunk may carry the bytes of the previous download, which are not counted into the speed
+	if t.seen[index] && downloaded > t.chunks[index] {
+		t.transferred += downloaded - t.chunks[index]
+	}
+
+	t.seen[index] = true
+	t.chunks[index] = downloaded
+}
+
+func (m *Manager) measure() {
+	ticker := time.NewTicker(speedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		for _, t := range m.tasks {
+			if t.status != StatusActive {
+				continue
+			}
+
+			t.speed = int64(float64(t.transferred-t.last) / speedInterval.Seconds())
+			t.last = t.transferred
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (t *task) snapshot() Task {
+	downloaded := int64(0)
+	for _, chunk := range t.chunks {
+		downloaded += chunk
+	}
+
+	return Task{
+		Entry:      t.entry,
+		Status:     t.status,
+		Downloaded: downloaded,
+		Speed:      t.speed,
+		Err:        t.err,
+		State:      entryState(t.entry),
+	}
+}
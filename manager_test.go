@@ -0,0 +1,229 @@
+package rapid
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func waitStatus(t *testing.T, events chan Event, id string, status Status) {
+	t.Helper()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.ID == id && event.Status == status {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timeout waiting entry %s to be %s", id, status)
+		}
+	}
+}
+
+func TestManagerDownload(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	manager := NewManager(downloader, NewQueue(QueueDefault, setting), setting)
+	defer manager.Close()
+
+	events := make(chan Event, 10)
+	manager.Subscribe(func(event Event) { events <- event })
+
+	if err := manager.Add(entry); err != nil {
+		t.Fatal("Error adding entry:", err.Error())
+	}
+
+	if err := manager.Add(entry); err != ErrEntryExists {
+		t.Errorf("Expected %v, got %v", ErrEntryExists, err)
+	}
+
+	waitStatus(t, events, entry.ID(), StatusComplete)
+
+	task, err := manager.Get(entry.ID())
+	if err != nil {
+		t.Fatal("Error getting entry:", err.Error())
+	}
+
+	if task.Downloaded != entry.Size() {
+		t.Errorf("Expected %d bytes downloaded, got %d", entry.Size(), task.Downloaded)
+	}
+
+	if _, err := os.Stat(entry.Location()); err != nil {
+		t.Error("Expected the file to be downloaded:", err)
+	}
+
+	if stat := manager.Stat(); stat.Stopped != 1 || stat.Active != 0 {
+		t.Errorf("Expected 1 stopped entry, got %+v", stat)
+	}
+}
+
+func TestManagerPauseUnpause(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.rateLimit = 1024
+	setting.maxActiveEntries = 1
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 2048))
+
+	first, err := Fetch(server.URL+"/first.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	second, err := Fetch(server.URL+"/second.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	manager := NewManager(downloader, NewQueue(QueueDefault, setting), setting)
+	defer manager.Close()
+
+	events := make(chan Event, 20)
+	manager.Subscribe(func(event Event) { events <- event })
+
+	manager.Add(first)
+	manager.Add(second)
+	waitStatus(t, events, first.ID(), StatusActive)
+
+	// only one entry can be active, so the second one is still waiting
+	if err := manager.Pause(second.ID()); err != nil {
+		t.Fatal("Error pausing waiting entry:", err.Error())
+	}
+
+	if err := manager.Pause(first.ID()); err != nil {
+		t.Fatal("Error pausing active entry:", err.Error())
+	}
+
+	waitStatus(t, events, first.ID(), StatusPaused)
+
+	// nothing is scheduled as the only waiting entry is paused
+	if len(manager.List(StatusActive)) != 0 {
+		t.Error("Expected no active entry")
+	}
+
+	manager.SetRateLimit(0)
+	if err := manager.Unpause(first.ID()); err != nil {
+		t.Fatal("Error unpausing entry:", err.Error())
+	}
+
+	waitStatus(t, events, first.ID(), StatusComplete)
+
+	if err := manager.Remove(second.ID()); err != nil {
+		t.Fatal("Error removing entry:", err.Error())
+	}
+
+	if err := manager.Unpause(second.ID()); err == nil {
+		t.Error("Expected removed entry to not be able to be unpaused")
+	}
+
+	file, err := os.Stat(first.Location())
+	if err != nil || file.Size() != first.Size() {
+		t.Errorf("Expected the resumed file to be complete, got %v", err)
+	}
+}
+
+func TestManagerRestartPurge(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetDuplicatePolicy(DuplicateOverwrite))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	manager := NewManager(downloader, NewQueue(QueueDefault, setting), setting)
+	defer manager.Close()
+
+	events := make(chan Event, 20)
+	manager.Subscribe(func(event Event) { events <- event })
+
+	manager.Add(entry)
+	waitStatus(t, events, entry.ID(), StatusComplete)
+
+	if err := manager.Unpause(entry.ID()); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("Expected the complete entry not to be unpaused, got %v", err)
+	}
+
+	// the complete entry is downloaded again from the beginning
+	if err := manager.Restart(entry.ID()); err != nil {
+		t.Fatal("Error restarting entry:", err.Error())
+	}
+
+	waitStatus(t, events, entry.ID(), StatusComplete)
+	if tasks := manager.List(StatusComplete); len(tasks) != 1 || tasks[0].Downloaded != entry.Size() {
+		t.Errorf("Expected the restarted entry to be complete, got %+v", tasks)
+	}
+
+	if err := manager.Purge(entry.ID()); err != nil {
+		t.Fatal("Error purging entry:", err.Error())
+	}
+
+	if _, err := manager.Get(entry.ID()); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Expected the purged entry to be forgotten, got %v", err)
+	}
+
+	if len(manager.List()) != 0 {
+		t.Errorf("Expected no entry after purging, got %+v", manager.List())
+	}
+}
+
+func TestManagerSetMaxActive(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.rateLimit = 1024
+	setting.maxActiveEntries = 1
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 2048))
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	manager := NewManager(downloader, NewQueue(QueueDefault, setting), setting)
+	defer manager.Close()
+
+	events := make(chan Event, 20)
+	manager.Subscribe(func(event Event) { events <- event })
+
+	var ids []string
+	for _, name := range []string{"first.bin", "second.bin"} {
+		entry, err := Fetch(server.URL+"/"+name, SetEntrySetting(setting))
+		if err != nil {
+			t.Fatal("Error fetching url:", err.Error())
+		}
+
+		manager.Add(entry)
+		ids = append(ids, entry.ID())
+	}
+
+	waitStatus(t, events, ids[0], StatusActive)
+	if stat := manager.Stat(); stat.Active != 1 || stat.Waiting != 1 {
+		t.Errorf("Expected 1 active and 1 waiting entry, got %+v", stat)
+	}
+
+	// the entries are listed in the order they are added
+	if tasks := manager.List(); len(tasks) != 2 || tasks[0].Entry.ID() != ids[0] || tasks[1].Entry.ID() != ids[1] {
+		t.Errorf("Expected the entries in the order they are added, got %+v", tasks)
+	}
+
+	manager.SetMaxActive(2)
+	waitStatus(t, events, ids[1], StatusActive)
+
+	if err := manager.Purge(ids[0]); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("Expected the active entry not to be purged, got %v", err)
+	}
+
+	if err := manager.Prioritize(ids[1], PriorityHigh); err != nil {
+		t.Errorf("Expected the entry to be prioritized, got %v", err)
+	}
+
+	if err := manager.Pause("missing"); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Expected %v, got %v", ErrEntryNotFound, err)
+	}
+}
@@ -0,0 +1,224 @@
+package rapid
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	counter struct {
+		value atomic.Int64
+	}
+
+	gauge struct {
+		value atomic.Int64
+	}
+
+	// counterVec is a counter that is partitioned by a label, e.g host
+	counterVec struct {
+		mu     sync.Mutex
+		values map[string]int64
+	}
+
+	histogram struct {
+		mu      sync.Mutex
+		buckets []float64
+		counts  []int64
+		sum     float64
+		count   int64
+	}
+
+	// collector holds the metrics of every downloader, worker, and chunk in this process
+	collector struct {
+		downloadedBytes *counter
+		hostBytes       *counterVec
+		activeEntries   *gauge
+		activeChunks    *gauge
+		workers         *gauge
+		retries         *counter
+		throttles       *counterVec
+		mergedRanges    *counterVec
+		failures        *counterVec
+		mergeDuration   *histogram
+	}
+)
+
+var metrics = &collector{
+	downloadedBytes: &counter{},
+	hostBytes:       &counterVec{values: make(map[string]int64)},
+	activeEntries:   &gauge{},
+	activeChunks:    &gauge{},
+	workers:         &gauge{},
+	retries:         &counter{},
+	throttles:       &counterVec{values: make(map[string]int64)},
+	mergedRanges:    &counterVec{values: make(map[string]int64)},
+	failures:        &counterVec{values: make(map[string]int64)},
+	mergeDuration:   newHistogram([]float64{0.1, 0.5, 1, 5, 10, 30, 60, 300}),
+}
+
+func (c *counter) add(n int64) {
+	c.value.Add(n)
+}
+
+func (g *gauge) add(n int64) {
+	g.value.Add(n)
+}
+
+func (c *counterVec) add(label string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[label] += n
+}
+
+func (c *counterVec) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make(map[string]int64, len(c.values))
+	for label, value := range c.values {
+		values[label] = value
+	}
+
+	return values
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]int64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bucket := range h.buckets {
+		if value <= bucket {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+// hostOf returns the host of the url which is used as the label of the per host metrics
+func hostOf(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+
+	return u.Hostname()
+}
+
+// failureCause classifies the error of a failed download
+func failureCause(err error) string {
+	var netErr net.Error
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+
+	switch {
+	case errors.Is(err, errUrlExpired):
+		return "expired"
+	case errors.Is(err, ErrDuplicate):
+		return "duplicate"
+	case errors.Is(err, ErrChecksumMismatch):
+		return "checksum"
+	case errors.Is(err, ErrThrottled):
+		return "throttled"
+	case errors.Is(err, errExtractSize), errors.Is(err, errExtractRatio), errors.Is(err, errExtractFiles), errors.Is(err, errExtractPath):
+		return "extract"
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return "network"
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return "filesystem"
+	}
+
+	return "other"
+}
+
+// observeMerge records how long the chunks are combined into the actual file
+func observeMerge(start time.Time) {
+	metrics.mergeDuration.observe(time.Since(start).Seconds())
+}
+
+// MetricsHandler serves the metrics of the downloads in the prometheus text format
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.write(w)
+	})
+}
+
+func (c *collector) write(w io.Writer) {
+	writeMetric(w, "rapid_downloaded_bytes_total", "counter", "Total bytes downloaded.", c.downloadedBytes.value.Load())
+	writeMetricVec(w, "rapid_host_downloaded_bytes_total", "counter", "Total bytes downloaded per host. The throughput is the rate of it.", "host", c.hostBytes.snapshot())
+	writeMetric(w, "rapid_active_entries", "gauge", "Number of entries being downloaded.", c.activeEntries.value.Load())
+	writeMetric(w, "rapid_active_chunks", "gauge", "Number of chunks being downloaded by the workers.", c.activeChunks.value.Load())
+	writeMetric(w, "rapid_workers", "gauge", "Number of running worker goroutines.", c.workers.value.Load())
+	writeMetric(w, "rapid_retries_total", "counter", "Total retries of failed chunks.", c.retries.value.Load())
+	writeMetricVec(w, "rapid_host_throttles_total", "counter", "Total times the connections to the host are lowered because it throttles.", "host", c.throttles.snapshot())
+	writeMetricVec(w, "rapid_host_merged_ranges_total", "counter", "Total ranges of the throttled chunks which are merged into the other chunks.", "host", c.mergedRanges.snapshot())
+	writeMetricVec(w, "rapid_failures_total", "counter", "Total failed downloads by cause.", "cause", c.failures.snapshot())
+	c.mergeDuration.write(w, "rapid_merge_duration_seconds", "Duration of combining the chunks into the actual file.")
+}
+
+func writeMetric(w io.Writer, name string, kind string, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+func writeMetricVec(w io.Writer, name string, kind string, help string, label string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+
+	labels := make([]string, 0, len(values))
+	for value := range values {
+		labels = append(labels, value)
+	}
+	sort.Strings(labels)
+
+	for _, value := range labels {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, escapeLabel(value), values[value])
+	}
+}
+
+func (h *histogram) write(w io.Writer, name string, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bucket := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bucket), h.counts[i])
+	}
+
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return fmt.Sprint(value)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
@@ -0,0 +1,96 @@
+package rapid
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandlerAfterDownload(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	before := metrics.downloadedBytes.value.Load()
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	if downloaded := metrics.downloadedBytes.value.Load() - before; downloaded < entry.Size() {
+		t.Errorf("Expected at least %d bytes to be recorded, but got %d", entry.Size(), downloaded)
+	}
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"# TYPE rapid_downloaded_bytes_total counter",
+		`rapid_host_downloaded_bytes_total{host="127.0.0.1"}`,
+		"rapid_active_entries 0",
+		"# TYPE rapid_merge_duration_seconds histogram",
+		`rapid_merge_duration_seconds_bucket{le="+Inf"}`,
+		"rapid_merge_duration_seconds_count",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %s, but got\n%s", expected, body)
+		}
+	}
+
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Expected prometheus content type, but got %s", recorder.Header().Get("Content-Type"))
+	}
+}
+
+func TestFailureCause(t *testing.T) {
+	testCases := map[string]error{
+		"expired":    errUrlExpired,
+		"duplicate":  fmt.Errorf("wrapped: %w", ErrDuplicate),
+		"extract":    errExtractRatio,
+		"network":    io.ErrUnexpectedEOF,
+		"filesystem": &os.PathError{Op: "open", Path: "file", Err: os.ErrPermission},
+		"other":      fmt.Errorf("something else"),
+	}
+
+	for expected, err := range testCases {
+		t.Run(expected, func(t *testing.T) {
+			if cause := failureCause(err); cause != expected {
+				t.Errorf("Expected cause to be %s, but got %s", expected, cause)
+			}
+		})
+	}
+}
+
+func TestHistogramWrite(t *testing.T) {
+	h := newHistogram([]float64{1, 5})
+	h.observe(0.5)
+	h.observe(3)
+	h.observe(10)
+
+	var buffer bytes.Buffer
+	h.write(&buffer, "test_seconds", "Test.")
+
+	expected := strings.Join([]string{
+		"# HELP test_seconds Test.",
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="1"} 1`,
+		`test_seconds_bucket{le="5"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		"test_seconds_sum 13.5",
+		"test_seconds_count 3",
+	}, "\n") + "\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Expected histogram to be\n%s\nbut got\n%s", expected, buffer.String())
+	}
+}
@@ -0,0 +1,55 @@
+package rapid
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllowOrigin checks whether the request to the local server, e.g the api or the json-rpc, comes from the allowed
+// origin, since the browser sends the request of another origin even without cors. The request without origin doesn't
+// come from a browser, and the one from the same origin is the web ui served along with the server. The wildcard "*"
+// allows every origin, but only when the server requires a secret, otherwise any page the user opens could control the
+// downloads
+func AllowOrigin(r *http.Request, origins []string, secret bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range origins {
+		if (allowed == "*" && secret) || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowHost checks whether the request to the local server, which doesn't require a secret, is addressed to the server
+// itself. Another page can't reach the server through its own origin by resolving its name into the address of the
+// server, e.g DNS rebinding, as the Host is still its name. So only the IP address, localhost, and the name the server
+// listens on are allowed
+func AllowHost(r *http.Request, listen string) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil {
+		return true
+	}
+
+	listenHost, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		listenHost = listen
+	}
+
+	return listenHost != "" && strings.EqualFold(host, listenHost)
+}
@@ -0,0 +1,241 @@
+package rapid
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type (
+	// PartitionStrategy decides how many chunks the entry of certain size is split into, so every chunk is downloaded by
+	// its own connection. It is only used for the entry which is resumable and whose size is known
+	PartitionStrategy interface {
+		Partition(size int64, setting Setting) int
+
+		// String returns the strategy in the form which ParsePartitionStrategy parses, e.g count=8
+		String() string
+	}
+
+	// heuristicPartition makes the chunks bigger as the size has more digits, so the big file doesn't end up with too many chunks
+	heuristicPartition struct{}
+
+	countPartition struct {
+		count int
+	}
+
+	sizePartition struct {
+		size int64
+	}
+
+	limitPartition struct {
+		PartitionStrategy
+		max int
+	}
+
+	// hostLimitPartition caps the chunks to the max connections of the host, which is known once it is given by forHost
+	hostLimitPartition struct {
+		PartitionStrategy
+		host string
+	}
+
+	// hostPartitioner is implemented by the strategy which depends on the host the entry is downloaded from
+	hostPartitioner interface {
+		forHost(host string) PartitionStrategy
+	}
+)
+
+// HeuristicPartition splits the entry into chunks of at least MinChunkSize, which grow by the number of digits of the size
+// in MB, e.g 100 MB is split into chunks of MinChunkSize * 3 * 3. This is the default strategy
+func HeuristicPartition() PartitionStrategy {
+	return heuristicPartition{}
+}
+
+// CountPartition splits the entry into the number of chunks of the same size, unless the entry is smaller than MinChunkSize
+func CountPartition(count int) PartitionStrategy {
+	return countPartition{count: count}
+}
+
+// SizePartition splits the entry into as many chunks as it takes for the chunks to be no bigger than the size in bytes.
+// The size only decides how many chunks there are, not how big each of them is: the entry is divided evenly among them
+// like the other strategies and the last one takes the remainder, so the chunks don't have the exact size, e.g 10 bytes
+// with size=9 are split into 2 chunks of 5 bytes, and with size=3 into 4 chunks of 2, 2, 2 and 4 bytes
+func SizePartition(size int64) PartitionStrategy {
+	return sizePartition{size: size}
+}
+
+// LimitPartition caps the chunks of the strategy, e.g to the max connections of the host
+func LimitPartition(strategy PartitionStrategy, max int) PartitionStrategy {
+	return limitPartition{PartitionStrategy: strategy, max: max}
+}
+
+// HostLimitPartition caps the chunks of the strategy to the max connections of the host the entry is downloaded from, as
+// the chunks above it would only wait for the connection of another chunk
+func HostLimitPartition(strategy PartitionStrategy) PartitionStrategy {
+	return hostLimitPartition{PartitionStrategy: strategy}
+}
+
+// ParsePartitionStrategy parses the strategy, which is heuristic, count=N, or size=N, optionally capped with max=N or with
+// max=host for the max connections of the host, e.g "size=10485760,max=8"
+func ParsePartitionStrategy(text string) (PartitionStrategy, error) {
+	parts := strings.Split(text, ",")
+
+	var strategy PartitionStrategy
+	name, value, _ := strings.Cut(strings.TrimSpace(parts[0]), "=")
+	switch name {
+	case "heuristic":
+		strategy = HeuristicPartition()
+	case "count":
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid partition %q, count must be a positive integer", text)
+		}
+
+		strategy = CountPartition(count)
+	case "size":
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid partition %q, size must be a positive integer", text)
+		}
+
+		strategy = SizePartition(size)
+	default:
+		return nil, fmt.Errorf("unknown partition %q, must be heuristic, count=N, or size=N", text)
+	}
+
+	for _, part := range parts[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "max" && value == "host" {
+			strategy = HostLimitPartition(strategy)
+			continue
+		}
+
+		max, err := strconv.Atoi(value)
+		if name != "max" || err != nil || max < 1 {
+			return nil, fmt.Errorf("invalid partition %q, only max=N or max=host can follow the strategy", text)
+		}
+
+		strategy = LimitPartition(strategy, max)
+	}
+
+	return strategy, nil
+}
+
+// SetPartitionStrategy overrides the partition strategy of the setting for the entry
+func SetPartitionStrategy(strategy PartitionStrategy) EntryOptions {
+	return func(o *entryOption) {
+		o.partition = strategy
+	}
+}
+
+func (heuristicPartition) Partition(size int64, setting Setting) int {
+	if size < setting.MinChunkSize() {
+		return 1
+	}
+
+	partsize := setting.MinChunkSize()
+	if partsize <= 0 {
+		return 1
+	}
+
+	// the entry under 1 MB has no digit in MB, and the log of zero is -Inf
+	total := 0
+	if mb := size / (1024 * 1024); mb > 0 {
+		total = int(math.Log10(float64(mb)))
+	}
+
+	// dampening the total partition based on digit figures, e.g 100 -> 3 digits
+	for i := 0; i < total; i++ {
+		partsize *= int64(total) + 1
+	}
+
+	return int(size / partsize)
+}
+
+func (heuristicPartition) String() string {
+	return "heuristic"
+}
+
+func (p countPartition) Partition(size int64, setting Setting) int {
+	if size < setting.MinChunkSize() {
+		return 1
+	}
+
+	return p.count
+}
+
+func (p countPartition) String() string {
+	return fmt.Sprintf("count=%d", p.count)
+}
+
+func (p sizePartition) Partition(size int64, setting Setting) int {
+	if p.size <= 0 {
+		return 1
+	}
+
+	return int((size + p.size - 1) / p.size)
+}
+
+func (p sizePartition) String() string {
+	return fmt.Sprintf("size=%d", p.size)
+}
+
+func (p limitPartition) Partition(size int64, setting Setting) int {
+	return min(p.PartitionStrategy.Partition(size, setting), p.max)
+}
+
+func (p limitPartition) String() string {
+	return fmt.Sprintf("%s,max=%d", p.PartitionStrategy, p.max)
+}
+
+func (p limitPartition) forHost(host string) PartitionStrategy {
+	p.PartitionStrategy = partitionForHost(p.PartitionStrategy, host)
+	return p
+}
+
+func (p hostLimitPartition) Partition(size int64, setting Setting) int {
+	chunks := p.PartitionStrategy.Partition(size, setting)
+	if max := setting.MaxConnectionsPerHost(p.host); max > 0 {
+		return min(chunks, max)
+	}
+
+	return chunks
+}
+
+func (p hostLimitPartition) String() string {
+	return fmt.Sprintf("%s,max=host", p.PartitionStrategy)
+}
+
+func (p hostLimitPartition) forHost(host string) PartitionStrategy {
+	p.PartitionStrategy = partitionForHost(p.PartitionStrategy, host)
+	p.host = host
+	return p
+}
+
+// partitionForHost gives the host the entry is downloaded from to the strategy which depends on it
+func partitionForHost(strategy PartitionStrategy, host string) PartitionStrategy {
+	if partitioner, ok := strategy.(hostPartitioner); ok {
+		return partitioner.forHost(host)
+	}
+
+	return strategy
+}
+
+// calculatePartition calculates how many chunks the entry of certain size is split into with the strategy. There is at
+// least one chunk, and every chunk has at least one byte
+func calculatePartition(size int64, strategy PartitionStrategy, setting Setting) int {
+	if size <= 0 {
+		return 1
+	}
+
+	chunks := strategy.Partition(size, setting)
+	if chunks < 1 {
+		return 1
+	}
+
+	if int64(chunks) > size {
+		return int(size)
+	}
+
+	return chunks
+}
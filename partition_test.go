@@ -0,0 +1,190 @@
+package rapid
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// partitionCase is the random entry size and strategy of the property tests
+type partitionCase struct {
+	size     int64
+	strategy PartitionStrategy
+}
+
+func (partitionCase) Generate(r *rand.Rand, _ int) reflect.Value {
+	// the sizes are spread from a few bytes up to a few GB
+	size := r.Int63n(1 << uint(r.Intn(33)+1))
+	strategies := []PartitionStrategy{
+		HeuristicPartition(),
+		CountPartition(r.Intn(64) + 1),
+		SizePartition(r.Int63n(1<<24) + 1),
+		LimitPartition(CountPartition(r.Intn(64)+1), r.Intn(8)+1),
+		LimitPartition(HeuristicPartition(), r.Intn(8)+1),
+		HostLimitPartition(CountPartition(r.Intn(64) + 1)),
+	}
+
+	return reflect.ValueOf(partitionCase{size: size, strategy: strategies[r.Intn(len(strategies))]})
+}
+
+func TestPartitionCoversEntry(t *testing.T) {
+	setting := testSetting(t)
+
+	covers := func(c partitionCase) bool {
+		e := &entry{size: c.size, chunkLen: calculatePartition(c.size, c.strategy, setting)}
+		if e.chunkLen < 1 {
+			t.Logf("size %d with %s has %d chunks", c.size, c.strategy, e.chunkLen)
+			return false
+		}
+
+		// every chunk starts where the previous one ends, and none of them is empty
+		chunkSize := e.size / int64(e.chunkLen)
+		var next int64
+		for i := 0; i < e.chunkLen; i++ {
+			start, end := calculatePosition(e, chunkSize, i)
+			length := chunkLength(e, start, end)
+			if start != next || (length < 1 && e.size > 0) {
+				t.Logf("size %d with %s: chunk %d is [%d, %d) but expected to start at %d", c.size, c.strategy, i, start, start+length, next)
+				return false
+			}
+
+			next = start + length
+		}
+
+		if next != e.size {
+			t.Logf("size %d with %s: chunks end at %d", c.size, c.strategy, next)
+			return false
+		}
+
+		return true
+	}
+
+	if err := quick.Check(covers, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPartitionLimit(t *testing.T) {
+	setting := testSetting(t)
+
+	limited := func(c partitionCase, n uint8) bool {
+		limit := int(n%16) + 1
+		return calculatePartition(c.size, LimitPartition(c.strategy, limit), setting) <= limit
+	}
+
+	if err := quick.Check(limited, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHeuristicPartitionSmall(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.minChunkSize = 64 * 1024
+
+	// the entry under 1 MB is split by the min chunk size alone
+	if chunks := HeuristicPartition().Partition(512*1024, setting); chunks != 8 {
+		t.Errorf("Expected 8 chunks, got %d", chunks)
+	}
+
+	if chunks := HeuristicPartition().Partition(100*1024*1024, setting); chunks != 100*1024*1024/(64*1024*3*3) {
+		t.Errorf("Expected the chunks to grow by the digits of the size, got %d", chunks)
+	}
+}
+
+func TestParsePartitionStrategy(t *testing.T) {
+	testCases := map[string]string{
+		"heuristic":              "heuristic",
+		"count=8":                "count=8",
+		" size=1048576 , max=4 ": "size=1048576,max=4",
+		"heuristic,max=2,max=1":  "heuristic,max=2,max=1",
+		"count=8,max=host":       "count=8,max=host",
+		"count=8,max=all":        "",
+		"count=0":                "",
+		"size=big":               "",
+		"fast":                   "",
+		"count=4,min=2":          "",
+	}
+
+	for text, expected := range testCases {
+		strategy, err := ParsePartitionStrategy(text)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("Expected %q to be invalid, got %s", text, strategy)
+			}
+
+			continue
+		}
+
+		if err != nil || strategy.String() != expected {
+			t.Errorf("Expected %q to be parsed into %s, got %v %v", text, expected, strategy, err)
+		}
+	}
+}
+
+func TestFetchPartitionStrategy(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, make([]byte, 10*1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetPartitionStrategy(CountPartition(3)))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	if entry.ChunkLen() != 3 {
+		t.Errorf("Expected the entry to be split into 3 chunks, got %d", entry.ChunkLen())
+	}
+}
+
+func TestPartitionHostLimit(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.hostConnections = map[string]int{"example.com": 2}
+
+	strategy := LimitPartition(HostLimitPartition(CountPartition(8)), 6)
+	if n := calculatePartition(1<<20, partitionForHost(strategy, "example.com"), setting); n != 2 {
+		t.Errorf("Expected the chunks to be capped to the connections of the host, got %d", n)
+	}
+
+	if n := calculatePartition(1<<20, partitionForHost(strategy, "other.com"), setting); n != 6 {
+		t.Errorf("Expected the host without limit to be left uncapped, got %d", n)
+	}
+}
+
+func TestDownloadTinyChunks(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.minChunkSize = 1
+	content := []byte("0123456789abcdefghij")
+	server := testServer(t, content)
+
+	for _, text := range []string{"size=1", "count=7", "size=2"} {
+		strategy, _ := ParsePartitionStrategy(text)
+		entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetPartitionStrategy(strategy))
+		if err != nil {
+			t.Fatal("Error fetching url:", err.Error())
+		}
+
+		// the chunks of 2 bytes are resumed with their last byte left
+		if text == "size=2" {
+			os.MkdirAll(chunkDir(setting, entry.ID()), os.ModePerm)
+			for i := 0; i < entry.ChunkLen(); i++ {
+				start, _ := chunkBounds(entry, i)
+				os.WriteFile(chunkPath(setting, entry.ID(), i), content[start:start+1], 0644)
+			}
+		}
+
+		downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+		if err := downloader.Download(entry); err != nil {
+			t.Fatalf("Error downloading with %s: %v", text, err)
+		}
+
+		downloaded, err := os.ReadFile(filepath.Join(setting.downloadLocation, entry.Name()))
+		if err != nil || !bytes.Equal(downloaded, content) {
+			t.Errorf("Expected every byte to be downloaded with %s, got %q %v", text, downloaded, err)
+		}
+
+		os.Remove(filepath.Join(setting.downloadLocation, entry.Name()))
+	}
+}
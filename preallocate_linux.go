@@ -0,0 +1,33 @@
+//go:build linux
+
+package rapid
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize reserves the space without changing the size of the file, since the size tells how much is merged
+const fallocKeepSize = 0x01
+
+// preallocate reserves the size of the file on the disk, so the disk can't be filled up while the file is written. It
+// does nothing on the filesystem which doesn't support it
+func preallocate(file *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	err := syscall.Fallocate(int(file.Fd()), fallocKeepSize, 0, size)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, syscall.ENOSPC):
+		free, _, _ := diskSpace(file.Name())
+		return &InsufficientSpaceError{Path: file.Name(), Required: size, Available: free}
+	case errors.Is(err, syscall.EOPNOTSUPP), errors.Is(err, syscall.ENOSYS), errors.Is(err, syscall.EINVAL):
+		return nil
+	}
+
+	return &os.PathError{Op: "fallocate", Path: file.Name(), Err: err}
+}
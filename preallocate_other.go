@@ -0,0 +1,10 @@
+//go:build !linux
+
+package rapid
+
+import "os"
+
+// preallocate does nothing, as the file can't be reserved on this platform
+func preallocate(file *os.File, size int64) error {
+	return nil
+}
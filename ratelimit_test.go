@@ -0,0 +1,35 @@
+package rapid
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter := newRateLimiter(1000)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.wait(ctx, 500); err != nil {
+			t.Fatal("Error waiting:", err.Error())
+		}
+	}
+
+	// the first 1000 bytes are the burst, the rest have to wait for half a second
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected to be limited, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	var limiter *rateLimiter
+	if err := limiter.wait(context.Background(), 1<<20); err != nil {
+		t.Error("Expected nil limiter to not limit, got", err)
+	}
+
+	if delay := newRateLimiter(0).reserve(1 << 20); delay != 0 {
+		t.Error("Expected zero rate to not limit, got", delay)
+	}
+}
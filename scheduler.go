@@ -0,0 +1,366 @@
+package rapid
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// Priority is how much of the shared connections the entry gets compared to the other entries being downloaded
+	Priority string
+
+	// EntryPrioritizer is implemented by entry which priority can be changed, even while it is downloaded
+	EntryPrioritizer interface {
+		Priority() Priority
+		Prioritize(priority Priority)
+	}
+
+	// scheduler is the pool of workers which is shared by every entry of every downloader, so the connections of every
+	// entry together can't be more than its size. Every entry has its own queue of chunks, and the queues take turns in
+	// the weighted round-robin by the priority of their entries, so no entry can take every worker while the others wait.
+	// The connection to the host of the entry is taken before its job is given to a worker, so the queues whose host is
+	// full are skipped instead of holding the workers which could download from the other hosts
+	scheduler struct {
+		mu      sync.Mutex
+		wake    *sync.Cond
+		limiter *hostLimiter
+		size    int           // zero means a worker for every queued job
+		sized   bool          // whether the size is set, either by the downloader or by SetMaxConnections
+		running int           // the workers which are alive
+		idle    int           // the workers which are waiting for a job, and not woken yet
+		queued  int           // the jobs which are waiting in every queue
+		queues  []*entryQueue // the queues which have jobs, in the order they take turns
+	}
+
+	// entryQueue is the pool of an entry in the scheduler. Its jobs are executed by the workers of the scheduler, while
+	// it tracks them until they are done
+	entryQueue struct {
+		scheduler *scheduler
+		ctx       context.Context
+		entry     Entry
+		host      string
+		setting   Setting // the limit of the connections to the host, nil means unlimited
+		logger    Logger
+		tracker   *jobTracker
+		quit      chan struct{}
+		stop      sync.Once
+		jobs      []Job // guarded by the scheduler
+		current   int   // the credit of the queue in the weighted round-robin, guarded by the scheduler
+		listed    bool  // whether the queue is in the turns of the scheduler, guarded by the scheduler
+		stopped   bool  // guarded by the scheduler
+	}
+)
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+var errUnknownPriority = fmt.Errorf("unknown priority")
+
+var chunkScheduler = newScheduler(0, connections)
+
+// ParsePriority converts the name of the priority, the empty name is the normal priority
+func ParsePriority(name string) (Priority, error) {
+	switch Priority(name) {
+	case "", PriorityNormal:
+		return PriorityNormal, nil
+	case PriorityLow, PriorityHigh:
+		return Priority(name), nil
+	}
+
+	return PriorityNormal, fmt.Errorf("%w %q", errUnknownPriority, name)
+}
+
+// weight is how many jobs of the entry are scheduled for every job of the entry with the low priority
+func (p Priority) weight() int {
+	switch p {
+	case PriorityLow:
+		return 1
+	case PriorityHigh:
+		return 4
+	}
+
+	return 2
+}
+
+// entryPriority returns the priority of the entry, or the normal priority if the entry doesn't have one
+func entryPriority(entry Entry) Priority {
+	if prioritizer, ok := entry.(EntryPrioritizer); ok && prioritizer.Priority() != "" {
+		return prioritizer.Priority()
+	}
+
+	return PriorityNormal
+}
+
+// SetMaxConnections resizes the pool which is shared by every entry, zero means unlimited. The workers above the size
+// exit once their chunks are done, so the connections which are already open are not closed
+func SetMaxConnections(max int) {
+	chunkScheduler.resize(max)
+}
+
+// newScheduler creates the pool of the size, which takes the connections to the hosts from the limiter
+func newScheduler(size int, limiter *hostLimiter) *scheduler {
+	s := &scheduler{size: size, limiter: limiter}
+	s.wake = sync.NewCond(&s.mu)
+
+	// the queues which are skipped for their full host get their turns back once a connection is released
+	if limiter != nil {
+		limiter.subscribe(s.kick)
+	}
+
+	return s
+}
+
+// pool creates the queue of the entry, which jobs are executed with the context. The connections to the host of the
+// entry are limited by the setting
+func (s *scheduler) pool(ctx context.Context, entry Entry, setting Setting, logger Logger) Pool {
+	return &entryQueue{
+		scheduler: s,
+		ctx:       ctx,
+		entry:     entry,
+		host:      hostOf(entry.URL()),
+		setting:   setting,
+		logger:    logger,
+		tracker:   newJobTracker(),
+		quit:      make(chan struct{}),
+	}
+}
+
+// grow sizes the pool the first time, and only grows it afterwards, so the downloader which is created later can't
+// shrink the pool of the ones which are already downloading. Zero is unlimited, which is the largest size
+func (s *scheduler) grow(size int) {
+	s.mu.Lock()
+	sized, current := s.sized, s.size
+	s.mu.Unlock()
+
+	if sized && (current <= 0 || (size > 0 && size <= current)) {
+		return
+	}
+
+	s.resize(size)
+}
+
+func (s *scheduler) resize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sized = true
+	if size == s.size {
+		return
+	}
+
+	s.size = max(size, 0)
+
+	// the idle workers are woken to exit if the pool shrinks, and the new workers pick up the waiting jobs if it grows
+	s.idle = 0
+	s.wake.Broadcast()
+	s.spawn()
+}
+
+// spawn wakes or starts the workers for the waiting jobs within the size. Must be called with the lock held
+func (s *scheduler) spawn() {
+	waiting := s.queued
+	for waiting > 0 && s.idle > 0 {
+		s.idle--
+		waiting--
+		s.wake.Signal()
+	}
+
+	for waiting > 0 && (s.size <= 0 || s.running < s.size) {
+		s.running++
+		waiting--
+		go s.work()
+	}
+}
+
+// kick gives the waiting jobs to the workers again, as there may be room for the host which was full
+func (s *scheduler) kick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spawn()
+}
+
+func (s *scheduler) work() {
+	metrics.workers.add(1)
+	defer metrics.workers.add(-1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.size > 0 && s.running > s.size {
+			s.running--
+			return
+		}
+
+		queue, job, release, delay := s.next()
+		if job == nil {
+			// the workers of the unlimited pool only live as long as there are jobs
+			if s.size <= 0 {
+				s.running--
+				return
+			}
+
+			s.idle++
+			s.wake.Wait()
+			continue
+		}
+
+		s.mu.Unlock()
+
+		// the job which is stopped while waiting for the delay of the host sees the context is done by itself
+		ctx := queue.ctx
+		if s.limited(queue) {
+			ctx = holdHost(ctx, queue.host)
+		}
+
+		sleep(ctx, delay)
+
+		result := execute(ctx, job, queue.logger)
+		release()
+		queue.tracker.done(result)
+		s.mu.Lock()
+	}
+}
+
+// next takes the job of the queue whose turn it is, along with the connection to its host and how long the job has to
+// wait for the delay of the host. Every queue earns the credit of its weight on every turn, and the one with the most
+// credit is taken and pays the weight of every queue, so the queues are taken as often as their weights in the smooth
+// weighted round-robin. The queues whose host is full sit out the turn. Must be called with the lock held
+func (s *scheduler) next() (*entryQueue, Job, func(), time.Duration) {
+	var full map[*entryQueue]bool
+	for {
+		var chosen *entryQueue
+		for _, queue := range s.queues {
+			if full[queue] {
+				continue
+			}
+
+			if chosen == nil || queue.current+entryPriority(queue.entry).weight() > chosen.current+entryPriority(chosen.entry).weight() {
+				chosen = queue
+			}
+		}
+
+		if chosen == nil {
+			return nil, nil, nil, 0
+		}
+
+		release, delay, ok := s.reserve(chosen)
+		if !ok {
+			if full == nil {
+				full = make(map[*entryQueue]bool)
+			}
+
+			full[chosen] = true
+			continue
+		}
+
+		total := 0
+		for _, queue := range s.queues {
+			if !full[queue] {
+				weight := entryPriority(queue.entry).weight()
+				queue.current += weight
+				total += weight
+			}
+		}
+
+		chosen.current -= total
+		return chosen, s.take(chosen), release, delay
+	}
+}
+
+// reserve takes the connection to the host of the queue if there is room for it. Must be called with the lock held
+func (s *scheduler) reserve(queue *entryQueue) (func(), time.Duration, bool) {
+	if !s.limited(queue) {
+		return func() {}, 0, true
+	}
+
+	return s.limiter.tryAcquire(queue.host, queue.setting)
+}
+
+// limited returns whether the connections to the host of the queue are taken by the scheduler
+func (s *scheduler) limited(queue *entryQueue) bool {
+	return s.limiter != nil && queue.setting != nil
+}
+
+// take removes the first job of the queue. Must be called with the lock held
+func (s *scheduler) take(chosen *entryQueue) Job {
+	job := chosen.jobs[0]
+	chosen.jobs[0] = nil
+	chosen.jobs = chosen.jobs[1:]
+	s.queued--
+
+	if len(chosen.jobs) == 0 {
+		s.unlist(chosen)
+	}
+
+	return job
+}
+
+// unlist removes the queue from the turns. Must be called with the lock held
+func (s *scheduler) unlist(queue *entryQueue) {
+	for i, q := range s.queues {
+		if q == queue {
+			s.queues = append(s.queues[:i], s.queues[i+1:]...)
+			break
+		}
+	}
+
+	queue.listed = false
+	queue.current = 0
+}
+
+// Start does nothing, as the workers are started by the scheduler when the jobs are added
+func (q *entryQueue) Start() {}
+
+// Stop drops the jobs which are not started yet, the jobs which are already started are left to finish
+func (q *entryQueue) Stop() {
+	q.stop.Do(func() {
+		s := q.scheduler
+		s.mu.Lock()
+		dropped := len(q.jobs)
+		s.queued -= dropped
+		q.jobs = nil
+		q.stopped = true
+		if q.listed {
+			s.unlist(q)
+		}
+		s.mu.Unlock()
+
+		q.tracker.drop(dropped)
+		close(q.quit)
+	})
+}
+
+func (q *entryQueue) Add(job Job) {
+	s := q.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+
+	q.tracker.add()
+	q.jobs = append(q.jobs, job)
+	s.queued++
+	if !q.listed {
+		s.queues = append(s.queues, q)
+		q.listed = true
+	}
+
+	s.spawn()
+}
+
+func (q *entryQueue) Wait(ctx context.Context) error {
+	return q.tracker.wait(ctx, q.quit)
+}
+
+func (q *entryQueue) Results() []JobResult {
+	return q.tracker.results()
+}
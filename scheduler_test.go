@@ -0,0 +1,291 @@
+package rapid
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockScheduler keeps the only worker of the scheduler busy until the returned function is called, so the jobs which
+// are added in the meantime are queued
+func blockScheduler(t *testing.T, s *scheduler) func() {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	pool := s.pool(ctx, &entry{id: "block"}, nil, NewLogger(testSetting(t)))
+	pool.Add(newTestJob(func() error {
+		close(started)
+		<-release
+		return nil
+	}, false, nil))
+
+	<-started
+	return func() { close(release) }
+}
+
+// orderJobs adds the jobs which record the order they are executed in
+func orderJobs(pool Pool, name string, n int, mu *sync.Mutex, order *[]string) {
+	for i := 0; i < n; i++ {
+		pool.Add(newTestJob(func() error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			*order = append(*order, name)
+			return nil
+		}, false, nil))
+	}
+}
+
+func TestSchedulerRoundRobin(t *testing.T) {
+	s := newScheduler(1, nil)
+	logger := NewLogger(testSetting(t))
+	release := blockScheduler(t, s)
+
+	var mu sync.Mutex
+	var order []string
+
+	first := s.pool(ctx, &entry{id: "first"}, nil, logger)
+	second := s.pool(ctx, &entry{id: "second"}, nil, logger)
+	orderJobs(first, "a", 4, &mu, &order)
+	orderJobs(second, "b", 4, &mu, &order)
+	release()
+
+	if err := first.Wait(ctx); err != nil {
+		t.Fatal("Error waiting the first entry:", err)
+	}
+
+	if err := second.Wait(ctx); err != nil {
+		t.Fatal("Error waiting the second entry:", err)
+	}
+
+	if got := strings.Join(order, ""); got != "abababab" {
+		t.Errorf("Expected the entries to take turns, got %s", got)
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := newScheduler(1, nil)
+	logger := NewLogger(testSetting(t))
+	release := blockScheduler(t, s)
+
+	var mu sync.Mutex
+	var order []string
+
+	low := s.pool(ctx, &entry{id: "low", priority: PriorityLow}, nil, logger)
+	high := s.pool(ctx, &entry{id: "high", priority: PriorityHigh}, nil, logger)
+	orderJobs(low, "l", 3, &mu, &order)
+	orderJobs(high, "h", 8, &mu, &order)
+	release()
+
+	low.Wait(ctx)
+	high.Wait(ctx)
+
+	// the high priority gets 4 turns for every turn of the low priority, without starving it
+	got := strings.Join(order, "")
+	if got[:10] != "hhlhhhhlhh" {
+		t.Errorf("Expected the high priority to get more turns, got %s", got)
+	}
+}
+
+func TestSchedulerMaxConnections(t *testing.T) {
+	s := newScheduler(2, nil)
+	logger := NewLogger(testSetting(t))
+
+	var running, peak atomic.Int64
+	job := func() error {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	var pools []Pool
+	for i := 0; i < 3; i++ {
+		pool := s.pool(ctx, &entry{id: randID(5)}, nil, logger)
+		for j := 0; j < 5; j++ {
+			pool.Add(newTestJob(job, false, nil))
+		}
+
+		pools = append(pools, pool)
+	}
+
+	for _, pool := range pools {
+		if err := pool.Wait(ctx); err != nil {
+			t.Fatal("Error waiting the entry:", err)
+		}
+	}
+
+	if p := peak.Load(); p != 2 {
+		t.Errorf("Expected at most 2 jobs at the same time, got %d", p)
+	}
+}
+
+func TestSchedulerResize(t *testing.T) {
+	s := newScheduler(1, nil)
+	pool := s.pool(ctx, &entry{id: "resize"}, nil, NewLogger(testSetting(t)))
+
+	release := make(chan struct{})
+	var running atomic.Int64
+	for i := 0; i < 3; i++ {
+		pool.Add(newTestJob(func() error {
+			running.Add(1)
+			<-release
+			return nil
+		}, false, nil))
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := running.Load(); n != 1 {
+		t.Fatalf("Expected 1 running job before the resize, got %d", n)
+	}
+
+	s.resize(3)
+
+	deadline := time.Now().Add(time.Second)
+	for running.Load() != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := running.Load(); n != 3 {
+		t.Errorf("Expected 3 running jobs after the resize, got %d", n)
+	}
+
+	close(release)
+	if err := pool.Wait(ctx); err != nil {
+		t.Fatal("Error waiting the entry:", err)
+	}
+}
+
+func TestSchedulerHostFull(t *testing.T) {
+	s := newScheduler(2, newHostLimiter())
+	logger := NewLogger(testSetting(t))
+	setting := testSetting(t).(*settings)
+	setting.hostConnections = map[string]int{"slow.example": 1}
+
+	release := make(chan struct{})
+	var running, peak atomic.Int64
+	slow := s.pool(ctx, &entry{id: "slow", url: "http://slow.example/file"}, setting, logger)
+	for i := 0; i < 3; i++ {
+		slow.Add(newTestJob(func() error {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			if n > peak.Load() {
+				peak.Store(n)
+			}
+
+			<-release
+			return nil
+		}, false, nil))
+	}
+
+	// the other host gets the worker which is left, instead of waiting behind the full host
+	fast := s.pool(ctx, &entry{id: "fast", url: "http://fast.example/file"}, setting, logger)
+	fast.Add(newTestJob(func() error { return nil }, false, nil))
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if err := fast.Wait(waitCtx); err != nil {
+		t.Fatal("Expected the entry of the other host to be downloaded, got", err)
+	}
+
+	close(release)
+	if err := slow.Wait(ctx); err != nil {
+		t.Fatal("Error waiting the entry:", err)
+	}
+
+	if p := peak.Load(); p != 1 {
+		t.Errorf("Expected at most 1 connection to the full host, got %d", p)
+	}
+}
+
+func TestSchedulerGrow(t *testing.T) {
+	s := newScheduler(0, nil)
+
+	s.grow(4)
+	s.grow(2)
+	if s.size != 4 {
+		t.Errorf("Expected the pool not to shrink, got %d", s.size)
+	}
+
+	s.grow(0)
+	if s.size != 0 {
+		t.Errorf("Expected the pool to grow to unlimited, got %d", s.size)
+	}
+
+	s.resize(3)
+	if s.size != 3 {
+		t.Errorf("Expected the pool to be resized, got %d", s.size)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	s := newScheduler(1, nil)
+	logger := NewLogger(testSetting(t))
+	release := blockScheduler(t, s)
+
+	var executed atomic.Int64
+	pool := s.pool(ctx, &entry{id: "stop"}, nil, logger)
+	for i := 0; i < 3; i++ {
+		pool.Add(newTestJob(func() error {
+			executed.Add(1)
+			return nil
+		}, false, nil))
+	}
+
+	pool.Stop()
+
+	// the queued jobs are dropped, so there is nothing left to wait for
+	if err := pool.Wait(ctx); err != nil {
+		t.Errorf("Expected no error from the stopped pool, got %v", err)
+	}
+
+	release()
+	time.Sleep(20 * time.Millisecond)
+	if n := executed.Load(); n != 0 {
+		t.Errorf("Expected the dropped jobs not to be executed, got %d", n)
+	}
+}
+
+func TestEntryPriority(t *testing.T) {
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("Expected error parsing unknown priority")
+	}
+
+	if p, err := ParsePriority(""); err != nil || p != PriorityNormal {
+		t.Errorf("Expected empty priority to be normal, got %s %v", p, err)
+	}
+
+	e := &entry{id: "priority"}
+	if p := entryPriority(e); p != PriorityNormal {
+		t.Errorf("Expected normal priority by default, got %s", p)
+	}
+
+	e.Prioritize(PriorityHigh)
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal("Error marshalling entry:", err)
+	}
+
+	restored := &entry{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal("Error unmarshalling entry:", err)
+	}
+
+	if p := restored.Priority(); p != PriorityHigh {
+		t.Errorf("Expected the priority to be kept, got %s", p)
+	}
+}
@@ -3,6 +3,7 @@ package rapid
 import (
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type (
@@ -10,28 +11,93 @@ type (
 		// location where the download will be placed
 		DownloadLocation() string
 
+		// location where the download with certain file type will be placed, e.g Video into ~/Downloads/Video.
+		// It will be the download location if the file type has no location
+		CategoryLocation(filetype string) string
+
 		// location where the data for this application will be stored
 		DataLocation() string
 
+		// location where the chunks of the incomplete downloads are stored, every entry has its own directory in it
+		TempLocation() string
+
 		// max retry will be executed when there is an Error downloading
 		MaxRetry() int
 
 		// logger provider that will be used to log something, e.g file, std, etc
 		LoggerProvider() string
 
-		// minimum size in MB for a chunk
+		// minimum level of the log that will be written
+		LogLevel() Level
+
+		// maximum size in bytes of the log file before it is rotated
+		LogMaxSize() int64
+
+		// maximum age of the log file before it is rotated
+		LogMaxAge() time.Duration
+
+		// maximum number of the rotated log files to keep
+		LogMaxBackups() int
+
+		// whether every entry has its own log file as well
+		LogPerEntry() bool
+
+		// minimum size in bytes for a chunk
 		MinChunkSize() int64
 
+		// how many chunks the entry is split into
+		PartitionStrategy() PartitionStrategy
+
+		// what to do when the file already exists in the download location
+		DuplicatePolicy() DuplicatePolicy
+
+		// maximum download speed in bytes per second of a downloader, zero means unlimited
+		RateLimit() int64
+
+		// maximum entries that are downloaded at the same time by a manager, the rest are waiting in the queue
+		MaxActiveEntries() int
+
 		HttpClient() string
+
+		// maximum connections of every entry together, which is the size of the pool the chunks are scheduled into.
+		// Zero means unlimited
+		MaxConnections() int
+
+		// maximum connections to the host which are shared by every entry, zero means unlimited
+		MaxConnectionsPerHost(host string) int
+
+		// minimum delay between the new connections to the host
+		ConnectionDelay(host string) time.Duration
+
+		// minimum free space in bytes of the disk to keep, the entry is paused when the free space drops below it.
+		// Zero means the disk is never checked
+		MinFreeSpace() int64
 	}
 
 	settings struct {
-		downloadLocation string
-		dataLocation     string
-		maxRetry         int
-		loggerProvider   string
-		minChunkSize     int64
-		httpClient       string
+		downloadLocation  string
+		dataLocation      string
+		tempLocation      string // empty means the incomplete directory in the data location
+		maxRetry          int
+		loggerProvider    string
+		logLevel          Level
+		logMaxSize        int64
+		logMaxAge         time.Duration
+		logMaxBackups     int
+		logPerEntry       bool
+		minChunkSize      int64
+		partition         PartitionStrategy
+		duplicatePolicy   DuplicatePolicy
+		rateLimit         int64
+		maxActiveEntries  int
+		httpClient        string
+		totalConnections  int
+		maxConnections    int
+		connectionDelay   time.Duration
+		categoryLocations map[string]string        // locations of certain file types, instead of downloadLocation
+		hostConnections   map[string]int           // max connections of certain hosts, instead of maxConnections
+		hostDelays        map[string]time.Duration // connection delay of certain hosts, instead of connectionDelay
+		minFreeSpace      int64
 	}
 )
 
@@ -49,7 +115,17 @@ func DefaultSetting() Setting {
 		dataLocation:     data,
 		maxRetry:         3,
 		loggerProvider:   LoggerStdOut,
+		logLevel:         LevelInfo,
+		logMaxSize:       1024 * 1024 * 10, // 10 MB
+		logMaxAge:        time.Hour * 24 * 7,
+		logMaxBackups:    5,
 		minChunkSize:     1024 * 1024 * 5, // 5 MB
+		partition:        HeuristicPartition(),
+		duplicatePolicy:  DuplicateRename,
+		maxActiveEntries: 3,
+		totalConnections: 32,
+		maxConnections:   8,
+		minFreeSpace:     1024 * 1024 * 100, // 100 MB
 	}
 }
 
@@ -57,10 +133,26 @@ func (s *settings) DownloadLocation() string {
 	return s.downloadLocation
 }
 
+func (s *settings) CategoryLocation(filetype string) string {
+	if location := s.categoryLocations[filetype]; location != "" {
+		return location
+	}
+
+	return s.downloadLocation
+}
+
 func (s *settings) DataLocation() string {
 	return s.dataLocation
 }
 
+func (s *settings) TempLocation() string {
+	if s.tempLocation == "" {
+		return filepath.Join(s.dataLocation, "incomplete")
+	}
+
+	return s.tempLocation
+}
+
 func (s *settings) MaxRetry() int {
 	return s.maxRetry
 }
@@ -69,10 +161,74 @@ func (s *settings) LoggerProvider() string {
 	return s.loggerProvider
 }
 
+func (s *settings) LogLevel() Level {
+	return s.logLevel
+}
+
+func (s *settings) LogMaxSize() int64 {
+	return s.logMaxSize
+}
+
+func (s *settings) LogMaxAge() time.Duration {
+	return s.logMaxAge
+}
+
+func (s *settings) LogMaxBackups() int {
+	return s.logMaxBackups
+}
+
+func (s *settings) LogPerEntry() bool {
+	return s.logPerEntry
+}
+
 func (s *settings) MinChunkSize() int64 {
 	return s.minChunkSize
 }
 
+func (s *settings) PartitionStrategy() PartitionStrategy {
+	if s.partition == nil {
+		return HeuristicPartition()
+	}
+
+	return s.partition
+}
+
+func (s *settings) DuplicatePolicy() DuplicatePolicy {
+	return s.duplicatePolicy
+}
+
+func (s *settings) RateLimit() int64 {
+	return s.rateLimit
+}
+
+func (s *settings) MaxActiveEntries() int {
+	return s.maxActiveEntries
+}
+
 func (s *settings) HttpClient() string {
 	return s.httpClient
 }
+
+func (s *settings) MaxConnections() int {
+	return s.totalConnections
+}
+
+func (s *settings) MaxConnectionsPerHost(host string) int {
+	if max, ok := s.hostConnections[host]; ok {
+		return max
+	}
+
+	return s.maxConnections
+}
+
+func (s *settings) ConnectionDelay(host string) time.Duration {
+	if delay, ok := s.hostDelays[host]; ok {
+		return delay
+	}
+
+	return s.connectionDelay
+}
+
+func (s *settings) MinFreeSpace() int64 {
+	return s.minFreeSpace
+}
@@ -0,0 +1,696 @@
+package rapid
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// SettingBuilder builds the setting on top of the default setting. The values can come from the methods, the setting
+	// file, and the environment variables, whichever is applied last wins
+	SettingBuilder struct {
+		setting settings
+		errs    []error
+	}
+
+	// SettingError is the value of a setting that can't be used
+	SettingError struct {
+		Source string // where the value comes from, e.g the setting file or the environment variable
+		Key    string
+		Err    error
+	}
+
+	// settingField maps the key of a setting in the file and the environment variable onto the settings
+	settingField struct {
+		key string
+		get func(s *settings) interface{}
+		set func(s *settings, value string) error
+	}
+
+	// settingTable maps the table of the setting file, whose keys are the file types or the hosts, onto the builder
+	settingTable struct {
+		key string
+		get func(b *SettingBuilder) map[string]interface{}
+		set func(b *SettingBuilder, name string, value string) error
+	}
+)
+
+const envPrefix = "RAPID_"
+
+var settingFields = []settingField{
+	{
+		key: "downloadLocation",
+		get: func(s *settings) interface{} { return s.downloadLocation },
+		set: func(s *settings, value string) error { s.downloadLocation = value; return nil },
+	},
+	{
+		key: "dataLocation",
+		get: func(s *settings) interface{} { return s.dataLocation },
+		set: func(s *settings, value string) error { s.dataLocation = value; return nil },
+	},
+	{
+		key: "tempLocation",
+		get: func(s *settings) interface{} { return s.tempLocation },
+		set: func(s *settings, value string) error { s.tempLocation = value; return nil },
+	},
+	{
+		key: "maxRetry",
+		get: func(s *settings) interface{} { return s.maxRetry },
+		set: func(s *settings, value string) error { return parseInt(value, &s.maxRetry) },
+	},
+	{
+		key: "loggerProvider",
+		get: func(s *settings) interface{} { return s.loggerProvider },
+		set: func(s *settings, value string) error { s.loggerProvider = value; return nil },
+	},
+	{
+		key: "logLevel",
+		get: func(s *settings) interface{} { return strings.ToLower(s.logLevel.String()) },
+		set: func(s *settings, value string) (err error) {
+			s.logLevel, err = ParseLevel(value)
+			return err
+		},
+	},
+	{
+		key: "logMaxSize",
+		get: func(s *settings) interface{} { return s.logMaxSize },
+		set: func(s *settings, value string) error { return parseInt64(value, &s.logMaxSize) },
+	},
+	{
+		key: "logMaxAge",
+		get: func(s *settings) interface{} { return s.logMaxAge.String() },
+		set: func(s *settings, value string) error { return parseDuration(value, &s.logMaxAge) },
+	},
+	{
+		key: "logMaxBackups",
+		get: func(s *settings) interface{} { return s.logMaxBackups },
+		set: func(s *settings, value string) error { return parseInt(value, &s.logMaxBackups) },
+	},
+	{
+		key: "logPerEntry",
+		get: func(s *settings) interface{} { return s.logPerEntry },
+		set: func(s *settings, value string) (err error) {
+			s.logPerEntry, err = strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q, must be true or false", value)
+			}
+
+			return nil
+		},
+	},
+	{
+		key: "minChunkSize",
+		get: func(s *settings) interface{} { return s.minChunkSize },
+		set: func(s *settings, value string) error { return parseInt64(value, &s.minChunkSize) },
+	},
+	{
+		key: "partitionStrategy",
+		get: func(s *settings) interface{} { return s.PartitionStrategy().String() },
+		set: func(s *settings, value string) (err error) {
+			s.partition, err = ParsePartitionStrategy(value)
+			return err
+		},
+	},
+	{
+		key: "duplicatePolicy",
+		get: func(s *settings) interface{} { return s.duplicatePolicy.String() },
+		set: func(s *settings, value string) (err error) {
+			s.duplicatePolicy, err = ParseDuplicatePolicy(value)
+			return err
+		},
+	},
+	{
+		key: "rateLimit",
+		get: func(s *settings) interface{} { return s.rateLimit },
+		set: func(s *settings, value string) error { return parseInt64(value, &s.rateLimit) },
+	},
+	{
+		key: "maxActiveEntries",
+		get: func(s *settings) interface{} { return s.maxActiveEntries },
+		set: func(s *settings, value string) error { return parseInt(value, &s.maxActiveEntries) },
+	},
+	{
+		key: "httpClient",
+		get: func(s *settings) interface{} { return s.httpClient },
+		set: func(s *settings, value string) error { s.httpClient = value; return nil },
+	},
+	{
+		key: "maxConnections",
+		get: func(s *settings) interface{} { return s.totalConnections },
+		set: func(s *settings, value string) error { return parseInt(value, &s.totalConnections) },
+	},
+	{
+		key: "maxConnectionsPerHost",
+		get: func(s *settings) interface{} { return s.maxConnections },
+		set: func(s *settings, value string) error { return parseInt(value, &s.maxConnections) },
+	},
+	{
+		key: "connectionDelay",
+		get: func(s *settings) interface{} { return s.connectionDelay.String() },
+		set: func(s *settings, value string) error { return parseDuration(value, &s.connectionDelay) },
+	},
+	{
+		key: "minFreeSpace",
+		get: func(s *settings) interface{} { return s.minFreeSpace },
+		set: func(s *settings, value string) error { return parseInt64(value, &s.minFreeSpace) },
+	},
+}
+
+var settingTables = []settingTable{
+	{
+		key: "categoryLocation",
+		get: func(b *SettingBuilder) map[string]interface{} {
+			table := make(map[string]interface{}, len(b.setting.categoryLocations))
+			for filetype, location := range b.setting.categoryLocations {
+				table[filetype] = location
+			}
+
+			return table
+		},
+		set: func(b *SettingBuilder, filetype string, location string) error {
+			b.CategoryLocation(filetype, location)
+			return nil
+		},
+	},
+	{
+		key: "hostConnections",
+		get: func(b *SettingBuilder) map[string]interface{} {
+			table := make(map[string]interface{}, len(b.setting.hostConnections))
+			for host, max := range b.setting.hostConnections {
+				table[host] = max
+			}
+
+			return table
+		},
+		set: func(b *SettingBuilder, host string, value string) error {
+			var max int
+			if err := parseInt(value, &max); err != nil {
+				return err
+			}
+
+			b.HostConnections(host, max)
+			return nil
+		},
+	},
+	{
+		key: "hostDelay",
+		get: func(b *SettingBuilder) map[string]interface{} {
+			table := make(map[string]interface{}, len(b.setting.hostDelays))
+			for host, delay := range b.setting.hostDelays {
+				table[host] = delay.String()
+			}
+
+			return table
+		},
+		set: func(b *SettingBuilder, host string, value string) error {
+			var delay time.Duration
+			if err := parseDuration(value, &delay); err != nil {
+				return err
+			}
+
+			b.HostDelay(host, delay)
+			return nil
+		},
+	},
+}
+
+func (e *SettingError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("%s: %v", e.Key, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %s: %v", e.Source, e.Key, e.Err)
+}
+
+func (e *SettingError) Unwrap() error {
+	return e.Err
+}
+
+func parseInt(value string, dst *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", value)
+	}
+
+	*dst = n
+	return nil
+}
+
+func parseInt64(value string, dst *int64) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", value)
+	}
+
+	*dst = n
+	return nil
+}
+
+func parseDuration(value string, dst *time.Duration) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, e.g 500ms or 168h", value)
+	}
+
+	*dst = d
+	return nil
+}
+
+// envName returns the environment variable of the key, e.g downloadLocation into RAPID_DOWNLOAD_LOCATION
+func envName(key string) string {
+	var name strings.Builder
+	name.WriteString(envPrefix)
+	for i, r := range key {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			name.WriteByte('_')
+		}
+
+		name.WriteRune(r)
+	}
+
+	return strings.ToUpper(name.String())
+}
+
+func findField(key string) (settingField, bool) {
+	for _, field := range settingFields {
+		if field.key == key {
+			return field, true
+		}
+	}
+
+	return settingField{}, false
+}
+
+func findTable(key string) (settingTable, bool) {
+	for _, table := range settingTables {
+		if table.key == key {
+			return table, true
+		}
+	}
+
+	return settingTable{}, false
+}
+
+// NewSettingBuilder creates the builder which starts from the default setting
+func NewSettingBuilder() *SettingBuilder {
+	return &SettingBuilder{
+		setting: *DefaultSetting().(*settings),
+	}
+}
+
+// From starts the builder from the values of the setting
+func (b *SettingBuilder) From(setting Setting) *SettingBuilder {
+	b.setting = snapshot(setting)
+	return b
+}
+
+func (b *SettingBuilder) DownloadLocation(location string) *SettingBuilder {
+	b.setting.downloadLocation = location
+	return b
+}
+
+// CategoryLocation places the download with the file type into its own location instead of the download location, e.g
+// Video into ~/Videos, where the leading ~ is the home directory. The file type registered with RegisterFiletype can be
+// used as well
+func (b *SettingBuilder) CategoryLocation(filetype string, location string) *SettingBuilder {
+	if b.setting.categoryLocations == nil {
+		b.setting.categoryLocations = make(map[string]string)
+	}
+
+	b.setting.categoryLocations[filetype] = location
+	return b
+}
+
+func (b *SettingBuilder) DataLocation(location string) *SettingBuilder {
+	b.setting.dataLocation = location
+	return b
+}
+
+// TempLocation sets where the chunks of the incomplete downloads are stored, empty means the incomplete directory in
+// the data location
+func (b *SettingBuilder) TempLocation(location string) *SettingBuilder {
+	b.setting.tempLocation = location
+	return b
+}
+
+func (b *SettingBuilder) MaxRetry(retry int) *SettingBuilder {
+	b.setting.maxRetry = retry
+	return b
+}
+
+func (b *SettingBuilder) LoggerProvider(provider string) *SettingBuilder {
+	b.setting.loggerProvider = provider
+	return b
+}
+
+func (b *SettingBuilder) LogLevel(level Level) *SettingBuilder {
+	b.setting.logLevel = level
+	return b
+}
+
+func (b *SettingBuilder) LogMaxSize(size int64) *SettingBuilder {
+	b.setting.logMaxSize = size
+	return b
+}
+
+func (b *SettingBuilder) LogMaxAge(age time.Duration) *SettingBuilder {
+	b.setting.logMaxAge = age
+	return b
+}
+
+func (b *SettingBuilder) LogMaxBackups(backups int) *SettingBuilder {
+	b.setting.logMaxBackups = backups
+	return b
+}
+
+func (b *SettingBuilder) LogPerEntry(perEntry bool) *SettingBuilder {
+	b.setting.logPerEntry = perEntry
+	return b
+}
+
+func (b *SettingBuilder) MinChunkSize(size int64) *SettingBuilder {
+	b.setting.minChunkSize = size
+	return b
+}
+
+// PartitionStrategy sets how many chunks the entry is split into, see ParsePartitionStrategy for the built-in strategies
+func (b *SettingBuilder) PartitionStrategy(strategy PartitionStrategy) *SettingBuilder {
+	b.setting.partition = strategy
+	return b
+}
+
+func (b *SettingBuilder) DuplicatePolicy(policy DuplicatePolicy) *SettingBuilder {
+	b.setting.duplicatePolicy = policy
+	return b
+}
+
+func (b *SettingBuilder) RateLimit(rate int64) *SettingBuilder {
+	b.setting.rateLimit = rate
+	return b
+}
+
+func (b *SettingBuilder) MaxActiveEntries(max int) *SettingBuilder {
+	b.setting.maxActiveEntries = max
+	return b
+}
+
+func (b *SettingBuilder) HttpClient(client string) *SettingBuilder {
+	b.setting.httpClient = client
+	return b
+}
+
+// MaxConnections limits the connections of every entry together, which are scheduled fairly between the entries. Zero
+// means unlimited
+func (b *SettingBuilder) MaxConnections(max int) *SettingBuilder {
+	b.setting.totalConnections = max
+	return b
+}
+
+// MaxConnectionsPerHost limits the connections to the same host which are shared by every entry, zero means unlimited
+func (b *SettingBuilder) MaxConnectionsPerHost(max int) *SettingBuilder {
+	b.setting.maxConnections = max
+	return b
+}
+
+// ConnectionDelay sets the minimum delay between the new connections to the same host
+func (b *SettingBuilder) ConnectionDelay(delay time.Duration) *SettingBuilder {
+	b.setting.connectionDelay = delay
+	return b
+}
+
+// HostConnections overrides the max connections of the host, e.g the one which bans the client with many connections
+func (b *SettingBuilder) HostConnections(host string, max int) *SettingBuilder {
+	if b.setting.hostConnections == nil {
+		b.setting.hostConnections = make(map[string]int)
+	}
+
+	b.setting.hostConnections[host] = max
+	return b
+}
+
+// HostDelay overrides the connection delay of the host
+func (b *SettingBuilder) HostDelay(host string, delay time.Duration) *SettingBuilder {
+	if b.setting.hostDelays == nil {
+		b.setting.hostDelays = make(map[string]time.Duration)
+	}
+
+	b.setting.hostDelays[host] = delay
+	return b
+}
+
+// MinFreeSpace sets the free space in bytes of the disk to keep, zero means the disk is never checked
+func (b *SettingBuilder) MinFreeSpace(size int64) *SettingBuilder {
+	b.setting.minFreeSpace = size
+	return b
+}
+
+// File applies the values of the setting file, see LoadSetting for the format. The keys that are not in the file keep
+// their current value
+func (b *SettingBuilder) File(path string) *SettingBuilder {
+	values, tables, err := readSettingFile(path)
+	if err != nil {
+		b.errs = append(b.errs, err)
+		return b
+	}
+
+	return b.apply(path, values, tables)
+}
+
+// apply sets the values and the tables of the setting file
+func (b *SettingBuilder) apply(source string, values map[string]string, tables map[string]map[string]string) *SettingBuilder {
+	for key, value := range values {
+		b.set(source, key, value)
+	}
+
+	for key, entries := range tables {
+		table, ok := findTable(key)
+		if !ok {
+			b.errs = append(b.errs, &SettingError{Source: source, Key: key, Err: fmt.Errorf("unknown setting")})
+			continue
+		}
+
+		for name, value := range entries {
+			if err := table.set(b, name, strings.TrimSpace(value)); err != nil {
+				b.errs = append(b.errs, &SettingError{Source: source, Key: key + "." + name, Err: err})
+			}
+		}
+	}
+
+	return b
+}
+
+// Env applies the environment variables of the settings, e.g RAPID_DOWNLOAD_LOCATION or RAPID_MAX_RETRY
+func (b *SettingBuilder) Env() *SettingBuilder {
+	for _, field := range settingFields {
+		name := envName(field.key)
+		if value, ok := os.LookupEnv(name); ok {
+			b.set(name, field.key, value)
+		}
+	}
+
+	return b
+}
+
+func (b *SettingBuilder) set(source string, key string, value string) {
+	field, ok := findField(key)
+	if !ok {
+		b.errs = append(b.errs, &SettingError{Source: source, Key: key, Err: fmt.Errorf("unknown setting")})
+		return
+	}
+
+	if err := field.set(&b.setting, strings.TrimSpace(value)); err != nil {
+		b.errs = append(b.errs, &SettingError{Source: source, Key: key, Err: err})
+	}
+}
+
+// Build validates the setting and creates its data location. Every invalid value is reported as SettingError
+func (b *SettingBuilder) Build() (Setting, error) {
+	s := b.setting
+	s.categoryLocations = maps.Clone(s.categoryLocations)
+	s.hostConnections = maps.Clone(s.hostConnections)
+	s.hostDelays = maps.Clone(s.hostDelays)
+	s.downloadLocation = expandHome(s.downloadLocation)
+	s.dataLocation = expandHome(s.dataLocation)
+	s.tempLocation = expandHome(s.tempLocation)
+
+	for filetype, location := range s.categoryLocations {
+		s.categoryLocations[filetype] = expandHome(location)
+	}
+
+	errs := append([]error{}, b.errs...)
+	errs = append(errs, s.validate()...)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.dataLocation, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *settings) validate() []error {
+	errs := make([]error, 0)
+	invalid := func(key string, format string, args ...interface{}) {
+		errs = append(errs, &SettingError{Key: key, Err: fmt.Errorf(format, args...)})
+	}
+
+	if s.downloadLocation == "" {
+		invalid("downloadLocation", "must not be empty")
+	}
+
+	if s.dataLocation == "" {
+		invalid("dataLocation", "must not be empty")
+	}
+
+	if s.maxRetry < 0 {
+		invalid("maxRetry", "must not be negative, got %d", s.maxRetry)
+	}
+
+	if _, ok := loggermap[s.loggerProvider]; !ok {
+		invalid("loggerProvider", "unknown provider %q", s.loggerProvider)
+	}
+
+	if s.logLevel < LevelDebug || s.logLevel > LevelError {
+		invalid("logLevel", "unknown level %d", int(s.logLevel))
+	}
+
+	if s.logMaxSize < 0 {
+		invalid("logMaxSize", "must not be negative, got %d", s.logMaxSize)
+	}
+
+	if s.logMaxAge < 0 {
+		invalid("logMaxAge", "must not be negative, got %s", s.logMaxAge)
+	}
+
+	if s.logMaxBackups < 0 {
+		invalid("logMaxBackups", "must not be negative, got %d", s.logMaxBackups)
+	}
+
+	if s.minChunkSize <= 0 {
+		invalid("minChunkSize", "must be positive, got %d", s.minChunkSize)
+	}
+
+	if s.duplicatePolicy < DuplicateRename || s.duplicatePolicy > DuplicateFail {
+		invalid("duplicatePolicy", "unknown policy %d", int(s.duplicatePolicy))
+	}
+
+	if s.rateLimit < 0 {
+		invalid("rateLimit", "must not be negative, got %d", s.rateLimit)
+	}
+
+	if s.maxActiveEntries < 0 {
+		invalid("maxActiveEntries", "must not be negative, got %d", s.maxActiveEntries)
+	}
+
+	if s.totalConnections < 0 {
+		invalid("maxConnections", "must not be negative, got %d", s.totalConnections)
+	}
+
+	if s.maxConnections < 0 {
+		invalid("maxConnectionsPerHost", "must not be negative, got %d", s.maxConnections)
+	}
+
+	if s.connectionDelay < 0 {
+		invalid("connectionDelay", "must not be negative, got %s", s.connectionDelay)
+	}
+
+	if s.minFreeSpace < 0 {
+		invalid("minFreeSpace", "must not be negative, got %d", s.minFreeSpace)
+	}
+
+	for host, max := range s.hostConnections {
+		if max < 0 {
+			invalid("hostConnections."+host, "must not be negative, got %d", max)
+		}
+	}
+
+	for host, delay := range s.hostDelays {
+		if delay < 0 {
+			invalid("hostDelay."+host, "must not be negative, got %s", delay)
+		}
+	}
+
+	return errs
+}
+
+// expandHome replaces the leading ~ with the home directory of the user
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// snapshot copies the current values of the setting
+func snapshot(setting Setting) settings {
+	s := settings{
+		downloadLocation: setting.DownloadLocation(),
+		dataLocation:     setting.DataLocation(),
+		maxRetry:         setting.MaxRetry(),
+		loggerProvider:   setting.LoggerProvider(),
+		logLevel:         setting.LogLevel(),
+		logMaxSize:       setting.LogMaxSize(),
+		logMaxAge:        setting.LogMaxAge(),
+		logMaxBackups:    setting.LogMaxBackups(),
+		logPerEntry:      setting.LogPerEntry(),
+		minChunkSize:     setting.MinChunkSize(),
+		partition:        setting.PartitionStrategy(),
+		duplicatePolicy:  setting.DuplicatePolicy(),
+		rateLimit:        setting.RateLimit(),
+		maxActiveEntries: setting.MaxActiveEntries(),
+		httpClient:       setting.HttpClient(),
+		totalConnections: setting.MaxConnections(),
+		maxConnections:   setting.MaxConnectionsPerHost(""),
+		connectionDelay:  setting.ConnectionDelay(""),
+		minFreeSpace:     setting.MinFreeSpace(),
+	}
+
+	// the category locations and the overrides of the hosts can't be listed through the interface, so they are only copied
+	// from the known settings.
+	// So is the default temp location, which follows the data location
+	if base := unwrapSetting(setting); base != nil {
+		s.tempLocation = base.tempLocation
+		s.categoryLocations = maps.Clone(base.categoryLocations)
+		s.hostConnections = maps.Clone(base.hostConnections)
+		s.hostDelays = maps.Clone(base.hostDelays)
+	} else {
+		s.tempLocation = setting.TempLocation()
+	}
+
+	return s
+}
+
+// unwrapSetting returns the settings under the live setting, or nil if it is implemented elsewhere
+func unwrapSetting(setting Setting) *settings {
+	switch s := setting.(type) {
+	case *settings:
+		return s
+	case *LiveSetting:
+		return unwrapSetting(s.Current())
+	}
+
+	return nil
+}
+
+// categoryLocations returns the locations of the file types, which can't be listed through the interface either
+func categoryLocations(setting Setting) map[string]string {
+	if base := unwrapSetting(setting); base != nil {
+		return base.categoryLocations
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package rapid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// settingFiles are the names of the setting file in the data location, in the order they are looked up
+var settingFiles = []string{"setting.json", "setting.toml", "setting.yaml", "setting.yml"}
+
+var errSettingFormat = fmt.Errorf("unsupported setting file, must be .json, .toml, or .yaml")
+
+// SettingFile returns the setting file in the data location, or the path of setting.json if there is none
+func SettingFile(dataLocation string) string {
+	for _, name := range settingFiles {
+		path := filepath.Join(dataLocation, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return filepath.Join(dataLocation, settingFiles[0])
+}
+
+// LoadSetting loads the setting from the default values, then the setting file in the data location, then the environment
+// variables. The data location is ~/.rapid unless RAPID_DATA_LOCATION is set. The setting file can be JSON, TOML, or
+// YAML, where the keys are the names of the setting. The locations of the file types are under categoryLocation, and
+// the overrides of the hosts are under hostConnections and hostDelay:
+//
+//	downloadLocation = "~/Downloads"
+//	maxRetry = 5
+//	logMaxAge = "72h"
+//	duplicatePolicy = "overwrite"
+//	maxConnectionsPerHost = 4
+//
+//	[categoryLocation]
+//	Video = "~/Videos"
+//
+//	[hostConnections]
+//	"files.example.com" = 1
+//
+//	[hostDelay]
+//	"files.example.com" = "500ms"
+func LoadSetting() (Setting, error) {
+	builder := NewSettingBuilder()
+
+	dataLocation := builder.setting.dataLocation
+	if location, ok := os.LookupEnv(envName("dataLocation")); ok {
+		dataLocation = expandHome(location)
+	}
+
+	path := SettingFile(dataLocation)
+	if _, err := os.Stat(path); err == nil {
+		builder.File(path)
+	}
+
+	return builder.Env().Build()
+}
+
+// SaveSetting writes the current values of the setting into the file, whose format follows its extension. The setting is
+// written into setting.json in its data location if the path is empty
+func SaveSetting(setting Setting, path string) error {
+	if path == "" {
+		path = filepath.Join(setting.DataLocation(), settingFiles[0])
+	}
+
+	builder := NewSettingBuilder().From(setting)
+	values := settingValues(builder)
+
+	var data []byte
+	var err error
+	switch filepath.Ext(path) {
+	case ".json":
+		data = encodeSettingJSON(builder)
+	case ".toml":
+		var buf bytes.Buffer
+		err = toml.NewEncoder(&buf).Encode(values)
+		data = buf.Bytes()
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(values)
+	default:
+		return fmt.Errorf("%s: %w", path, errSettingFormat)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	// write into temporary file first, so a crash can't leave a broken setting
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// readSettingFile reads the values and the tables of the setting file as text
+func readSettingFile(path string) (map[string]string, map[string]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var values map[string]string
+	var tables map[string]map[string]string
+	switch filepath.Ext(path) {
+	case ".json":
+		values, tables, err = decodeSettingJSON(data)
+	case ".toml":
+		var raw map[string]interface{}
+		if _, err = toml.Decode(string(data), &raw); err == nil {
+			values, tables, err = settingText(raw)
+		}
+	case ".yaml", ".yml":
+		var raw map[string]interface{}
+		if err = yaml.Unmarshal(data, &raw); err == nil {
+			values, tables, err = settingText(raw)
+		}
+	default:
+		err = errSettingFormat
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, tables, nil
+}
+
+func decodeSettingJSON(data []byte) (map[string]string, map[string]map[string]string, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep the number as it is written, instead of the float
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, nil, err
+	}
+
+	return settingText(raw)
+}
+
+// settingText turns the decoded values of the setting file into text, which is parsed by the fields and the tables of
+// the builder the same way for every format
+func settingText(raw map[string]interface{}) (map[string]string, map[string]map[string]string, error) {
+	values := make(map[string]string, len(raw))
+	tables := make(map[string]map[string]string)
+	for key, value := range raw {
+		if _, ok := findTable(key); ok {
+			entries, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("%s must be a table", key)
+			}
+
+			tables[key] = make(map[string]string, len(entries))
+			for name, entry := range entries {
+				text, err := valueText(entry)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s.%s %w", key, name, err)
+				}
+
+				tables[key][name] = text
+			}
+
+			continue
+		}
+
+		text, err := valueText(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s %w", key, err)
+		}
+
+		values[key] = text
+	}
+
+	return values, tables, nil
+}
+
+// valueText keeps the string as it is and formats the number and the boolean, while the nested value is not supported
+func valueText(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case map[string]interface{}, []interface{}, []map[string]interface{}, nil:
+		return "", fmt.Errorf("must be a string, a number, or a boolean")
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// settingValues returns the values of the setting, along with the tables which are not empty, keyed by their names
+func settingValues(b *SettingBuilder) map[string]interface{} {
+	values := make(map[string]interface{}, len(settingFields)+len(settingTables))
+	for _, field := range settingFields {
+		values[field.key] = field.get(&b.setting)
+	}
+
+	for _, table := range settingTables {
+		if entries := table.get(b); len(entries) > 0 {
+			values[table.key] = entries
+		}
+	}
+
+	return values
+}
+
+func encodeSettingJSON(b *SettingBuilder) []byte {
+	data, _ := json.MarshalIndent(settingValues(b), "", "  ")
+	return append(data, '\n')
+}
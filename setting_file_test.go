@@ -0,0 +1,178 @@
+package rapid
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSettingBuilderValidate(t *testing.T) {
+	_, err := NewSettingBuilder().
+		DataLocation(t.TempDir()).
+		MaxRetry(-1).
+		MinChunkSize(0).
+		LoggerProvider("nowhere").
+		Build()
+
+	var settingErr *SettingError
+	if !errors.As(err, &settingErr) {
+		t.Fatalf("Expected setting error, got %v", err)
+	}
+
+	for _, key := range []string{"maxRetry", "minChunkSize", "loggerProvider"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected %s to be reported, got %v", key, err)
+		}
+	}
+}
+
+func TestSettingBuilderEnv(t *testing.T) {
+	t.Setenv("RAPID_DOWNLOAD_LOCATION", "/tmp/rapid")
+	t.Setenv("RAPID_MAX_RETRY", "7")
+	t.Setenv("RAPID_LOG_MAX_AGE", "72h")
+	t.Setenv("RAPID_DUPLICATE_POLICY", "overwrite")
+
+	setting, err := NewSettingBuilder().DataLocation(t.TempDir()).MaxRetry(1).Env().Build()
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	if setting.DownloadLocation() != "/tmp/rapid" || setting.MaxRetry() != 7 {
+		t.Errorf("Expected the environment variables to override the setting, got %s and %d", setting.DownloadLocation(), setting.MaxRetry())
+	}
+
+	if setting.LogMaxAge() != 72*time.Hour || setting.DuplicatePolicy() != DuplicateOverwrite {
+		t.Errorf("Expected 72h and overwrite, got %s and %s", setting.LogMaxAge(), setting.DuplicatePolicy())
+	}
+
+	t.Setenv("RAPID_MAX_RETRY", "many")
+	_, err = NewSettingBuilder().DataLocation(t.TempDir()).Env().Build()
+	if err == nil || !strings.Contains(err.Error(), "RAPID_MAX_RETRY: maxRetry") {
+		t.Errorf("Expected the invalid environment variable to be reported, got %v", err)
+	}
+}
+
+func TestLoadSettingFile(t *testing.T) {
+	testCases := map[string]string{
+		"setting.json": `{
+  "downloadLocation": "/tmp/downloads",
+  "maxRetry": 5,
+  "logPerEntry": true,
+  "categoryLocation": {"Video": "/tmp/videos"}
+}`,
+		"setting.toml": `# rapid setting
+downloadLocation = "/tmp/downloads" # comment
+maxRetry = 5
+logPerEntry = true
+
+[categoryLocation]
+"Video" = '/tmp/videos'
+`,
+		"setting.yaml": `downloadLocation: "/tmp/downloads"
+maxRetry: 5 # comment
+logPerEntry: true
+categoryLocation:
+  Video: /tmp/videos
+`,
+	}
+
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal("Error writing setting:", err.Error())
+			}
+
+			t.Setenv("RAPID_DATA_LOCATION", dir)
+			t.Setenv("RAPID_MAX_RETRY", "6")
+
+			setting, err := LoadSetting()
+			if err != nil {
+				t.Fatal("Error loading setting:", err.Error())
+			}
+
+			if setting.DownloadLocation() != "/tmp/downloads" || !setting.LogPerEntry() {
+				t.Errorf("Expected the setting file to be loaded, got %s", setting.DownloadLocation())
+			}
+
+			if setting.MaxRetry() != 6 {
+				t.Errorf("Expected the environment variable to override the file, got %d", setting.MaxRetry())
+			}
+
+			if setting.CategoryLocation("Video") != "/tmp/videos" || setting.CategoryLocation("Audio") != "/tmp/downloads" {
+				t.Errorf("Expected the category location to be loaded, got %s", setting.CategoryLocation("Video"))
+			}
+		})
+	}
+}
+
+func TestLoadSettingUnknownKey(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "setting.toml"), []byte("maxRetries = 5\n"), 0644); err != nil {
+		t.Fatal("Error writing setting:", err.Error())
+	}
+
+	t.Setenv("RAPID_DATA_LOCATION", dir)
+	if _, err := LoadSetting(); err == nil || !strings.Contains(err.Error(), "maxRetries: unknown setting") {
+		t.Errorf("Expected unknown setting error, got %v", err)
+	}
+}
+
+func TestSettingFileFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "setting.ini")
+	if err := os.WriteFile(path, []byte("maxRetry = 5\n"), 0644); err != nil {
+		t.Fatal("Error writing setting:", err.Error())
+	}
+
+	if _, err := NewSettingBuilder().File(path).Build(); !errors.Is(err, errSettingFormat) {
+		t.Errorf("Expected the INI file to be rejected, got %v", err)
+	}
+
+	if err := SaveSetting(testSetting(t), path); !errors.Is(err, errSettingFormat) {
+		t.Errorf("Expected the INI file to be rejected, got %v", err)
+	}
+}
+
+func TestSaveSetting(t *testing.T) {
+	dir := t.TempDir()
+	setting, err := NewSettingBuilder().
+		DataLocation(dir).
+		DownloadLocation(`/tmp/my "downloads"`).
+		CategoryLocation("Video", "/tmp/videos").
+		RateLimit(1024).
+		LogLevel(LevelDebug).
+		HostConnections("files.example.com", 1).
+		HostDelay("files.example.com", 500*time.Millisecond).
+		Build()
+
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	for _, name := range []string{"setting.json", "setting.toml", "setting.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := SaveSetting(setting, path); err != nil {
+				t.Fatal("Error saving setting:", err.Error())
+			}
+
+			loaded, err := NewSettingBuilder().File(path).Build()
+			if err != nil {
+				t.Fatal("Error loading setting:", err.Error())
+			}
+
+			if !reflect.DeepEqual(snapshot(loaded), snapshot(setting)) {
+				t.Errorf("Expected %+v, got %+v", snapshot(setting), snapshot(loaded))
+			}
+
+			if loaded.CategoryLocation("Video") != "/tmp/videos" {
+				t.Errorf("Expected the category location to be saved, got %s", loaded.CategoryLocation("Video"))
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package rapid
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// SettingNotifier is implemented by setting which can be changed at runtime. The function is called after every change,
+	// so the one who holds the setting can read the new values from it
+	SettingNotifier interface {
+		Subscribe(fn func()) (unsubscribe func())
+	}
+
+	// LiveSetting is the setting which can be changed while the downloads are running. The downloader, manager, and
+	// logger which are created with it follow the rate limit, max retry, max active entries, max connections, log level,
+	// and log rotation without restarting the downloads
+	LiveSetting struct {
+		mu         sync.RWMutex
+		current    Setting
+		update     sync.Mutex // serializes the updates, so the listeners see them in order
+		listeners  map[int]func()
+		listenerID int
+	}
+)
+
+// NewLiveSetting creates the setting which starts with the values of the setting
+func NewLiveSetting(setting Setting) *LiveSetting {
+	return &LiveSetting{
+		current:   setting,
+		listeners: make(map[int]func()),
+	}
+}
+
+// Current returns the setting which is currently used
+func (s *LiveSetting) Current() Setting {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current
+}
+
+// Update replaces the current setting and notifies the listeners. The locations, including the category locations, and
+// the logger provider are used by the files and the loggers which already exist, so changing them needs a restart
+func (s *LiveSetting) Update(setting Setting) error {
+	s.update.Lock()
+	defer s.update.Unlock()
+
+	current := s.Current()
+	static := []struct {
+		key             string
+		current, update string
+	}{
+		{"downloadLocation", current.DownloadLocation(), setting.DownloadLocation()},
+		{"dataLocation", current.DataLocation(), setting.DataLocation()},
+		{"tempLocation", current.TempLocation(), setting.TempLocation()},
+		{"loggerProvider", current.LoggerProvider(), setting.LoggerProvider()},
+	}
+
+	for _, field := range static {
+		if field.current != field.update {
+			return &SettingError{Key: field.key, Err: fmt.Errorf("can't be changed at runtime, restart to apply it")}
+		}
+	}
+
+	if !maps.Equal(categoryLocations(current), categoryLocations(setting)) {
+		return &SettingError{Key: "categoryLocation", Err: fmt.Errorf("can't be changed at runtime, restart to apply it")}
+	}
+
+	s.mu.Lock()
+	s.current = setting
+	listeners := make([]func(), 0, len(s.listeners))
+	for _, listener := range s.listeners {
+		listeners = append(listeners, listener)
+	}
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener()
+	}
+
+	return nil
+}
+
+// Subscribe registers the function which is called after the setting is updated. It returns the function to unregister it
+func (s *LiveSetting) Subscribe(fn func()) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.listenerID
+	s.listenerID++
+	s.listeners[id] = fn
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.listeners, id)
+	}
+}
+
+// MarshalJSON writes the current values in the format of the setting file
+func (s *LiveSetting) MarshalJSON() ([]byte, error) {
+	return encodeSettingJSON(NewSettingBuilder().From(s.Current())), nil
+}
+
+// UnmarshalJSON changes the values of the keys in the data, in the format of the setting file, and keeps the rest. The
+// setting is left unchanged if any of the values is invalid
+func (s *LiveSetting) UnmarshalJSON(data []byte) error {
+	values, tables, err := decodeSettingJSON(data)
+	if err != nil {
+		return err
+	}
+
+	setting, err := NewSettingBuilder().From(s.Current()).apply("", values, tables).Build()
+	if err != nil {
+		return err
+	}
+
+	return s.Update(setting)
+}
+
+// WatchFile reloads the setting file, along with the environment variables, whenever it is modified until the context is
+// done. The invalid setting file is logged and the current setting is kept
+func (s *LiveSetting) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	logger := NewLogger(s).With("setting", path)
+
+	modified := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+
+		return info.ModTime()
+	}
+
+	last := modified()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		mtime := modified()
+		if mtime.IsZero() || mtime.Equal(last) {
+			continue
+		}
+
+		last = mtime
+		setting, err := NewSettingBuilder().File(path).Env().Build()
+		if err == nil {
+			err = s.Update(setting)
+		}
+
+		if err != nil {
+			logger.Error("Error reloading setting", "error", err)
+			continue
+		}
+
+		logger.Info("Setting is reloaded")
+	}
+}
+
+func (s *LiveSetting) DownloadLocation() string {
+	return s.Current().DownloadLocation()
+}
+
+func (s *LiveSetting) CategoryLocation(filetype string) string {
+	return s.Current().CategoryLocation(filetype)
+}
+
+func (s *LiveSetting) DataLocation() string {
+	return s.Current().DataLocation()
+}
+
+func (s *LiveSetting) TempLocation() string {
+	return s.Current().TempLocation()
+}
+
+func (s *LiveSetting) MaxRetry() int {
+	return s.Current().MaxRetry()
+}
+
+func (s *LiveSetting) LoggerProvider() string {
+	return s.Current().LoggerProvider()
+}
+
+func (s *LiveSetting) LogLevel() Level {
+	return s.Current().LogLevel()
+}
+
+func (s *LiveSetting) LogMaxSize() int64 {
+	return s.Current().LogMaxSize()
+}
+
+func (s *LiveSetting) LogMaxAge() time.Duration {
+	return s.Current().LogMaxAge()
+}
+
+func (s *LiveSetting) LogMaxBackups() int {
+	return s.Current().LogMaxBackups()
+}
+
+func (s *LiveSetting) LogPerEntry() bool {
+	return s.Current().LogPerEntry()
+}
+
+func (s *LiveSetting) MinChunkSize() int64 {
+	return s.Current().MinChunkSize()
+}
+
+func (s *LiveSetting) PartitionStrategy() PartitionStrategy {
+	return s.Current().PartitionStrategy()
+}
+
+func (s *LiveSetting) DuplicatePolicy() DuplicatePolicy {
+	return s.Current().DuplicatePolicy()
+}
+
+func (s *LiveSetting) RateLimit() int64 {
+	return s.Current().RateLimit()
+}
+
+func (s *LiveSetting) MaxActiveEntries() int {
+	return s.Current().MaxActiveEntries()
+}
+
+func (s *LiveSetting) HttpClient() string {
+	return s.Current().HttpClient()
+}
+
+func (s *LiveSetting) MaxConnections() int {
+	return s.Current().MaxConnections()
+}
+
+func (s *LiveSetting) MaxConnectionsPerHost(host string) int {
+	return s.Current().MaxConnectionsPerHost(host)
+}
+
+func (s *LiveSetting) ConnectionDelay(host string) time.Duration {
+	return s.Current().ConnectionDelay(host)
+}
+
+func (s *LiveSetting) MinFreeSpace() int64 {
+	return s.Current().MinFreeSpace()
+}
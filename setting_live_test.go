@@ -0,0 +1,179 @@
+package rapid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLiveSettingUpdate(t *testing.T) {
+	base := testSetting(t).(*settings)
+	base.maxActiveEntries = 1
+	live := NewLiveSetting(base)
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(live)).(*localDownloader)
+	manager := NewManager(downloader, NewQueue(QueueDefault, live), live)
+	defer manager.Close()
+
+	logger := NewLevelLogger(&stdLogger{}, LevelInfo)
+	live.Subscribe(func() { logger.(LevelSetter).SetLevel(live.LogLevel()) })
+
+	changed := *base
+	changed.maxRetry = 9
+	changed.rateLimit = 2048
+	changed.maxActiveEntries = 4
+	changed.logLevel = LevelError
+	if err := live.Update(&changed); err != nil {
+		t.Fatal("Error updating setting:", err.Error())
+	}
+
+	if live.MaxRetry() != 9 {
+		t.Errorf("Expected max retry to be 9, got %d", live.MaxRetry())
+	}
+
+	downloader.limiter.mu.Lock()
+	rate := downloader.limiter.rate
+	downloader.limiter.mu.Unlock()
+	if rate != 2048 {
+		t.Errorf("Expected the rate limit of the downloader to be 2048, got %d", rate)
+	}
+
+	manager.mu.Lock()
+	maxActive := manager.maxActive
+	manager.mu.Unlock()
+	if maxActive != 4 {
+		t.Errorf("Expected the max active entries of the manager to be 4, got %d", maxActive)
+	}
+
+	if level := logger.(*levelLogger).With("key", "value").(*levelLogger).level.Load(); Level(level) != LevelError {
+		t.Errorf("Expected the level of the logger to be %s, got %s", LevelError, Level(level))
+	}
+
+	moved := changed
+	moved.downloadLocation = t.TempDir()
+
+	var settingErr *SettingError
+	if err := live.Update(&moved); !errors.As(err, &settingErr) || settingErr.Key != "downloadLocation" {
+		t.Errorf("Expected the download location to be rejected, got %v", err)
+	}
+}
+
+func TestLiveSettingClose(t *testing.T) {
+	base := testSetting(t).(*settings)
+	live := NewLiveSetting(base)
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(live)).(*localDownloader)
+	manager := NewManager(downloader, NewQueue(QueueDefault, live), live)
+	manager.Close()
+
+	live.mu.Lock()
+	listeners := len(live.listeners)
+	live.mu.Unlock()
+	if listeners != 0 {
+		t.Errorf("Expected the closed manager and downloader to stop following the setting, got %d listeners", listeners)
+	}
+
+	changed := *base
+	changed.rateLimit = 4096
+	if err := live.Update(&changed); err != nil {
+		t.Fatal("Error updating setting:", err.Error())
+	}
+
+	downloader.limiter.mu.Lock()
+	rate := downloader.limiter.rate
+	downloader.limiter.mu.Unlock()
+	if rate == 4096 {
+		t.Error("Expected the closed downloader to keep its rate limit")
+	}
+}
+
+func TestLiveSettingCategoryLocation(t *testing.T) {
+	videos := t.TempDir()
+	setting, err := NewSettingBuilder().DataLocation(t.TempDir()).CategoryLocation("Video", videos).Build()
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	// the category locations are kept by the live setting itself, so nothing hides it from those who follow it
+	live := NewLiveSetting(setting)
+	notified := 0
+	live.Subscribe(func() { notified++ })
+
+	changed, err := NewSettingBuilder().From(live).MaxRetry(9).Build()
+	if err != nil {
+		t.Fatal("Error building setting:", err.Error())
+	}
+
+	if err := live.Update(changed); err != nil {
+		t.Fatal("Error updating setting:", err.Error())
+	}
+
+	if notified != 1 || live.CategoryLocation("Video") != videos || live.MaxRetry() != 9 {
+		t.Errorf("Expected the change to be notified with the category location kept, got %d %s", notified, live.CategoryLocation("Video"))
+	}
+
+	moved, _ := NewSettingBuilder().From(live).CategoryLocation("Video", t.TempDir()).Build()
+	if err := live.Update(moved); err == nil || live.CategoryLocation("Video") != videos {
+		t.Errorf("Expected the category location to be static, got %v", err)
+	}
+}
+
+func TestLiveSettingUnmarshalJSON(t *testing.T) {
+	live := NewLiveSetting(testSetting(t))
+
+	if err := live.UnmarshalJSON([]byte(`{"maxRetry": 5, "rateLimit": 1024}`)); err != nil {
+		t.Fatal("Error changing setting:", err.Error())
+	}
+
+	if live.MaxRetry() != 5 || live.RateLimit() != 1024 || live.MinChunkSize() != 1024 {
+		t.Errorf("Expected only the given keys to be changed, got %+v", snapshot(live))
+	}
+
+	if err := live.UnmarshalJSON([]byte(`{"maxRetry": 1, "minChunkSize": -1}`)); err == nil {
+		t.Error("Expected the invalid setting to be rejected")
+	}
+
+	if live.MaxRetry() != 5 {
+		t.Errorf("Expected the setting to be unchanged, got max retry %d", live.MaxRetry())
+	}
+}
+
+func TestLiveSettingWatchFile(t *testing.T) {
+	base := testSetting(t).(*settings)
+	base.logLevel = LevelInfo
+	base.maxActiveEntries = 3
+	live := NewLiveSetting(base)
+
+	path := filepath.Join(base.dataLocation, "setting.json")
+	content := `{"downloadLocation": "` + base.downloadLocation + `", "dataLocation": "` + base.dataLocation + `", "maxRetry": %d}`
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(content, 3)), 0644); err != nil {
+		t.Fatal("Error writing setting:", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go live.WatchFile(ctx, path, 10*time.Millisecond)
+
+	changed := make(chan struct{}, 1)
+	live.Subscribe(func() { changed <- struct{}{} })
+
+	// the file which exists before it is watched is not reloaded, only the changes afterward
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(content, 8)), 0644); err != nil {
+		t.Fatal("Error writing setting:", err.Error())
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting the setting to be reloaded")
+	}
+
+	if live.MaxRetry() != 8 {
+		t.Errorf("Expected the setting file to be reloaded, got max retry %d", live.MaxRetry())
+	}
+}
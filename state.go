@@ -0,0 +1,93 @@
+package rapid
+
+import "fmt"
+
+type (
+	// State is where the entry is in its lifecycle, which is changed by the downloader
+	State string
+
+	// EntryStater is implemented by entry which keeps its state, so the state can be observed while it is downloaded
+	EntryStater interface {
+		State() State
+
+		// Transition changes the state and returns the previous one, or ErrInvalidTransition if the entry can't be
+		// changed into the state from its current one. Changing into the current state does nothing
+		Transition(state State) (State, error)
+	}
+
+	// StateHook is called whenever the state of an entry is changed
+	StateHook func(entry Entry, from State, to State)
+
+	// StateWatcher is implemented by downloader which reports the state changes of the entries it downloads
+	StateWatcher interface {
+		WatchState(hook StateHook)
+	}
+)
+
+const (
+	StatePending     State = "pending"
+	StateProbing     State = "probing"
+	StateDownloading State = "downloading"
+	StatePaused      State = "paused"
+	StateMerging     State = "merging"
+	StateVerifying   State = "verifying"
+	StateCompleted   State = "completed"
+	StateFailed      State = "failed"
+	StateCancelled   State = "cancelled"
+)
+
+var (
+	// ErrPaused is returned by the download which is paused, the downloaded data is kept so it can be resumed
+	ErrPaused = fmt.Errorf("download is paused")
+
+	// ErrCancelled is returned by the download which is cancelled, the downloaded data is removed
+	ErrCancelled = fmt.Errorf("download is cancelled")
+
+	ErrInvalidTransition = fmt.Errorf("invalid state transition")
+)
+
+// transitions lists the states which the entry can be changed into from every state. The stopped entry can be started
+// again from probing, e.g when it is resumed or restarted
+var transitions = map[State][]State{
+	StatePending:     {StateProbing, StatePaused, StateCancelled},
+	StateProbing:     {StateDownloading, StateCompleted, StatePaused, StateFailed, StateCancelled},
+	StateDownloading: {StateMerging, StatePaused, StateFailed, StateCancelled},
+	StateMerging:     {StateVerifying, StatePaused, StateFailed, StateCancelled},
+	StateVerifying:   {StateCompleted, StatePaused, StateFailed, StateCancelled},
+	StatePaused:      {StateProbing, StateCancelled},
+	StateFailed:      {StateProbing, StateCancelled},
+	StateCancelled:   {StateProbing},
+	StateCompleted:   {StateProbing},
+}
+
+// canTransition checks whether the entry can be changed from the state into another
+func canTransition(from State, to State) bool {
+	for _, state := range transitions[from] {
+		if state == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// active checks whether the entry in the state is being downloaded
+func (s State) active() bool {
+	return s == StateProbing || s == StateDownloading || s == StateMerging || s == StateVerifying
+}
+
+// OnStateChange registers a hook that will be called whenever the state of an entry is changed by the downloader
+func OnStateChange(hook StateHook) DownloaderOptions {
+	return func(o *downloaderOption) {
+		o.hooks.onStateChange = append(o.hooks.onStateChange, hook)
+	}
+}
+
+// entryState returns the state of the entry, or the empty state if the entry doesn't keep it
+func entryState(entry Entry) State {
+	if stater, ok := entry.(EntryStater); ok {
+		return stater.State()
+	}
+
+	return ""
+}
@@ -0,0 +1,203 @@
+package rapid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEntryTransition(t *testing.T) {
+	e := &entry{}
+	if e.State() != StatePending {
+		t.Fatalf("Expected new entry to be pending, got %s", e.State())
+	}
+
+	for _, state := range []State{StateProbing, StateDownloading, StatePaused, StateProbing, StateDownloading, StateMerging, StateVerifying, StateCompleted} {
+		if _, err := e.Transition(state); err != nil {
+			t.Fatalf("Expected %s to be valid, got %v", state, err)
+		}
+	}
+
+	if _, err := e.Transition(StatePaused); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected the completed entry to not be paused, got %v", err)
+	}
+
+	if e.State() != StateCompleted {
+		t.Errorf("Expected the invalid transition to keep the state, got %s", e.State())
+	}
+
+	// the entry which is saved while it is downloaded is loaded as paused
+	e = &entry{id: "abc", state: StateDownloading}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal("Error encoding entry:", err.Error())
+	}
+
+	loaded := &entry{}
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal("Error decoding entry:", err.Error())
+	}
+
+	if loaded.State() != StatePaused {
+		t.Errorf("Expected the interrupted entry to be paused, got %s", loaded.State())
+	}
+}
+
+// stateRecorder records the states of the entry reported by the downloader
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []State
+}
+
+func (r *stateRecorder) record(entry Entry, from State, to State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states = append(r.states, to)
+}
+
+func (r *stateRecorder) list() []State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]State(nil), r.states...)
+}
+
+func TestDownloadStates(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	recorder := &stateRecorder{}
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting), OnStateChange(recorder.record))
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	expected := []State{StateProbing, StateDownloading, StateMerging, StateVerifying, StateCompleted}
+	if states := recorder.list(); !reflect.DeepEqual(states, expected) {
+		t.Errorf("Expected %v, got %v", expected, states)
+	}
+}
+
+// slowEntry returns the entry which takes a few seconds to download with the setting
+func slowEntry(t *testing.T) (Entry, Setting) {
+	setting := testSetting(t).(*settings)
+	setting.rateLimit = 4096
+	server := testServer(t, bytes.Repeat([]byte("0123456789"), 4096))
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	return entry, setting
+}
+
+// slowDownload starts downloading the slow entry, and returns the result of the download once some bytes are downloaded
+func slowDownload(t *testing.T) (Entry, Downloader, Setting, chan error) {
+	entry, setting := slowEntry(t)
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	result := make(chan error, 1)
+	go func() { result <- downloader.Download(entry) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for entryState(entry) != StateDownloading && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	return entry, downloader, setting, result
+}
+
+func TestPauseDownload(t *testing.T) {
+	entry, downloader, setting, result := slowDownload(t)
+
+	if err := downloader.Stop(entry); err != nil {
+		t.Fatal("Error pausing download:", err.Error())
+	}
+
+	if err := <-result; !errors.Is(err, ErrPaused) {
+		t.Fatalf("Expected %v, got %v", ErrPaused, err)
+	}
+
+	if state := entryState(entry); state != StatePaused {
+		t.Errorf("Expected the entry to be paused, got %s", state)
+	}
+
+	stat, err := os.Stat(chunkPath(setting, entry.ID(), 0))
+	if err != nil || stat.Size() == 0 {
+		t.Errorf("Expected the downloaded chunk to be kept, got %v", err)
+	}
+}
+
+func TestCancelDownload(t *testing.T) {
+	entry, downloader, setting, result := slowDownload(t)
+
+	if err := downloader.(Canceller).Cancel(entry); err != nil {
+		t.Fatal("Error cancelling download:", err.Error())
+	}
+
+	if err := <-result; !errors.Is(err, ErrCancelled) {
+		t.Fatalf("Expected %v, got %v", ErrCancelled, err)
+	}
+
+	if state := entryState(entry); state != StateCancelled {
+		t.Errorf("Expected the entry to be cancelled, got %s", state)
+	}
+
+	if _, err := os.Stat(chunkDir(setting, entry.ID())); !os.IsNotExist(err) {
+		t.Errorf("Expected the downloaded chunks to be removed, got %v", err)
+	}
+}
+
+func TestManagerRemoveCancels(t *testing.T) {
+	entry, setting := slowEntry(t)
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+
+	manager := NewManager(downloader, NewQueue(QueueDefault, setting), setting)
+	defer manager.Close()
+
+	events := make(chan Event, 64)
+	manager.Subscribe(func(event Event) { events <- event })
+
+	if err := manager.Add(entry); err != nil {
+		t.Fatal("Error adding entry:", err.Error())
+	}
+
+	waitState(t, events, entry.ID(), StateDownloading)
+	if err := manager.Remove(entry.ID()); err != nil {
+		t.Fatal("Error removing entry:", err.Error())
+	}
+
+	waitStatus(t, events, entry.ID(), StatusRemoved)
+	if _, err := os.Stat(chunkDir(setting, entry.ID())); !os.IsNotExist(err) {
+		t.Errorf("Expected the downloaded chunks to be removed, got %v", err)
+	}
+}
+
+func waitState(t *testing.T, events chan Event, id string, state State) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.ID == id && event.State == state {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Expected entry %s to be %s", id, state)
+		}
+	}
+}
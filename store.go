@@ -0,0 +1,36 @@
+package rapid
+
+import (
+	"fmt"
+	"log"
+)
+
+type (
+	// Store persists the entries, so they can be resumed or restarted later
+	Store interface {
+		Save(entry Entry) error
+		Get(id string) (Entry, error)
+		List() ([]Entry, error)
+		Delete(id string) error
+	}
+
+	StoreFunc func(Setting) Store
+)
+
+var ErrEntryNotFound = fmt.Errorf("entry is not found")
+
+var storeMap = make(map[string]StoreFunc)
+
+func NewStore(provider string, setting Setting) Store {
+	store, ok := storeMap[provider]
+	if !ok {
+		log.Panicf("Provider %s is not implemented", provider)
+		return nil
+	}
+
+	return store(setting)
+}
+
+func RegisterStore(name string, store StoreFunc) {
+	storeMap[name] = store
+}
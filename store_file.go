@@ -0,0 +1,118 @@
+package rapid
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// fileStore saves every entry as a json file in DataLocation/entries
+type fileStore struct {
+	mu      sync.Mutex
+	dir     string
+	setting Setting
+}
+
+const StoreFile = "file"
+
+func newFileStore(setting Setting) Store {
+	return &fileStore{
+		dir:     filepath.Join(setting.DataLocation(), "entries"),
+		setting: setting,
+	}
+}
+
+func (s *fileStore) path(id string) string {
+	return filepath.Join(s.dir, sanitizeFilename(id)+".json")
+}
+
+func (s *fileStore) Save(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// write into temporary file first, so a crash can't leave a broken entry. Only the user can read it, since it holds
+	// the headers and the cookies of the entry
+	tmp := s.path(entry.ID()) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path(entry.ID()))
+}
+
+func (s *fileStore) Get(id string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(s.path(id))
+}
+
+func (s *fileStore) load(path string) (Entry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrEntryNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+
+	e.logger = NewLogger(s.setting).With("entry", e.id)
+	return e, nil
+}
+
+func (s *fileStore) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	entries := make([]Entry, 0, len(files))
+	for _, file := range files {
+		entry, err := s.load(file)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (s *fileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrEntryNotFound
+	}
+
+	return err
+}
+
+func init() {
+	RegisterStore(StoreFile, newFileStore)
+}
@@ -0,0 +1,98 @@
+package rapid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestFileStoreSaveGet(t *testing.T) {
+	setting := testSetting(t)
+	server := testServer(t, bytes.Repeat([]byte("rapid"), 1024))
+
+	headers := http.Header{"Referer": {"https://example.com"}}
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), AddHeaders(headers))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	store := NewStore(StoreFile, setting)
+	if err := store.Save(entry); err != nil {
+		t.Fatal("Error saving entry:", err.Error())
+	}
+
+	saved, err := store.Get(entry.ID())
+	if err != nil {
+		t.Fatal("Error getting entry:", err.Error())
+	}
+
+	if saved.ID() != entry.ID() || saved.Location() != entry.Location() || saved.Size() != entry.Size() {
+		t.Errorf("Expected %v, got %v", entry, saved)
+	}
+
+	if got := saved.(EntryHeaders).Headers().Get("Referer"); got != "https://example.com" {
+		t.Errorf("Expected the header to be saved, got %q", got)
+	}
+
+	if saved.Context().Err() != nil {
+		t.Error("Expected the saved entry to be able to be downloaded")
+	}
+
+	entries, err := store.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d: %v", len(entries), err)
+	}
+
+	if err := store.Delete(entry.ID()); err != nil {
+		t.Fatal("Error deleting entry:", err.Error())
+	}
+
+	if _, err := store.Get(entry.ID()); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Expected %v, got %v", ErrEntryNotFound, err)
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	setting := testSetting(t)
+	content := bytes.Repeat([]byte("rapid"), 1024)
+	server := testServer(t, content)
+
+	sum := sha256.Sum256(content)
+	entry, err := Fetch(server.URL+"/file.bin",
+		SetEntrySetting(setting),
+		AddHeaders(http.Header{"Referer": {"https://example.com"}}),
+		AddCookies([]*http.Cookie{{Name: "session", Value: "abc"}}),
+		SetChecksum("sha-256", sum[:]),
+		SetDuplicatePolicy(DuplicateOverwrite),
+		SetEntryPriority(PriorityHigh),
+	)
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	store := NewStore(StoreFile, setting)
+	if err := store.Save(entry); err != nil {
+		t.Fatal("Error saving entry:", err.Error())
+	}
+
+	// the entry holds the headers and the cookies, so only the user can read it
+	if info, err := os.Stat(store.(*fileStore).path(entry.ID())); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the entry to be written with 0600, got %v %v", info, err)
+	}
+
+	// the entry which is loaded by another store, like the next run of the cli, is the same as the saved one
+	loaded, err := NewStore(StoreFile, setting).Get(entry.ID())
+	if err != nil {
+		t.Fatal("Error getting entry:", err.Error())
+	}
+
+	expected, _ := json.Marshal(entry)
+	got, _ := json.Marshal(loaded)
+	if !bytes.Equal(expected, got) {
+		t.Errorf("Expected the entry to be loaded as it is saved\nexpected %s\ngot      %s", expected, got)
+	}
+}
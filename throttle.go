@@ -0,0 +1,187 @@
+package rapid
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// throttleError is the response of the host which refuses more connections, e.g 503 or 429, or the connection which is
+// reset by the host
+type (
+	throttleError struct {
+		status     int // zero if the connection is reset
+		retryAfter time.Duration
+		hasRetry   bool // the host tells when to retry with Retry-After
+		err        error
+	}
+
+	// chunkRanges tracks the chunks of the entry which are downloading with their own connection. The range of the chunk
+	// which is throttled is merged into one of them, which continues it once its own range is done, so the entry keeps
+	// fewer connections instead of every chunk waiting for the host
+	chunkRanges struct {
+		mu     sync.Mutex
+		active int
+		merged []*chunk
+	}
+)
+
+// ErrThrottled is the error of the chunk that is refused by the host because of too many connections
+var ErrThrottled = fmt.Errorf("throttled by the host")
+
+// errMerged is returned by the chunk which range is merged into another chunk, so it has nothing left to do
+var errMerged = fmt.Errorf("range is merged into another chunk")
+
+const (
+	// maxThrottled is how many times the chunk can be throttled before it is failed. It is counted separately from the
+	// max retry, as the throttled chunk is expected to succeed after the connections are lowered
+	maxThrottled = 10
+
+	// throttleBackoff is the first wait of the throttled chunk, which is doubled every time up to maxThrottleBackoff
+	throttleBackoff    = 500 * time.Millisecond
+	maxThrottleBackoff = 30 * time.Second
+)
+
+func (e *throttleError) Error() string {
+	if e.status == 0 {
+		return fmt.Sprintf("%v: %v", ErrThrottled, e.err)
+	}
+
+	return fmt.Sprintf("%v: %s", ErrThrottled, http.StatusText(e.status))
+}
+
+func (e *throttleError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+func (e *throttleError) Unwrap() error {
+	return e.err
+}
+
+// responseThrottle returns the throttle error if the response refuses the connection, or nil otherwise
+func responseThrottle(res *http.Response) error {
+	if res.StatusCode != http.StatusServiceUnavailable && res.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	throttle := &throttleError{status: res.StatusCode}
+	throttle.retryAfter, throttle.hasRetry = parseRetryAfter(res.Header.Get("Retry-After"))
+	return throttle
+}
+
+// connectionThrottle returns the throttle error if the connection is reset by the host, or the error as it is
+func connectionThrottle(err error) error {
+	if errors.Is(err, syscall.ECONNRESET) {
+		return &throttleError{err: err}
+	}
+
+	return err
+}
+
+// parseRetryAfter parses Retry-After, which is either the seconds or the date to retry
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// throttleDelay returns how long the chunk waits before it is retried after it is throttled for the nth time. The delay
+// is doubled every time, but is never shorter than what the host tells with Retry-After
+func throttleDelay(err error, n int) time.Duration {
+	delay := throttleBackoff << (n - 1)
+	if delay <= 0 || delay > maxThrottleBackoff {
+		delay = maxThrottleBackoff
+	}
+
+	var throttle *throttleError
+	if errors.As(err, &throttle) && throttle.hasRetry {
+		return min(max(delay, throttle.retryAfter), maxThrottleBackoff)
+	}
+
+	return delay
+}
+
+// start counts the chunk which opens its own connection
+func (r *chunkRanges) start() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active++
+}
+
+// stop stops counting the chunk which is failed. The ranges merged into it are left to the other active chunks
+func (r *chunkRanges) stop() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active--
+}
+
+// handover merges the range of the throttled chunk into the other active chunks. It returns false if there is no other
+// chunk to continue it, so the chunk has to wait for the host by itself
+func (r *chunkRanges) handover(c *chunk) bool {
+	if r == nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active <= 1 {
+		return false
+	}
+
+	r.active--
+	r.merged = append(r.merged, c)
+	return true
+}
+
+// next returns the merged range which the chunk continues once its own range is done, or stops counting the chunk if
+// there is none left
+func (r *chunkRanges) next() *chunk {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.merged) == 0 {
+		r.active--
+		return nil
+	}
+
+	c := r.merged[0]
+	r.merged = r.merged[1:]
+	return c
+}
+
+// counts returns the chunks with their own connection, and the ranges merged into them which are not continued yet
+func (r *chunkRanges) counts() (active int, merged int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.active, len(r.merged)
+}
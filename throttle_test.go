@@ -0,0 +1,177 @@
+package rapid
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	if delay, ok := parseRetryAfter("3"); !ok || delay != 3*time.Second {
+		t.Errorf("Expected 3s, got %s", delay)
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if delay, ok := parseRetryAfter(date); !ok || delay <= 58*time.Second || delay > time.Minute {
+		t.Errorf("Expected about a minute, got %s", delay)
+	}
+
+	for _, value := range []string{"", "soon", "-1"} {
+		if _, ok := parseRetryAfter(value); ok {
+			t.Errorf("Expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestHostLimiterThrottle(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.maxConnections = 8
+
+	limiter := newHostLimiter()
+
+	var releases []func()
+	for i := 0; i < 8; i++ {
+		release, err := limiter.acquire(context.Background(), "example.com", setting)
+		if err != nil {
+			t.Fatal("Error acquiring connection:", err.Error())
+		}
+		releases = append(releases, release)
+	}
+
+	if limit := limiter.throttle("example.com"); limit != 4 {
+		t.Errorf("Expected the connections to be halved to 4, got %d", limit)
+	}
+
+	// the connections which are throttled at once only lower the limit once
+	if limit := limiter.throttle("example.com"); limit != 4 {
+		t.Errorf("Expected the limit to stay at 4 during the cooldown, got %d", limit)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+
+	// the limit is remembered after every connection is closed
+	if limit := limiter.learnedLimit("example.com"); limit != 4 {
+		t.Errorf("Expected the learned limit to be remembered, got %d", limit)
+	}
+
+	limiter.learned["example.com"].changed = time.Now().Add(-raiseInterval)
+	for i := 0; i < 4; i++ {
+		limiter.succeed("example.com", setting)
+	}
+
+	if limit := limiter.learnedLimit("example.com"); limit != 5 {
+		t.Errorf("Expected the limit to be raised to 5, got %d", limit)
+	}
+
+	limiter.learned["example.com"].limit = 7
+	limiter.learned["example.com"].changed = time.Now().Add(-raiseInterval)
+	for i := 0; i < 7; i++ {
+		limiter.succeed("example.com", setting)
+	}
+
+	if limit := limiter.learnedLimit("example.com"); limit != 0 {
+		t.Errorf("Expected the host to be forgotten once it is back at the setting, got %d", limit)
+	}
+}
+
+func TestDownloadThrottled(t *testing.T) {
+	setting := testSetting(t).(*settings)
+	setting.maxConnections = 8
+	content := bytes.Repeat([]byte("0123456789"), 4096)
+
+	// the server refuses more than 2 parallel connections
+	var active, throttled atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			defer active.Add(-1)
+			if active.Add(1) > 2 {
+				throttled.Add(1)
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	// the limit learned by the previous run of the test is forgotten, so the host throttles again
+	host := hostOf(server.URL)
+	connections.mu.Lock()
+	delete(connections.learned, host)
+	connections.mu.Unlock()
+	merged := metrics.mergedRanges.snapshot()[host]
+
+	entry, err := Fetch(server.URL+"/file.bin", SetEntrySetting(setting), SetPartitionStrategy(CountPartition(8)))
+	if err != nil {
+		t.Fatal("Error fetching url:", err.Error())
+	}
+
+	downloader := NewDownloader(DownloaderDefault, SetDownloaderSetting(setting))
+	if err := downloader.Download(entry); err != nil {
+		t.Fatal("Error downloading file:", err.Error())
+	}
+
+	result, err := os.ReadFile(entry.Location())
+	if err != nil || !bytes.Equal(result, content) {
+		t.Errorf("Expected the file to be downloaded with fewer connections, got %d bytes, %v", len(result), err)
+	}
+
+	if throttled.Load() == 0 {
+		t.Fatal("Expected the server to throttle the connections")
+	}
+
+	if limit := connections.learnedLimit(host); limit < 1 || limit > 4 {
+		t.Errorf("Expected the limit of the host to be learned, got %d", limit)
+	}
+
+	if n := metrics.mergedRanges.snapshot()[host]; n <= merged {
+		t.Errorf("Expected the ranges of the throttled chunks to be merged, got %d", n-merged)
+	}
+}
+
+func TestChunkRangesHandover(t *testing.T) {
+	ranges := &chunkRanges{}
+	chunks := []*chunk{{index: 0}, {index: 1}, {index: 2}}
+	for range chunks {
+		ranges.start()
+	}
+
+	// the throttled chunks merge into the one which still has its connection, so the ranges shrink to one
+	if !ranges.handover(chunks[1]) || !ranges.handover(chunks[2]) {
+		t.Fatal("Expected the throttled chunks to be merged")
+	}
+
+	if active, merged := ranges.counts(); active != 1 || merged != 2 {
+		t.Errorf("Expected 1 active range with 2 merged, got %d and %d", active, merged)
+	}
+
+	// the last chunk with its connection has to wait for the host by itself
+	if ranges.handover(chunks[0]) {
+		t.Error("Expected the last chunk not to be merged")
+	}
+
+	for _, expected := range chunks[1:] {
+		if next := ranges.next(); next != expected {
+			t.Errorf("Expected chunk %d to be continued, got %v", expected.index, next)
+		}
+	}
+
+	if next := ranges.next(); next != nil {
+		t.Errorf("Expected no merged range left, got %d", next.index)
+	}
+
+	if active, merged := ranges.counts(); active != 0 || merged != 0 {
+		t.Errorf("Expected every range to be done, got %d and %d", active, merged)
+	}
+}
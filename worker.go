@@ -2,8 +2,11 @@ package rapid
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
 type (
@@ -12,10 +15,36 @@ type (
 		OnError(ctx context.Context, err error)
 	}
 
+	// JobError is implemented by the job which handles its own failure, e.g by retrying it, so its result has the error
+	// that is left once it gives up, or none if it is recovered, instead of the error of its first execution
+	JobError interface {
+		Err() error
+	}
+
+	// JobResult is the outcome of the job once it is done, including its retries
+	JobResult struct {
+		Job     Job
+		Err     error
+		Elapsed time.Duration
+	}
+
 	Pool interface {
 		Start()
 		Stop()
 		Add(job Job)
+
+		// Wait blocks until every added job is done, and returns the errors of the failed jobs joined together. It
+		// returns early with the error of the context if the context is done first, or if the pool is stopped
+		Wait(ctx context.Context) error
+
+		// Results returns the result of every job that is done so far, in the order they are done
+		Results() []JobResult
+	}
+
+	// PanicError is the error of the job which panics while it is executed
+	PanicError struct {
+		Value interface{}
+		Stack []byte
 	}
 
 	worker struct {
@@ -26,11 +55,25 @@ type (
 		quit     chan struct{}
 		ctx      context.Context
 		logger   Logger
+		tracker  *jobTracker
+	}
+
+	// jobTracker counts the jobs of the pool until they are done and keeps their results
+	jobTracker struct {
+		mu       sync.Mutex
+		pending  int
+		idle     chan struct{} // closed once there is no pending job
+		finished []JobResult
 	}
 )
 
 var errPoolsize = fmt.Errorf("worker pool can't be less than 1")
 var errJobsize = fmt.Errorf("job size can't be negative")
+var errPoolStopped = fmt.Errorf("worker pool is stopped")
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v", e.Value)
+}
 
 func NewWorker(ctx context.Context, poolsize int, amount int, setting Setting) (Pool, error) {
 	if poolsize <= 0 {
@@ -49,15 +92,19 @@ func NewWorker(ctx context.Context, poolsize int, amount int, setting Setting) (
 		quit:     make(chan struct{}),
 		ctx:      ctx,
 		logger:   NewLogger(setting),
+		tracker:  newJobTracker(),
 	}, nil
 }
 
 func (w *worker) Start() {
 	w.start.Do(func() {
-		w.logger.Print("Starting worker...")
+		w.logger.Debug("Starting worker", "poolsize", w.poolsize)
 
 		for i := 0; i < w.poolsize; i++ {
 			go func(id int) {
+				metrics.workers.add(1)
+				defer metrics.workers.add(-1)
+
 				for {
 					select {
 					case <-w.quit:
@@ -67,9 +114,7 @@ func (w *worker) Start() {
 							return
 						}
 
-						if err := job.Execute(w.ctx); err != nil {
-							job.OnError(w.ctx, err)
-						}
+						w.tracker.done(execute(w.ctx, job, w.logger))
 					}
 				}
 			}(i)
@@ -78,15 +123,151 @@ func (w *worker) Start() {
 }
 
 func (w *worker) Add(job Job) {
+	w.tracker.add()
+
 	select {
 	case w.jobs <- job:
 	case <-w.quit:
+		// the job is never executed, so it isn't waited for
+		w.tracker.drop(1)
 	}
 }
 
+func (w *worker) Wait(ctx context.Context) error {
+	return w.tracker.wait(ctx, w.quit)
+}
+
+func (w *worker) Results() []JobResult {
+	return w.tracker.results()
+}
+
 func (w *worker) Stop() {
 	w.stop.Do(func() {
-		w.logger.Print("Stopping worker")
+		w.logger.Debug("Stopping worker")
 		close(w.quit)
 	})
 }
+
+// execute runs the job and lets the job handle its own failure. The panic of the job is recovered as its error, so one
+// job can't take the whole process down
+func execute(ctx context.Context, job Job, logger Logger) (result JobResult) {
+	metrics.activeChunks.add(1)
+	start := time.Now()
+	result.Job = job
+
+	defer func() {
+		if v := recover(); v != nil {
+			panicked := &PanicError{Value: v, Stack: debug.Stack()}
+			logger.Error("Job panicked", "panic", v, "stack", string(panicked.Stack))
+			result.Err = panicked
+		}
+
+		result.Elapsed = time.Since(start)
+		metrics.activeChunks.add(-1)
+	}()
+
+	if err := job.Execute(ctx); err != nil {
+		job.OnError(ctx, err)
+		result.Err = err
+		if failed, ok := job.(JobError); ok {
+			result.Err = failed.Err()
+		}
+	}
+
+	return result
+}
+
+func newJobTracker() *jobTracker {
+	idle := make(chan struct{})
+	close(idle)
+
+	return &jobTracker{idle: idle}
+}
+
+// add counts the job which is about to be queued
+func (t *jobTracker) add() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.pending++
+}
+
+// drop uncounts the jobs which are never executed
+func (t *jobTracker) drop(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.release(n)
+}
+
+// done records the result of the job and releases the waiters once there is no pending job
+func (t *jobTracker) done(result JobResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finished = append(t.finished, result)
+	t.release(1)
+}
+
+// release must be called with the lock held. It never releases more than the pending jobs, so the waiters are released
+// once they are all done
+func (t *jobTracker) release(n int) {
+	if n <= 0 || t.pending == 0 {
+		return
+	}
+
+	t.pending -= min(n, t.pending)
+	if t.pending == 0 {
+		close(t.idle)
+	}
+}
+
+// wait blocks until there is no pending job, the context is done, or the pool is stopped
+func (t *jobTracker) wait(ctx context.Context, quit <-chan struct{}) error {
+	t.mu.Lock()
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return t.errors()
+	default:
+	}
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-quit:
+		return errors.Join(t.errors(), errPoolStopped)
+	}
+
+	return t.errors()
+}
+
+// errors joins the errors of the failed jobs
+func (t *jobTracker) errors() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for _, result := range t.finished {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t *jobTracker) results() []JobResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	results := make([]JobResult, len(t.finished))
+	copy(results, t.finished)
+	return results
+}
@@ -2,6 +2,7 @@ package rapid
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -164,3 +165,151 @@ func TestWorkerPool_BlockedAddWorkReleaseAfterStop(t *testing.T) {
 		// this is the success case
 	}
 }
+
+func TestWorkerPool_Wait(t *testing.T) {
+	worker, err := NewWorker(ctx, 3, 10, DefaultSetting())
+	if err != nil {
+		t.Fatal("error making worker pool:", err)
+	}
+	worker.Start()
+	defer worker.Stop()
+
+	// waiting on the pool without any job returns right away
+	if err := worker.Wait(ctx); err != nil {
+		t.Fatalf("expected no error from idle pool, got %v", err)
+	}
+
+	errFirst := fmt.Errorf("first")
+	errSecond := fmt.Errorf("second")
+	worker.Add(newTestJob(func() error { return errFirst }, false, nil))
+	worker.Add(newTestJob(func() error { return errSecond }, false, nil))
+	for i := 0; i < 5; i++ {
+		worker.Add(newTestJob(nil, false, nil))
+	}
+
+	err = worker.Wait(ctx)
+	if !errors.Is(err, errFirst) || !errors.Is(err, errSecond) {
+		t.Fatalf("expected both job errors, got %v", err)
+	}
+
+	results := worker.Results()
+	if len(results) != 7 {
+		t.Fatalf("expected 7 results, got %d", len(results))
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	if failed != 2 {
+		t.Fatalf("expected 2 failed results, got %d", failed)
+	}
+}
+
+func TestWorkerPool_WaitContext(t *testing.T) {
+	worker, err := NewWorker(ctx, 1, 1, DefaultSetting())
+	if err != nil {
+		t.Fatal("error making worker pool:", err)
+	}
+	worker.Start()
+	defer worker.Stop()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	worker.Add(newTestJob(func() error {
+		<-release
+		return nil
+	}, false, nil))
+
+	wctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if err := worker.Wait(wctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestWorkerPool_RecoverPanic(t *testing.T) {
+	worker, err := NewWorker(ctx, 1, 2, DefaultSetting())
+	if err != nil {
+		t.Fatal("error making worker pool:", err)
+	}
+	worker.Start()
+	defer worker.Stop()
+
+	worker.Add(newTestJob(func() error { panic("boom") }, false, nil))
+	worker.Add(newTestJob(nil, false, nil))
+
+	err = worker.Wait(ctx)
+
+	var panicked *PanicError
+	if !errors.As(err, &panicked) {
+		t.Fatalf("expected panic error, got %v", err)
+	}
+
+	if panicked.Value != "boom" || len(panicked.Stack) == 0 {
+		t.Fatalf("expected panic value and stack, got %v", panicked.Value)
+	}
+
+	// the worker survives the panic and executes the next job
+	if results := worker.Results(); len(results) != 2 || results[1].Err != nil {
+		t.Fatalf("expected the next job to succeed, got %v", results)
+	}
+}
+
+// recoveredJob fails its execution, but recovers once its failure is handled
+type recoveredJob struct {
+	*testJob
+}
+
+func (r *recoveredJob) Err() error { return nil }
+
+func TestWorkerPool_JobError(t *testing.T) {
+	worker, err := NewWorker(ctx, 1, 2, DefaultSetting())
+	if err != nil {
+		t.Fatal("error making worker pool:", err)
+	}
+	worker.Start()
+	defer worker.Stop()
+
+	recovered := &recoveredJob{newTestJob(nil, true, nil)}
+	worker.Add(recovered)
+	worker.Add(newTestJob(nil, true, nil))
+
+	err = worker.Wait(ctx)
+	if !recovered.hitFailureCase() {
+		t.Fatal("expected the failure of the recovered job to be handled")
+	}
+
+	results := worker.Results()
+	if len(results) != 2 || err == nil {
+		t.Fatalf("expected the error of the other job, got %v", err)
+	}
+
+	for _, result := range results {
+		if _, ok := result.Job.(*recoveredJob); ok && result.Err != nil {
+			t.Fatalf("expected the recovered job to succeed, got %v", result.Err)
+		}
+	}
+}
+
+func TestJobTrackerRelease(t *testing.T) {
+	tracker := newJobTracker()
+	tracker.add()
+
+	// releasing more than the pending jobs still releases the waiters
+	tracker.drop(2)
+	tracker.add()
+	tracker.drop(1)
+
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if err := tracker.wait(wctx, nil); err != nil {
+		t.Fatalf("expected the tracker to be idle, got %v", err)
+	}
+}